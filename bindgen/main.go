@@ -0,0 +1,283 @@
+// smt パッケージの Context のメソッドから、DSL で使う関数のバインディングを生成するプログラム
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 生成しないメソッド
+var excludes = map[string]bool{
+	"Close": true, // defer ccc.Close() として直接呼び出す
+}
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	pkgDir := flag.String("pkg", "smt", "directory of the smt package")
+	pkgPath := flag.String("import", "github.com/bunji2/practiceofdsl/smt", "import path of the smt package")
+	out := flag.String("o", "lib2.go", "output file")
+	flag.Parse()
+
+	src, err := generate(*pkgDir, *pkgPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	err = ioutil.WriteFile(*out, src, 0644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 3
+	}
+	return 0
+}
+
+// method はバインディングを生成するメソッドの情報を保持する構造体型
+type method struct {
+	decl *ast.FuncDecl
+	file *ast.File
+}
+
+// generate はバインディングのソースコードを生成する関数
+func generate(pkgDir, pkgPath string) ([]byte, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, pkgDir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("%s: expected one package, found %d", pkgDir, len(pkgs))
+	}
+
+	var pkg *ast.Package
+	for _, p := range pkgs {
+		pkg = p
+	}
+	pkgName := pkg.Name
+
+	// ファイル名の順に処理して出力を安定させる
+	var fileNames []string
+	for name := range pkg.Files {
+		fileNames = append(fileNames, name)
+	}
+	sort.Strings(fileNames)
+
+	// パッケージで宣言されている公開された型と定数、Context のメソッドを集める
+	var typeNames, constNames []string
+	var methods []method
+	declared := map[string]bool{}
+	for _, name := range fileNames {
+		f := pkg.Files[name]
+		for _, d := range f.Decls {
+			switch decl := d.(type) {
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						declared[s.Name.Name] = true
+						if s.Name.IsExported() {
+							typeNames = append(typeNames, s.Name.Name)
+						}
+					case *ast.ValueSpec:
+						if decl.Tok != token.CONST {
+							continue
+						}
+						for _, n := range s.Names {
+							if n.IsExported() {
+								constNames = append(constNames, n.Name)
+							}
+						}
+					}
+				}
+			case *ast.FuncDecl:
+				if isContextMethod(decl) && decl.Name.IsExported() && !excludes[decl.Name.Name] {
+					methods = append(methods, method{decl: decl, file: f})
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by bindgen from package %s; DO NOT EDIT.\n\n", pkgName)
+	fmt.Fprintf(&buf, "package main\n\n")
+
+	// 使用しているパッケージのインポート
+	imports := map[string]bool{strconv.Quote(pkgPath): true}
+	for _, m := range methods {
+		for _, imp := range usedImports(m) {
+			imports[imp] = true
+		}
+	}
+	var importList []string
+	for imp := range imports {
+		importList = append(importList, imp)
+	}
+	sort.Strings(importList)
+	fmt.Fprintf(&buf, "import (\n")
+	for _, imp := range importList {
+		fmt.Fprintf(&buf, "\t%s\n", imp)
+	}
+	fmt.Fprintf(&buf, ")\n\n")
+
+	fmt.Fprintf(&buf, "// ccc は DSL の制約条件を保持するコンテクスト\n")
+	fmt.Fprintf(&buf, "var ccc *%s.Context\n\n", pkgName)
+
+	// 型と定数の別名
+	for _, name := range typeNames {
+		fmt.Fprintf(&buf, "// %s は %s.%s の別名\n", name, pkgName, name)
+		fmt.Fprintf(&buf, "type %s = %s.%s\n\n", name, pkgName, name)
+	}
+	if len(constNames) > 0 {
+		fmt.Fprintf(&buf, "// %s パッケージの定数\n", pkgName)
+		fmt.Fprintf(&buf, "const (\n")
+		for _, name := range constNames {
+			fmt.Fprintf(&buf, "\t%s = %s.%s\n", name, pkgName, name)
+		}
+		fmt.Fprintf(&buf, ")\n\n")
+	}
+
+	// メソッドのバインディング
+	for _, m := range methods {
+		writeBinding(&buf, fset, m.decl, pkgName, declared)
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+// isContextMethod は関数宣言が *Context のメソッドかどうかを調べる関数
+func isContextMethod(decl *ast.FuncDecl) bool {
+	if decl.Recv == nil || len(decl.Recv.List) != 1 {
+		return false
+	}
+	star, ok := decl.Recv.List[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	ident, ok := star.X.(*ast.Ident)
+	return ok && ident.Name == "Context"
+}
+
+// usedImports はメソッドのシグネチャで使われているパッケージのインポートを返す関数
+func usedImports(m method) (r []string) {
+	used := map[string]bool{}
+	ast.Inspect(m.decl.Type, func(n ast.Node) bool {
+		if se, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := se.X.(*ast.Ident); ok {
+				used[ident.Name] = true
+			}
+		}
+		return true
+	})
+	for _, spec := range m.file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := path[strings.LastIndex(path, "/")+1:]
+		name = strings.TrimPrefix(name, "go-") // github.com/mitchellh/go-z3 → z3
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if used[name] {
+			r = append(r, spec.Path.Value)
+		}
+	}
+	return
+}
+
+// writeBinding はメソッドを ccc に委譲する関数を出力する関数
+func writeBinding(buf *bytes.Buffer, fset *token.FileSet, decl *ast.FuncDecl, pkgName string, declared map[string]bool) {
+	// パッケージ内の型を pkgName.型名 に置き換えたシグネチャ
+	typ := qualify(decl.Type, pkgName, declared).(*ast.FuncType)
+
+	// 引数名の一覧（名前のない引数には名前をつける）
+	var args []string
+	variadic := false
+	if typ.Params != nil {
+		for i, field := range typ.Params.List {
+			if len(field.Names) == 0 {
+				field.Names = []*ast.Ident{ast.NewIdent(fmt.Sprintf("arg%d", i))}
+			}
+			for _, n := range field.Names {
+				args = append(args, n.Name)
+			}
+			_, variadic = field.Type.(*ast.Ellipsis)
+		}
+	}
+	call := fmt.Sprintf("ccc.%s(%s", decl.Name.Name, strings.Join(args, ", "))
+	if variadic {
+		call += "..."
+	}
+	call += ")"
+
+	var sig bytes.Buffer
+	format.Node(&sig, token.NewFileSet(), &ast.FuncDecl{Name: decl.Name, Type: typ})
+
+	if decl.Doc != nil {
+		for _, c := range decl.Doc.List {
+			fmt.Fprintln(buf, c.Text)
+		}
+	}
+	fmt.Fprintf(buf, "%s {\n", sig.String())
+	if typ.Results != nil && len(typ.Results.List) > 0 {
+		fmt.Fprintf(buf, "\treturn %s\n", call)
+	} else {
+		fmt.Fprintf(buf, "\t%s\n", call)
+	}
+	fmt.Fprintf(buf, "}\n\n")
+}
+
+// qualify は式の中のパッケージ内の型名を pkgName.型名 に置き換えた式を返す関数
+func qualify(expr ast.Expr, pkgName string, declared map[string]bool) ast.Expr {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if declared[e.Name] {
+			return &ast.SelectorExpr{X: ast.NewIdent(pkgName), Sel: ast.NewIdent(e.Name)}
+		}
+		return e
+	case *ast.StarExpr:
+		return &ast.StarExpr{X: qualify(e.X, pkgName, declared)}
+	case *ast.ArrayType:
+		return &ast.ArrayType{Len: e.Len, Elt: qualify(e.Elt, pkgName, declared)}
+	case *ast.MapType:
+		return &ast.MapType{Key: qualify(e.Key, pkgName, declared), Value: qualify(e.Value, pkgName, declared)}
+	case *ast.Ellipsis:
+		return &ast.Ellipsis{Elt: qualify(e.Elt, pkgName, declared)}
+	case *ast.ChanType:
+		return &ast.ChanType{Dir: e.Dir, Value: qualify(e.Value, pkgName, declared)}
+	case *ast.FuncType:
+		return &ast.FuncType{
+			Params:  qualifyFields(e.Params, pkgName, declared),
+			Results: qualifyFields(e.Results, pkgName, declared),
+		}
+	}
+	// SelectorExpr (z3.AST など) はそのまま
+	return expr
+}
+
+// qualifyFields は引数・返り値のリストの型名を置き換える関数
+func qualifyFields(fields *ast.FieldList, pkgName string, declared map[string]bool) *ast.FieldList {
+	if fields == nil {
+		return nil
+	}
+	r := &ast.FieldList{}
+	for _, f := range fields.List {
+		r.List = append(r.List, &ast.Field{
+			Names: f.Names,
+			Type:  qualify(f.Type, pkgName, declared),
+		})
+	}
+	return r
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// TestUpToDate は lib2.go が smt パッケージから生成し直したものと一致することを確かめる。
+// smt パッケージの公開メソッドやその説明を変更したら go generate で生成し直すこと。
+func TestUpToDate(t *testing.T) {
+	want, err := generate("../smt", "github.com/bunji2/practiceofdsl/smt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile("../lib2.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("lib2.go is out of date; run go generate")
+	}
+}
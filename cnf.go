@@ -0,0 +1,45 @@
+//go:build ignore
+
+// DIMACS CNF のファイルを DSL のランタイムで解決するプログラム
+//
+//	go run cnf.go lib.go lib2.go lib3.go [-backend sat] file.cnf
+//
+// dsl cnf file.cnf から実行する。変数 i は制約変数 p[i-1] となる。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bunji2/practiceofdsl/smt/sat"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	ccc = NewContext()
+	defer ccc.Close()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: dsl cnf [-dsl] file.cnf\n")
+		return 1
+	}
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer f.Close()
+
+	cnf, err := sat.ReadDIMACS(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flag.Arg(0), err)
+		return 3
+	}
+	cnf.Load(ccc, "p")
+	ccc.Solve("p")
+	return 0
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bunji2/practiceofdsl/smt/sat"
+)
+
+// runCNF は DIMACS CNF のファイルを同等の DSL のテキストに変換して表示する関数。
+// 変数 i は BoolArrayVar と同じく p[i-1] とする。
+func runCNF(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage %s cnf src.cnf\n", os.Args[0])
+		return 1
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer f.Close()
+
+	cnf, err := sat.ReadDIMACS(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 3
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s から変換した DSL\n", args[0])
+	if len(cnf.Comments) > 0 {
+		b.WriteString("//\n")
+		for _, c := range cnf.Comments {
+			if c == "" {
+				b.WriteString("//\n")
+				continue
+			}
+			fmt.Fprintf(&b, "// %s\n", c)
+		}
+	}
+	fmt.Fprintf(&b, "\nvar p [%d]Bool\n\n", cnf.NumVars)
+	for _, clause := range cnf.Clauses {
+		var lits []string
+		for _, l := range clause {
+			if l > 0 {
+				lits = append(lits, fmt.Sprintf("p[%d]", l-1))
+			} else {
+				lits = append(lits, fmt.Sprintf("!p[%d]", -l-1))
+			}
+		}
+		if len(lits) == 0 {
+			lits = append(lits, "false")
+		}
+		fmt.Fprintf(&b, "Assert(%s)\n", strings.Join(lits, " || "))
+	}
+	b.WriteString("Solve(p)\n")
+	fmt.Print(b.String())
+	return 0
+}
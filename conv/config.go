@@ -0,0 +1,97 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+)
+
+// configCalls はソルバーを作成する前に適用する設定の関数
+var configCalls = map[string]bool{
+	"SetOption": true,
+	"UseTactic": true,
+	"UseLogic":  true,
+}
+
+// isConfigCall は式がソルバーの設定の関数の呼び出しかどうかをチェックする関数
+func isConfigCall(expr ast.Expr) bool {
+	ce, ok := expr.(*ast.CallExpr)
+	if ok {
+		ident, ok := ce.Fun.(*ast.Ident)
+		return ok && configCalls[ident.Name]
+	}
+	return false
+}
+
+// convConfigCall は設定の関数の引数を文字列に変換する関数
+func convConfigCall(ce *ast.CallExpr) {
+	// Before: SetOption(smt.random_seed, 7)
+	// After:  SetOption("smt.random_seed", "7")
+
+	// Before: UseLogic(QF_LIA)
+	// After:  UseLogic("QF_LIA")
+
+	name := ce.Fun.(*ast.Ident).Name
+	if name == "SetOption" && len(ce.Args) != 2 {
+		sortError(ce.Pos(), "SetOption needs a name and a value")
+		return
+	}
+	for i, arg := range ce.Args {
+		lit, ok := optionString(arg)
+		if !ok {
+			sortError(arg.Pos(), "%s: argument must be a name or a literal", name)
+			continue
+		}
+		ce.Args[i] = lit
+	}
+}
+
+// optionString は設定の関数の引数を文字列のリテラルに変換する関数。
+// 名前（QF_LIA や smt.random_seed）とリテラル（7、-1、0.5、true）を変換できる。
+func optionString(expr ast.Expr) (*ast.BasicLit, bool) {
+	var s string
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind == token.STRING {
+			return e, true
+		}
+		s = e.Value
+	case *ast.Ident:
+		s = e.Name
+	case *ast.SelectorExpr:
+		x, ok := optionString(e.X)
+		if !ok || x.Kind != token.STRING {
+			return nil, false
+		}
+		prefix, _ := strconv.Unquote(x.Value)
+		s = prefix + "." + e.Sel.Name
+	case *ast.UnaryExpr:
+		lit, ok := e.X.(*ast.BasicLit)
+		if e.Op != token.SUB || !ok || lit.Kind == token.STRING {
+			return nil, false
+		}
+		s = "-" + lit.Value
+	default:
+		return nil, false
+	}
+	return &ast.BasicLit{ValuePos: expr.Pos(), Kind: token.STRING, Value: strconv.Quote(s)}, true
+}
+
+// hoistConfigs は main 関数のトップレベルにある設定の関数の呼び出しを、
+// NewContext と defer ccc.Close() の直後に移動する関数。
+// 設定は最初の Assert でソルバーを作成する前に適用する必要があるため。
+func hoistConfigs(stmts []ast.Stmt) {
+	const header = 2 // srcHeader のステートメント数
+	if len(stmts) <= header {
+		return
+	}
+	var configs, others []ast.Stmt
+	for _, stmt := range stmts[header:] {
+		if es, ok := stmt.(*ast.ExprStmt); ok && isConfigCall(es.X) {
+			configs = append(configs, stmt)
+		} else {
+			others = append(others, stmt)
+		}
+	}
+	copy(stmts[header:], append(configs, others...))
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// constValue は変換後の式を定数として評価する関数。
+// 制約変数を含むなど定数として評価できない場合は ok が false となる。
+func constValue(expr ast.Expr) (v constant.Value, ok bool) {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return constValue(e.X)
+
+	case *ast.CallExpr:
+		switch fun := e.Fun.(type) {
+		case *ast.Ident: // IntVal(123), NumVal("1.5"), True(), False()
+			return constLit(fun.Name, e.Args)
+		case *ast.SelectorExpr: // x.Add(y) など
+			return constOp(fun.Sel.Name, fun.X, e.Args)
+		}
+	}
+	return
+}
+
+// constLit は convBasicLit / convIdent が生成したリテラルを評価する関数
+func constLit(name string, args []ast.Expr) (v constant.Value, ok bool) {
+	switch name {
+	case "True":
+		return constant.MakeBool(true), len(args) == 0
+	case "False":
+		return constant.MakeBool(false), len(args) == 0
+	case "IntVal", "NumVal":
+		if len(args) != 1 {
+			return
+		}
+		lit, isLit := args[0].(*ast.BasicLit)
+		if !isLit {
+			// IntVal(n) のように Go の変数が指定された場合
+			return
+		}
+		s := lit.Value
+		kind := lit.Kind
+		if kind == token.STRING {
+			// NumVal("1.5"), NumVal("1/3")
+			var err error
+			if s, err = strconv.Unquote(s); err != nil {
+				return
+			}
+			kind = token.FLOAT
+			if i := strings.Index(s, "/"); i >= 0 {
+				num := constant.MakeFromLiteral(s[:i], token.INT, 0)
+				den := constant.MakeFromLiteral(s[i+1:], token.INT, 0)
+				if num.Kind() != constant.Int || den.Kind() != constant.Int || constant.Sign(den) == 0 {
+					return
+				}
+				num = constant.ToFloat(num)
+				return constant.BinaryOp(num, token.QUO, den), true
+			}
+		}
+		v = constant.MakeFromLiteral(s, kind, 0)
+		if kind == token.FLOAT {
+			// 1.0 のような整数値も Num として扱う
+			v = constant.ToFloat(v)
+		}
+		ok = v.Kind() != constant.Unknown
+	}
+	return
+}
+
+// constOp は演算子のメソッド呼び出しを評価する関数
+func constOp(op string, recv ast.Expr, args []ast.Expr) (v constant.Value, ok bool) {
+	x, ok := constValue(recv)
+	if !ok {
+		return
+	}
+	var ys []constant.Value
+	for _, arg := range args {
+		y, yok := constValue(arg)
+		if !yok {
+			ok = false
+			return
+		}
+		ys = append(ys, y)
+	}
+	ok = false
+
+	// 単項演算
+	switch op {
+	case "Not":
+		if len(ys) == 0 && isBoolConst(x) {
+			return constant.UnaryOp(token.NOT, x, 0), true
+		}
+		return
+	case "Neg":
+		if len(ys) == 0 && isNumConst(x) {
+			return constant.UnaryOp(token.SUB, x, 0), true
+		}
+		return
+	case "Distinct":
+		all := append([]constant.Value{x}, ys...)
+		for i := range all {
+			for j := i + 1; j < len(all); j++ {
+				if !sameKind(all[i], all[j]) {
+					return
+				}
+				if constant.Compare(all[i], token.EQL, all[j]) {
+					return constant.MakeBool(false), true
+				}
+			}
+		}
+		return constant.MakeBool(true), true
+	case "Ite":
+		if len(ys) == 2 && isBoolConst(x) && sameKind(ys[0], ys[1]) {
+			if constant.BoolVal(x) {
+				return ys[0], true
+			}
+			return ys[1], true
+		}
+		return
+	}
+
+	// 二項演算
+	if len(ys) != 1 {
+		return
+	}
+	y := ys[0]
+	if !sameKind(x, y) {
+		return
+	}
+	switch op {
+	case "Add", "Sub", "Mul":
+		if !isNumConst(x) {
+			return
+		}
+		tok := map[string]token.Token{"Add": token.ADD, "Sub": token.SUB, "Mul": token.MUL}[op]
+		return constant.BinaryOp(x, tok, y), true
+	case "Div":
+		if !isNumConst(x) || constant.Sign(y) == 0 {
+			return
+		}
+		if x.Kind() == constant.Int && y.Kind() == constant.Int {
+			// Z3 の整数の div はユークリッド除算（剰余は非負）
+			q := new(big.Int).Div(bigInt(x), bigInt(y))
+			return constant.Make(q), true
+		}
+		return constant.BinaryOp(constant.ToFloat(x), token.QUO, y), true
+	case "Mod":
+		// Z3 の mod は除数の符号によらず非負となるため、Go の % とは結果が異なる
+		if x.Kind() != constant.Int || y.Kind() != constant.Int || constant.Sign(y) == 0 {
+			return
+		}
+		r := constant.BinaryOp(x, token.REM, y)
+		if constant.Sign(r) < 0 {
+			if constant.Sign(y) < 0 {
+				y = constant.UnaryOp(token.SUB, y, 0)
+			}
+			r = constant.BinaryOp(r, token.ADD, y)
+		}
+		return r, true
+	case "Gt", "Ge", "Lt", "Le":
+		if !isNumConst(x) {
+			return
+		}
+		tok := map[string]token.Token{"Gt": token.GTR, "Ge": token.GEQ, "Lt": token.LSS, "Le": token.LEQ}[op]
+		return constant.MakeBool(constant.Compare(x, tok, y)), true
+	case "Eq":
+		return constant.MakeBool(constant.Compare(x, token.EQL, y)), true
+	case "And", "Or", "Xor", "Implies", "Iff":
+		if !isBoolConst(x) {
+			return
+		}
+		a, b := constant.BoolVal(x), constant.BoolVal(y)
+		var r bool
+		switch op {
+		case "And":
+			r = a && b
+		case "Or":
+			r = a || b
+		case "Xor":
+			r = a != b
+		case "Implies":
+			r = !a || b
+		case "Iff":
+			r = a == b
+		}
+		return constant.MakeBool(r), true
+	}
+	return
+}
+
+// bigInt は整数の定数を big.Int に変換する関数
+func bigInt(v constant.Value) *big.Int {
+	n, _ := new(big.Int).SetString(v.ExactString(), 10)
+	return n
+}
+
+// ratString は数値の定数を NumVal で扱える "分子/分母" の文字列に変換する関数
+func ratString(v constant.Value) string {
+	num := constant.Num(constant.ToFloat(v))
+	den := constant.Denom(constant.ToFloat(v))
+	if den.ExactString() == "1" {
+		return num.ExactString()
+	}
+	return num.ExactString() + "/" + den.ExactString()
+}
+
+// isBoolConst は定数が真理値かどうかを調べる関数
+func isBoolConst(v constant.Value) bool {
+	return v.Kind() == constant.Bool
+}
+
+// isNumConst は定数が数値（整数または数値）かどうかを調べる関数
+func isNumConst(v constant.Value) bool {
+	return v.Kind() == constant.Int || v.Kind() == constant.Float
+}
+
+// sameKind は二つの定数が比較・演算可能な種類どうしかを調べる関数
+func sameKind(x, y constant.Value) bool {
+	return isBoolConst(x) == isBoolConst(y)
+}
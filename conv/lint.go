@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// diagnostic は検査で検出した問題を表す構造体型
+type diagnostic struct {
+	pos token.Pos
+	msg string
+}
+
+// linter は lint の検査状態を保持する構造体型
+type linter struct {
+	used  map[string]bool // Assert / Solve で使用された制約変数
+	diags []diagnostic
+}
+
+// runLint は DSL を変換した AST を検査し、疑わしい制約条件を警告する関数。
+// 警告があった場合は 1 を返す。
+func runLint(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "Usage %s lint src.txt\n", os.Args[0])
+		return 1
+	}
+
+	fset, f, code := parseSrc(args[0])
+	if code != 0 {
+		return code
+	}
+
+	// 変換後の AST を検査の対象とする
+	stmts := pickupMainStmts(f)
+	convStmts(stmts)
+
+	// 変換時に検出したソートのエラーも合わせて報告する
+	l := &linter{used: map[string]bool{}, diags: sortErrors}
+	l.lintStmts(stmts, false)
+	l.checkUnused()
+
+	sort.SliceStable(l.diags, func(i, j int) bool {
+		if l.diags[i].pos != l.diags[j].pos {
+			return l.diags[i].pos < l.diags[j].pos
+		}
+		return l.diags[i].msg < l.diags[j].msg
+	})
+	for _, d := range l.diags {
+		fmt.Printf("%s: %s\n", dslPosition(fset, args[0], d.pos), d.msg)
+	}
+	if len(l.diags) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// warn は警告を追加する関数
+func (l *linter) warn(pos token.Pos, format string, args ...interface{}) {
+	l.diags = append(l.diags, diagnostic{pos: pos, msg: fmt.Sprintf(format, args...)})
+}
+
+// lintStmts はステートメントのリストを検査する関数。
+// dead が true の場合は実行されないブロックの中であることを示す。
+func (l *linter) lintStmts(stmts []ast.Stmt, dead bool) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.ExprStmt:
+			if isAssert(s.X) {
+				ce := s.X.(*ast.CallExpr)
+				if dead {
+					l.warn(ce.Pos(), "unreachable Assert")
+				}
+				l.lintAssert(ce.Args[0])
+			} else if isObjective(s.X) {
+				// 目的関数も制約条件と同じく検査する
+				l.lintAssert(s.X.(*ast.CallExpr).Args[0])
+			} else if ce, ok := s.X.(*ast.CallExpr); ok && (isIdent(ce.Fun, "Solve") || isIdent(ce.Fun, "SolveAll")) {
+				l.lintSolve(ce)
+			} else if isNameCall(s.X) {
+				// SolveGrid / Display の第一引数も Solve の引数と同じく検査する
+				ce := s.X.(*ast.CallExpr)
+				l.lintSolve(&ast.CallExpr{Fun: ce.Fun, Args: ce.Args[:1]})
+			}
+		case *ast.ForStmt:
+			if s.Body != nil {
+				l.lintStmts(s.Body.List, dead)
+			}
+		case *ast.RangeStmt:
+			if s.Body != nil {
+				l.lintStmts(s.Body.List, dead)
+			}
+		case *ast.IfStmt:
+			// if false { ... } の中、および if true { ... } else { ... } の
+			// else 節の中は実行されない
+			if s.Body != nil {
+				l.lintStmts(s.Body.List, dead || isIdent(s.Cond, "false"))
+			}
+			if s.Else != nil {
+				l.lintStmts([]ast.Stmt{s.Else}, dead || isIdent(s.Cond, "true"))
+			}
+		case *ast.BlockStmt:
+			l.lintStmts(s.List, dead)
+		}
+	}
+}
+
+// lintAssert は Assert 関数の引数（変換後の式）を検査する関数
+func (l *linter) lintAssert(expr ast.Expr) {
+	// 定数の制約条件
+	if v, ok := constValue(expr); ok && v.Kind() == constant.Bool {
+		l.warn(exprPos(expr), "Assert is always %v", constant.BoolVal(v))
+	}
+
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch e := n.(type) {
+		case *ast.Ident:
+			if _, ok := constraintVars[e.Name]; ok {
+				l.used[e.Name] = true
+			}
+		case *ast.CallExpr:
+			se, ok := e.Fun.(*ast.SelectorExpr)
+			if !ok {
+				break
+			}
+			switch se.Sel.Name {
+			case "Distinct":
+				for _, arg := range append([]ast.Expr{se.X}, e.Args...) {
+					if !isVarRef(arg) {
+						l.warn(exprPos(arg), "Distinct argument is not a constraint variable")
+					}
+				}
+			case "Pow":
+				l.warn(exprPos(se.Sel), "nonlinear term: Pow")
+			case "Mul":
+				if refersVar(se.X) && len(e.Args) > 0 && refersVar(e.Args[0]) {
+					l.warn(exprPos(se.Sel), "nonlinear term: variable multiplied by variable")
+				}
+			case "Div":
+				if len(e.Args) > 0 && refersVar(e.Args[0]) {
+					l.warn(exprPos(se.Sel), "nonlinear term: division by variable")
+				}
+			}
+		}
+		return true
+	})
+}
+
+// lintSolve は Solve 関数の引数を検査する関数
+func (l *linter) lintSolve(ce *ast.CallExpr) {
+	for _, arg := range ce.Args {
+		var name string
+		switch a := arg.(type) {
+		case *ast.BasicLit: // 変換後の "x"
+			if a.Kind != token.STRING {
+				continue
+			}
+			name, _ = strconv.Unquote(a.Value)
+		case *ast.Ident:
+			name = a.Name
+		default:
+			continue
+		}
+		if _, ok := constraintVars[name]; !ok {
+			l.warn(arg.Pos(), "Solve argument %s is not declared", name)
+			continue
+		}
+		l.used[name] = true
+	}
+}
+
+// checkUnused は Assert / Solve のいずれでも使われていない制約変数を警告する関数
+func (l *linter) checkUnused() {
+	for name, v := range constraintVars {
+		if !l.used[name] {
+			l.warn(v.pos, "%s declared but not used in Assert or Solve", name)
+		}
+	}
+}
+
+// isIdent は式が指定された名前の識別子かどうかを調べる関数
+func isIdent(expr ast.Expr, name string) bool {
+	for {
+		pe, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = pe.X
+	}
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == name
+}
+
+// isVarRef は式が制約変数（x または x[i]）そのものかどうかを調べる関数
+func isVarRef(expr ast.Expr) bool {
+	if ie, ok := expr.(*ast.IndexExpr); ok {
+		expr = ie.X
+	}
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	_, ok = constraintVars[ident.Name]
+	return ok
+}
+
+// refersVar は式が制約変数を含むかどうかを調べる関数
+func refersVar(expr ast.Expr) (found bool) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok {
+			if _, ok := constraintVars[ident.Name]; ok {
+				found = true
+			}
+		}
+		return !found
+	})
+	return
+}
+
+// exprPos は式の中で位置情報を持つ最初のノードの位置を返す関数。
+// 変換で生成されたノードは位置情報を持たないため、元のノードの位置を探す。
+func exprPos(expr ast.Node) (pos token.Pos) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if n == nil || pos.IsValid() {
+			return false
+		}
+		if id, ok := n.(*ast.Ident); ok && id.NamePos.IsValid() {
+			pos = id.NamePos
+		} else if bl, ok := n.(*ast.BasicLit); ok && bl.ValuePos.IsValid() {
+			pos = bl.ValuePos
+		}
+		return !pos.IsValid()
+	})
+	return
+}
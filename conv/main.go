@@ -2,10 +2,13 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"go/ast"
+	"go/constant"
 	"go/format"
 	"go/parser"
+	"go/printer"
 	"go/token"
 	"io/ioutil"
 	"os"
@@ -19,37 +22,33 @@ func main() {
 
 func run() int {
 
-	if len(os.Args) < 3 {
-		fmt.Fprintf(os.Stderr, "Usage %s src.txt dst.go\n", os.Args[0])
-		return 1
+	if len(os.Args) >= 2 && os.Args[1] == "lint" {
+		// lint サブコマンド
+		return runLint(os.Args[2:])
 	}
 
-	// 入力ファイルの読み出し
-	src, err := readSrc(os.Args[1])
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 2
+	if len(os.Args) >= 2 && os.Args[1] == "smt2" {
+		// smt2 サブコマンド
+		return runSMT2(os.Args[2:])
 	}
 
-	// 入力の前後に文字列を追加
-	src = `package main
-func main() {
-ccc = NewContext()
-defer ccc.Close()
-` + src + "}"
+	if len(os.Args) >= 2 && os.Args[1] == "cnf" {
+		// cnf サブコマンド
+		return runCNF(os.Args[2:])
+	}
 
-	// [XXX]
-	// 利用者に対しては変数名 ccc が予約語で使用禁止であることを
-	// 知らせる必要がある。
-	// 理想は変数名をランダム化することだが、実装は面倒である。
-	// また実装の変更は lib2.go にも影響することに注意。
+	if len(os.Args) < 3 {
+		fmt.Fprintf(os.Stderr, "Usage %s src.txt dst.go\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "      %s lint src.txt\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "      %s smt2 src.smt2\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "      %s cnf src.cnf\n", os.Args[0])
+		return 1
+	}
 
-	// Golang の構文としてパース
-	fset := token.NewFileSet()
-	f, err := parser.ParseFile(fset, "", src, 0)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 3
+	// 入力ファイルの読み出しとパース
+	fset, f, code := parseSrc(os.Args[1])
+	if code != 0 {
+		return code
 	}
 
 	//ast.Print(fset, f)
@@ -62,6 +61,16 @@ defer ccc.Close()
 	// この仕様を変更する場合は上の行を含めて全体の見直しが必要となる。
 
 	convStmts(stmts)
+	// ソルバーの設定はプログラムの先頭に移動する
+	hoistConfigs(stmts)
+
+	// ソートのエラーがあればコードを出力しない
+	if len(sortErrors) > 0 {
+		for _, d := range sortErrors {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", dslPosition(fset, os.Args[1], d.pos), d.msg)
+		}
+		return 4
+	}
 
 	/*
 		// 各ステートメントの処理
@@ -110,7 +119,7 @@ defer ccc.Close()
 	*/
 
 	// ASTをファイルに保存
-	err = saveSrc(os.Args[2], f)
+	err := saveSrc(os.Args[2], f)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 3
@@ -119,6 +128,86 @@ defer ccc.Close()
 	return 0
 }
 
+// srcHeader は入力の前に追加する文字列
+const srcHeader = `package main
+func main() {
+ccc = NewContext()
+defer ccc.Close()
+`
+
+// [XXX]
+// 利用者に対しては変数名 ccc が予約語で使用禁止であることを
+// 知らせる必要がある。
+// 理想は変数名をランダム化することだが、実装は面倒である。
+// また実装の変更は lib2.go にも影響することに注意。
+
+// srcHeaderLines は srcHeader の行数。エラー位置を DSL の行番号に戻すのに使う。
+var srcHeaderLines = strings.Count(srcHeader, "\n")
+
+// parseSrc は入力ファイルを読み出し、前後に文字列を追加してパースする関数。
+// 失敗した場合は 0 以外の終了コードを返す。
+func parseSrc(filename string) (fset *token.FileSet, f *ast.File, code int) {
+	// 入力ファイルの読み出し
+	src, err := readSrc(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		code = 2
+		return
+	}
+
+	// 入力の前後に文字列を追加
+	src = srcHeader + src + "}"
+
+	// Golang の構文としてパース
+	fset = token.NewFileSet()
+	f, err = parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		code = 3
+		return
+	}
+	srcText, srcFile = src, fset.File(f.Pos())
+	return
+}
+
+// 最後にパースした入力（前後に追加した文字列を含む）とその位置の情報。Show の名前を作るのに使う
+var (
+	srcText string
+	srcFile *token.File
+)
+
+// dslPosition は AST 上の位置を DSL ファイル上の位置に変換する関数
+func dslPosition(fset *token.FileSet, filename string, pos token.Pos) token.Position {
+	p := fset.Position(pos)
+	p.Filename = filename
+	if p.Line > srcHeaderLines {
+		p.Line -= srcHeaderLines
+	}
+	return p
+}
+
+// constraintVar は宣言された制約変数の情報を保持する構造体型
+type constraintVar struct {
+	sort string    // Int, Num, Bool のいずれか
+	size int       // 配列の要素数。配列でない場合は 0
+	pos  token.Pos // 宣言の位置
+}
+
+// constraintVars は宣言された制約変数の一覧。キーは変数名。
+var constraintVars = map[string]constraintVar{}
+
+// registerVars は宣言された制約変数を一覧に登録する関数
+func registerVars(names []string, typ string, pos token.Pos) {
+	typs := strings.Split(typ, "_")
+	v := constraintVar{sort: typs[0], pos: pos}
+	if len(typs) > 1 {
+		v.size, _ = strconv.Atoi(typs[1])
+	}
+	for _, name := range names {
+		constraintVars[name] = v
+	}
+}
+
 func convStmts(stmts []ast.Stmt) {
 	// 各ステートメントの処理
 	for i, stmt := range stmts {
@@ -132,6 +221,8 @@ func convStmts(stmts []ast.Stmt) {
 				// 変数の定義でない場合はなにもしない
 				break
 			}
+			// 制約変数の一覧に登録
+			registerVars(names, typ, ds.Pos())
 			// ステートメントを書き換え
 			stmts[i] = makeASTVarDecl(names, typ)
 
@@ -141,8 +232,8 @@ func convStmts(stmts []ast.Stmt) {
 			if isAssert(es.X) {
 				// Assert 関数のとき
 				ce := es.X.(*ast.CallExpr)
-				// 第一引数を変換
-				ce.Args[0] = convExpr(ce.Args[0])
+				// 第一引数を変換し、ソートを検査
+				ce.Args[0] = checkAssertSort(convExpr(ce.Args[0]))
 
 			} else if isSolve(es.X) {
 				// Solve 関数のとき
@@ -152,25 +243,62 @@ func convStmts(stmts []ast.Stmt) {
 				for _, arg := range ce.Args {
 					ident := arg.(*ast.Ident)
 					args = append(args, &ast.BasicLit{
-						Kind:  token.STRING,
-						Value: "\"" + ident.Name + "\"",
+						ValuePos: ident.Pos(),
+						Kind:     token.STRING,
+						Value:    "\"" + ident.Name + "\"",
 					})
 				}
 				// Solve 関数の引数を書き換え
 				ce.Args = args
+
+			} else if isNameCall(es.X) {
+				// SolveGrid / Display 関数のとき
+				ce := es.X.(*ast.CallExpr)
+				// 第一引数で指定された Ident を文字列に変換
+				ident := ce.Args[0].(*ast.Ident)
+				ce.Args[0] = &ast.BasicLit{
+					ValuePos: ident.Pos(),
+					Kind:     token.STRING,
+					Value:    "\"" + ident.Name + "\"",
+				}
+
+			} else if isObjective(es.X) {
+				// Minimize / Maximize 関数のとき
+				ce := es.X.(*ast.CallExpr)
+				// 第一引数を変換し、ソートを検査
+				ce.Args[0] = checkObjectiveSort(ce.Fun.(*ast.Ident).Name, convExpr(ce.Args[0]))
+
+			} else if isConfigCall(es.X) {
+				// SetOption / UseTactic / UseLogic 関数のとき
+				// 名前と値を文字列に変換
+				convConfigCall(es.X.(*ast.CallExpr))
+
+			} else {
+				convTermCalls(es.X)
+			}
+		case *ast.AssignStmt: // 代入のステートメント
+			as := stmt.(*ast.AssignStmt)
+			for _, rhs := range as.Rhs {
+				convTermCalls(rhs)
 			}
 		case *ast.ForStmt:
 			fs := stmt.(*ast.ForStmt)
+			convTermCalls(fs.Init)
+			convTermCalls(fs.Cond)
+			convTermCalls(fs.Post)
 			if fs.Body != nil {
 				convStmts(fs.Body.List)
 			}
 		case *ast.RangeStmt:
 			rs := stmt.(*ast.RangeStmt)
+			convTermCalls(rs.X)
 			if rs.Body != nil {
 				convStmts(rs.Body.List)
 			}
 		case *ast.IfStmt:
 			is := stmt.(*ast.IfStmt)
+			convTermCalls(is.Init)
+			convTermCalls(is.Cond)
 			if is.Body != nil {
 				convStmts([]ast.Stmt{is.Body})
 			}
@@ -355,35 +483,8 @@ func convBinaryExpr(expr *ast.BinaryExpr) (r ast.Expr) {
 	// Before: expr1 != expr2
 	// After:  (conv(expr1).Eq(conv(expr2))).Not()
 
-	var op string
-	switch expr.Op {
-	case token.ADD: // +
-		op = "Add"
-	case token.SUB: // -
-		op = "Sub"
-	case token.MUL: // *
-		op = "Mul"
-	case token.REM: // %
-		op = "Mod"
-	case token.LAND: // &&
-		op = "And"
-	case token.LOR: // ||
-		op = "Or"
-	case token.XOR: // ^
-		op = "Xor"
-	case token.GTR: // >
-		op = "Gt"
-	case token.GEQ: // >=
-		op = "Ge"
-	case token.LSS: // <
-		op = "Lt"
-	case token.LEQ: // <=
-		op = "Le"
-	case token.EQL: // ==
-		op = "Eq"
-	case token.NEQ: // != // [NEQ]
-		op = "Eq"
-	default:
+	op, ok := binaryMethods[expr.Op]
+	if !ok {
 		r = expr
 		return
 	}
@@ -393,10 +494,11 @@ func convBinaryExpr(expr *ast.BinaryExpr) (r ast.Expr) {
 	x := convExpr(expr.X)
 	y := convExpr(expr.Y)
 
+	// 演算子の位置は lint などでの警告表示のために引き継ぐ
 	r = &ast.CallExpr{
 		Fun: &ast.SelectorExpr{
 			X:   x,
-			Sel: ast.NewIdent(op),
+			Sel: &ast.Ident{NamePos: expr.OpPos, Name: op},
 		},
 		Args: []ast.Expr{
 			y,
@@ -406,13 +508,40 @@ func convBinaryExpr(expr *ast.BinaryExpr) (r ast.Expr) {
 		r = &ast.CallExpr{
 			Fun: &ast.SelectorExpr{
 				X:   r,
-				Sel: ast.NewIdent("Not"),
+				Sel: &ast.Ident{NamePos: expr.OpPos, Name: "Not"},
 			},
 		}
 	}
+	if expr.Op == token.QUO {
+		// 定数どうしの除算は有理数に畳み込む
+		// Before: 1.0 / 3
+		// After:  NumVal("1/3")
+		if v, ok := constValue(r); ok && v.Kind() == constant.Float {
+			r = makeNumVal(ratString(v), expr.Pos())
+		}
+	}
 	return
 }
 
+// binaryMethods は二項演算子と変換後のメソッド名の対応。
+// != は Eq に変換した後で Not を適用する。
+var binaryMethods = map[token.Token]string{
+	token.ADD:  "Add", // +
+	token.SUB:  "Sub", // -
+	token.MUL:  "Mul", // *
+	token.QUO:  "Div", // /
+	token.REM:  "Mod", // %
+	token.LAND: "And", // &&
+	token.LOR:  "Or",  // ||
+	token.XOR:  "Xor", // ^
+	token.GTR:  "Gt",  // >
+	token.GEQ:  "Ge",  // >=
+	token.LSS:  "Lt",  // <
+	token.LEQ:  "Le",  // <=
+	token.EQL:  "Eq",  // ==
+	token.NEQ:  "Eq",  // != // [NEQ]
+}
+
 // convUnaryExpr は単行演算式を変換する関数
 func convUnaryExpr(expr *ast.UnaryExpr) (r ast.Expr) {
 	// Before: !expr
@@ -421,17 +550,13 @@ func convUnaryExpr(expr *ast.UnaryExpr) (r ast.Expr) {
 	// Before: -expr
 	// After:  conv(expr).Neg()
 
-	var ident *ast.Ident
-	switch expr.Op {
-	case token.NOT: // !
-		ident = ast.NewIdent("Not")
-	case token.SUB: // -
-		ident = ast.NewIdent("Neg")
-	default:
+	name, ok := unaryMethods[expr.Op]
+	if !ok {
 		// 上記以外は変換せずリターン
 		r = expr
 		return
 	}
+	ident := &ast.Ident{NamePos: expr.OpPos, Name: name}
 
 	r = &ast.CallExpr{
 		Fun: &ast.SelectorExpr{
@@ -443,6 +568,31 @@ func convUnaryExpr(expr *ast.UnaryExpr) (r ast.Expr) {
 	return
 }
 
+// unaryMethods は単項演算子と変換後のメソッド名の対応
+var unaryMethods = map[token.Token]string{
+	token.NOT: "Not", // !
+	token.SUB: "Neg", // -
+}
+
+// opTokens はメソッド名と演算子の対応。binaryMethods と unaryMethods の逆引き。
+// 二項演算子と単項演算子の両方にある - は Sub と Neg のそれぞれに対応する。
+var opTokens = map[string]token.Token{}
+
+// opSymbols はエラー表示などに使うメソッド名と演算子の表記の対応
+var opSymbols = map[string]string{}
+
+func init() {
+	for _, methods := range []map[token.Token]string{binaryMethods, unaryMethods} {
+		for tok, name := range methods {
+			if tok == token.NEQ { // [NEQ]
+				continue
+			}
+			opTokens[name] = tok
+			opSymbols[name] = tok.String()
+		}
+	}
+}
+
 // convCallExpr は関数呼び出し式を変換する関数
 func convCallExpr(expr *ast.CallExpr) (r ast.Expr) {
 	// Before: Distinct(x1,x2,...,xN)
@@ -466,16 +616,55 @@ func convCallExpr(expr *ast.CallExpr) (r ast.Expr) {
 			r = &ast.CallExpr{
 				Fun: &ast.SelectorExpr{
 					X:   args[0],
-					Sel: ast.NewIdent("Distinct"),
+					Sel: &ast.Ident{NamePos: ident.Pos(), Name: "Distinct"},
 				},
 				Args: args[1:],
 			}
-			// [TODO] Distinct の引数は変数のみなので、
-			// args の各要素がすべて変数の AST かどうかチェックすべき。
+			// [MEMO] Distinct の引数は変数のみを想定している。
 			// 変数以外の式が引数に指定された場合は多分、
 			// ランタイムエラーになると思われる。
+			// 変換時にはチェックせず、lint サブコマンドで警告する。
+		case "Rat":
+			// Before: Rat(1, 3)
+			// After:  NumVal("1/3")
+
+			// 引数が定数でない場合は実行時の Rat 関数のまま変換しない
+			r = expr
+			if len(args) != 2 {
+				return
+			}
+			num, ok1 := constValue(args[0])
+			den, ok2 := constValue(args[1])
+			if !ok1 || !ok2 || num.Kind() != constant.Int || den.Kind() != constant.Int {
+				return
+			}
+			if constant.Sign(den) == 0 {
+				sortError(exprPos(args[1]), "division by zero in Rat")
+				return
+			}
+			v := constant.BinaryOp(num, token.QUO, den)
+			r = makeNumVal(ratString(v), ident.Pos())
+		case "ToNum", "ToInt", "IsInt":
+			// Before: ToNum(expr)
+			// After:  conv(expr).ToReal()
+
+			// Before: ToInt(expr)
+			// After:  conv(expr).ToInt()
+
+			// Before: IsInt(expr)
+			// After:  conv(expr).IsInt()
+			if len(args) != 1 {
+				r = expr
+				return
+			}
+			r = &ast.CallExpr{
+				Fun: &ast.SelectorExpr{
+					X:   args[0],
+					Sel: &ast.Ident{NamePos: ident.Pos(), Name: convMethods[ident.Name]},
+				},
+			}
 		default:
-			// Distinct 関数以外は変換しない
+			// 上記以外の関数は変換しない
 			r = expr
 		}
 
@@ -507,6 +696,13 @@ func convCallExpr(expr *ast.CallExpr) (r ast.Expr) {
 	return
 }
 
+// convMethods は型変換の組み込み関数と変換後のメソッド名の対応
+var convMethods = map[string]string{
+	"ToNum": "ToReal",
+	"ToInt": "ToInt",
+	"IsInt": "IsInt",
+}
+
 // convBasicLit は基本リテラルを変換する関数
 func convBasicLit(expr *ast.BasicLit) (r ast.Expr) {
 	//fmt.Println("convBasicLit: expr=", expr)
@@ -525,15 +721,7 @@ func convBasicLit(expr *ast.BasicLit) (r ast.Expr) {
 			},
 		}
 	case token.FLOAT:
-		r = &ast.CallExpr{
-			Fun: ast.NewIdent("NumVal"),
-			Args: []ast.Expr{
-				&ast.BasicLit{
-					Kind:  token.STRING,
-					Value: "\"" + expr.Value + "\"",
-				},
-			},
-		}
+		r = makeNumVal(expr.Value, expr.Pos())
 	default:
 		// 上記以外は変換しない
 		r = expr
@@ -542,6 +730,20 @@ func convBasicLit(expr *ast.BasicLit) (r ast.Expr) {
 	return
 }
 
+// makeNumVal は数値の文字列から NumVal 関数呼び出しの AST を生成する関数
+func makeNumVal(value string, pos token.Pos) ast.Expr {
+	return &ast.CallExpr{
+		Fun: ast.NewIdent("NumVal"),
+		Args: []ast.Expr{
+			&ast.BasicLit{
+				ValuePos: pos,
+				Kind:     token.STRING,
+				Value:    "\"" + value + "\"",
+			},
+		},
+	}
+}
+
 // convIdent は識別子を変換する関数。識別子のうち真理値（true or false）が該当。
 func convIdent(expr *ast.Ident) (r ast.Expr) {
 	// Before: true
@@ -590,14 +792,14 @@ func isAssert(expr ast.Expr) bool {
 	return false
 }
 
-// isSolve は式が Solve 関数かどうかをチェックする関数
+// isSolve は式が Solve 関数または SolveAll 関数かどうかをチェックする関数
 func isSolve(expr ast.Expr) bool {
 	//fmt.Println("# isSolve")
 	ce, ok := expr.(*ast.CallExpr)
 	if ok {
 		// identifier (args) の形の関数呼び出しか
 		ident, ok := ce.Fun.(*ast.Ident)
-		if ok && ident.Name == "Solve" {
+		if ok && (ident.Name == "Solve" || ident.Name == "SolveAll") {
 			// 引数はすべて Ident か？
 			for _, arg := range ce.Args {
 				_, ok := arg.(*ast.Ident)
@@ -611,6 +813,123 @@ func isSolve(expr ast.Expr) bool {
 	return false
 }
 
+// nameCalls は第一引数に制約変数の名前をとる関数
+var nameCalls = map[string]bool{
+	"SolveGrid": true,
+	"Display":   true,
+}
+
+// isNameCall は式が第一引数に制約変数の名前をとる関数の呼び出しかどうかをチェックする関数
+func isNameCall(expr ast.Expr) bool {
+	ce, ok := expr.(*ast.CallExpr)
+	if ok {
+		// identifier (args) の形の関数呼び出しで、第一引数は Ident か？
+		ident, ok := ce.Fun.(*ast.Ident)
+		if ok && nameCalls[ident.Name] && len(ce.Args) > 0 {
+			_, ok := ce.Args[0].(*ast.Ident)
+			return ok
+		}
+	}
+	return false
+}
+
+// isObjective は式が Minimize 関数または Maximize 関数かどうかをチェックする関数
+func isObjective(expr ast.Expr) bool {
+	ce, ok := expr.(*ast.CallExpr)
+	if ok {
+		// identifier (args) の形の関数呼び出しで、引数の数は一つか？
+		ident, ok := ce.Fun.(*ast.Ident)
+		if ok && (ident.Name == "Minimize" || ident.Name == "Maximize") && len(ce.Args) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// convTermCalls は node に含まれる、項を引数にとる関数の呼び出しの引数を変換する関数。
+// CheckAssuming、Value、IntValue などは if IntValue(x) > 3 { のように式の中で使うので、
+// ステートメントの中の呼び出しをすべて探す。Sat と Unsat は引数がないので変換しない。
+func convTermCalls(node ast.Node) {
+	if node == nil {
+		return
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		ce, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		ident, ok := ce.Fun.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		switch ident.Name {
+		case "CheckAssuming":
+			// 引数を変換し、ソートを検査
+			for i, arg := range ce.Args {
+				ce.Args[i] = checkAssumptionSort(convExpr(arg))
+			}
+		case "Show":
+			// Before: Show(x + y)
+			// After:  Show(x.Add(y).Label("x + y"))
+			for i, arg := range ce.Args {
+				// 名前は変換する前の式から作る
+				text := exprText(arg)
+				expr, _ := inferSort(convExpr(arg))
+				ce.Args[i] = makeLabel(expr, text)
+			}
+		case "IntValue", "BoolValue", "NumValue":
+			// Before: IntValue(x + 1)
+			// After:  IntValue(x.Add(IntVal(1)))
+			for i, arg := range ce.Args {
+				ce.Args[i], _ = inferSort(convExpr(arg))
+			}
+		case "Value":
+			// Value は値の型の名前でもあるので、関数は Eval とする
+			// Before: Value(x + y)
+			// After:  Eval(x.Add(y))
+			if len(ce.Args) != 1 {
+				sortError(ce.Pos(), "Value needs one expression")
+				return false
+			}
+			ident.Name = "Eval"
+			ce.Args[0], _ = inferSort(convExpr(ce.Args[0]))
+		default:
+			return true
+		}
+		return false
+	})
+}
+
+// exprText は変換前の式を DSL の表記の文字列にする関数。
+// 入力の式の部分をそのまま使い、複数行にわたる式は一行にまとめる。
+// 入力に位置のない式は go/printer で文字列にする。
+func exprText(expr ast.Expr) string {
+	if srcFile != nil && expr.Pos().IsValid() && expr.End().IsValid() {
+		lines := strings.Split(srcText[srcFile.Offset(expr.Pos()):srcFile.Offset(expr.End())], "\n")
+		for i := range lines {
+			lines[i] = strings.TrimSpace(lines[i])
+		}
+		return strings.Join(lines, " ")
+	}
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, token.NewFileSet(), expr); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// makeLabel は Show で表示する名前 text を設定する expr.Label(text) の式を作成する関数
+func makeLabel(expr ast.Expr, text string) ast.Expr {
+	return &ast.CallExpr{
+		Fun: &ast.SelectorExpr{X: expr, Sel: ast.NewIdent("Label")},
+		Args: []ast.Expr{&ast.BasicLit{
+			ValuePos: expr.Pos(),
+			Kind:     token.STRING,
+			Value:    strconv.Quote(text),
+		}},
+	}
+}
+
 // pickupMainStmts は main 関数のステートメントリストを取得する関数
 func pickupMainStmts(fileNode *ast.File) (stmts []ast.Stmt) {
 	// ファイルノードのトップレベルの「宣言」の中から main 関数を
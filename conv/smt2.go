@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"math/big"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bunji2/practiceofdsl/smt"
+	"github.com/bunji2/practiceofdsl/smt/smtlib"
+)
+
+// runSMT2 は SMT-LIB2 のファイルを同等の DSL のテキストに変換して表示する関数
+func runSMT2(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage %s smt2 src.smt2\n", os.Args[0])
+		return 1
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer f.Close()
+
+	// 制約変数を宣言するだけで問題は解決しないのでバックエンドは使わない
+	s, err := smtlib.Parse(smt.NewContext(nil), f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 3
+	}
+
+	p := newDSLPrinter(s.Vars)
+	fmt.Print(p.script(args[0], s))
+	return 0
+}
+
+// termMethods は項の演算子と DSL から変換されるメソッド名の対応
+var termMethods = map[smt.Op]string{
+	smt.OpAdd: "Add", smt.OpSub: "Sub", smt.OpMul: "Mul", smt.OpDiv: "Div", smt.OpMod: "Mod",
+	smt.OpPow: "Pow", smt.OpNeg: "Neg", smt.OpEq: "Eq", smt.OpDistinct: "Distinct",
+	smt.OpLt: "Lt", smt.OpLe: "Le", smt.OpGt: "Gt", smt.OpGe: "Ge",
+	smt.OpNot: "Not", smt.OpAnd: "And", smt.OpOr: "Or", smt.OpXor: "Xor",
+	smt.OpImplies: "Implies", smt.OpIff: "Iff", smt.OpIte: "Ite",
+	smt.OpToReal: "ToReal", smt.OpToInt: "ToInt", smt.OpIsInt: "IsInt",
+}
+
+// primaryPrec は括弧の要らない式（識別子や関数呼び出し）の優先順位
+const primaryPrec = token.UnaryPrec + 1
+
+// dslSorts は制約変数のソートと DSL の型名の対応
+var dslSorts = map[string]string{
+	smt.SortInt:  "Int",
+	smt.SortNum:  "Num",
+	smt.SortBool: "Bool",
+}
+
+// arrayName は配列の要素の名前 x[0] にマッチする正規表現
+var arrayName = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\[([0-9]+)\]$`)
+
+// dslPrinter は項を DSL のテキストに変換する構造体型
+type dslPrinter struct {
+	vars    []*smt.Term
+	names   map[string]string // 制約変数名と DSL での表記
+	arrays  map[string]int    // 配列の名前と要素数
+	renamed []string          // 名前の変更の説明
+}
+
+// newDSLPrinter は制約変数の DSL での表記を決めて dslPrinter を生成する関数。
+// x[0], x[1], ... が揃っている場合は配列とし、Go の識別子として使えない名前は変更する。
+func newDSLPrinter(vars []*smt.Term) *dslPrinter {
+	p := &dslPrinter{vars: vars, names: map[string]string{}, arrays: map[string]int{}}
+
+	// 配列の要素を集める
+	declared := map[string]bool{}
+	elems := map[string]map[int]string{}
+	for _, v := range vars {
+		declared[v.Name] = true
+		if m := arrayName.FindStringSubmatch(v.Name); m != nil {
+			i, _ := strconv.Atoi(m[2])
+			if elems[m[1]] == nil {
+				elems[m[1]] = map[int]string{}
+			}
+			elems[m[1]][i] = v.Sort
+		}
+	}
+	for base, es := range elems {
+		if declared[base] || !validIdent(base) {
+			continue
+		}
+		ok := true
+		for i := 0; i < len(es) && ok; i++ {
+			ok = es[i] != "" && es[i] == es[0]
+		}
+		if ok {
+			p.arrays[base] = len(es)
+		}
+	}
+
+	used := map[string]bool{}
+	for base := range p.arrays {
+		used[base] = true
+	}
+	for _, v := range vars {
+		if m := arrayName.FindStringSubmatch(v.Name); m != nil && p.arrays[m[1]] > 0 {
+			p.names[v.Name] = v.Name
+			continue
+		}
+		name := v.Name
+		if !validIdent(name) || used[name] {
+			name = uniqueIdent(v.Name, used)
+			p.renamed = append(p.renamed, fmt.Sprintf("%s → %s", v.Name, name))
+		}
+		used[name] = true
+		p.names[v.Name] = name
+	}
+	return p
+}
+
+// reserved は制約変数の名前に使えない Go と DSL の識別子
+var reserved = map[string]bool{
+	"true": true, "false": true, "Int": true, "Num": true, "Bool": true,
+	"Assert": true, "Solve": true, "SolveAll": true, "SolveGrid": true, "Display": true, "Distinct": true, "Rat": true,
+	"ToNum": true, "ToInt": true, "IsInt": true, "ccc": true,
+	"SetOption": true, "UseTactic": true, "UseLogic": true, "CheckAssuming": true, "Show": true, "Value": true, "Eval": true,
+	"IntValue": true, "BoolValue": true, "NumValue": true, "Sat": true, "Unsat": true,
+}
+
+// validIdent は名前が制約変数の識別子として使えるかどうかを調べる関数
+func validIdent(name string) bool {
+	if name == "" || token.IsKeyword(name) || reserved[name] {
+		return false
+	}
+	return token.IsIdentifier(name)
+}
+
+// uniqueIdent は名前を識別子として使える文字に置き換え、既存の名前と重ならないようにする関数
+func uniqueIdent(name string, used map[string]bool) string {
+	var b strings.Builder
+	for _, c := range name {
+		if c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			b.WriteRune(c)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	id := b.String()
+	if !validIdent(id) {
+		id = "v_" + id
+	}
+	for i := 2; used[id]; i++ {
+		id = fmt.Sprintf("%s_%d", strings.TrimRight(b.String(), "_"), i)
+		if !validIdent(id) {
+			id = "v_" + id
+		}
+	}
+	return id
+}
+
+// script はスクリプト全体を DSL のテキストに変換する関数
+func (p *dslPrinter) script(filename string, s *smtlib.Script) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s から変換した DSL\n", filename)
+	if len(p.renamed) > 0 {
+		fmt.Fprintf(&b, "//\n// 名前の変更:\n")
+		for _, r := range p.renamed {
+			fmt.Fprintf(&b, "//   %s\n", r)
+		}
+	}
+	b.WriteString("\n")
+
+	// 制約変数の宣言。配列は最初の要素の位置で宣言する
+	for _, v := range p.vars {
+		if m := arrayName.FindStringSubmatch(v.Name); m != nil && p.arrays[m[1]] > 0 {
+			if m[2] == "0" {
+				fmt.Fprintf(&b, "var %s [%d]%s\n", m[1], p.arrays[m[1]], dslSorts[v.Sort])
+			}
+			continue
+		}
+		fmt.Fprintf(&b, "var %s %s\n", p.names[v.Name], dslSorts[v.Sort])
+	}
+	b.WriteString("\n")
+
+	stmts := s.Statements
+	for i, st := range stmts {
+		switch st.Name {
+		case "assert":
+			fmt.Fprintf(&b, "Assert(%s)\n", p.expr(st.Term, 0))
+		case "check-sat":
+			// 直後の get-value と合わせて一つの Solve とする
+			if i+1 < len(stmts) && stmts[i+1].Name == "get-value" {
+				continue
+			}
+			b.WriteString("Solve()\n")
+		case "get-value":
+			fmt.Fprintf(&b, "Solve(%s)\n", strings.Join(p.solveArgs(st.Names), ", "))
+		case "get-model":
+			var names []string
+			for _, v := range p.vars {
+				names = append(names, v.Name)
+			}
+			fmt.Fprintf(&b, "Solve(%s)\n", strings.Join(p.solveArgs(names), ", "))
+		}
+	}
+	return b.String()
+}
+
+// solveArgs は Solve の引数を返す関数。
+// Solve の引数は識別子に限られるので、配列の要素は配列の名前とする。
+func (p *dslPrinter) solveArgs(names []string) []string {
+	var args []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		arg := p.names[name]
+		if m := arrayName.FindStringSubmatch(name); m != nil && p.arrays[m[1]] > 0 {
+			arg = m[1]
+		}
+		if !seen[arg] {
+			seen[arg] = true
+			args = append(args, arg)
+		}
+	}
+	return args
+}
+
+// expr は項を優先順位 prec 以上の DSL の式に変換する関数。
+// 優先順位が低い場合は括弧で囲む。
+func (p *dslPrinter) expr(t *smt.Term, prec int) string {
+	s, tp := p.term(t)
+	if tp < prec {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// term は項を DSL の式に変換し、その式の優先順位を返す関数
+func (p *dslPrinter) term(t *smt.Term) (string, int) {
+	switch t.Op {
+	case smt.OpVar:
+		return p.names[t.Name], primaryPrec
+	case smt.OpConst:
+		return constText(t)
+	}
+
+	method := termMethods[t.Op]
+	args := t.Args
+	switch {
+	case t.Op == smt.OpNot && args[0].Op == smt.OpEq && len(args[0].Args) == 2:
+		// Before: (not (= a b))
+		// After:  a != b
+		return p.binary(token.NEQ, args[0].Args)
+	case t.Op == smt.OpToReal && args[0].Op == smt.OpConst:
+		// 整数の定数は小数で表す
+		s, prec := constText(args[0])
+		return s + ".0", prec
+	case t.Op == smt.OpDistinct:
+		return "Distinct(" + p.list(args) + ")", primaryPrec
+	}
+
+	if tok, ok := opTokens[method]; ok {
+		if len(args) == 1 {
+			return tok.String() + p.expr(args[0], token.UnaryPrec), token.UnaryPrec
+		}
+		return p.binary(tok, args)
+	}
+	for fn, m := range convMethods {
+		if m == method {
+			// ToNum(x), ToInt(x), IsInt(x)
+			return fn + "(" + p.list(args) + ")", primaryPrec
+		}
+	}
+	// x.Implies(y), x.Iff(y), c.Ite(x, y), x.Pow(y)
+	return p.expr(args[0], primaryPrec) + "." + method + "(" + p.list(args[1:]) + ")", primaryPrec
+}
+
+// binary は二項演算子の式に変換する関数。左結合なので右側の被演算子は一つ高い優先順位とする。
+func (p *dslPrinter) binary(tok token.Token, args []*smt.Term) (string, int) {
+	prec := tok.Precedence()
+	s := p.expr(args[0], prec)
+	for _, arg := range args[1:] {
+		s += " " + tok.String() + " " + p.expr(arg, prec+1)
+	}
+	return s, prec
+}
+
+// list は項の並びをカンマで区切った DSL の式に変換する関数
+func (p *dslPrinter) list(args []*smt.Term) string {
+	var ss []string
+	for _, arg := range args {
+		ss = append(ss, p.expr(arg, 0))
+	}
+	return strings.Join(ss, ", ")
+}
+
+// constText は定数を DSL のリテラルで表す関数。
+// Num の定数は有限小数で表せれば小数、そうでなければ Rat(p, q) とする。
+func constText(t *smt.Term) (string, int) {
+	switch t.Sort {
+	case smt.SortBool:
+		return strconv.FormatBool(t.Bool), primaryPrec
+	case smt.SortInt:
+		return signed(t.Num.Num().String())
+	}
+	if t.Num.IsInt() {
+		return signed(t.Num.Num().String() + ".0")
+	}
+	for digits := 1; digits <= 20; digits++ {
+		s := t.Num.FloatString(digits)
+		if r, ok := new(big.Rat).SetString(s); ok && r.Cmp(t.Num) == 0 {
+			return signed(s)
+		}
+	}
+	return fmt.Sprintf("Rat(%s, %s)", t.Num.Num(), t.Num.Denom()), primaryPrec
+}
+
+// signed は負の数のリテラルを単項演算子の優先順位とする関数
+func signed(s string) (string, int) {
+	if strings.HasPrefix(s, "-") {
+		return s, token.UnaryPrec
+	}
+	return s, primaryPrec
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// 制約条件の式のソート
+const (
+	sortUnknown = ""     // 変換時には判定できない（Go の変数など）
+	sortInt     = "Int"  // 整数
+	sortNum     = "Num"  // 数値（実数）
+	sortBool    = "Bool" // 真理値
+)
+
+// sortErrors は変換時に検出したソートのエラーの一覧
+var sortErrors []diagnostic
+
+// sortError はソートのエラーを追加する関数
+func sortError(pos token.Pos, format string, args ...interface{}) {
+	sortErrors = append(sortErrors, diagnostic{pos: pos, msg: fmt.Sprintf(format, args...)})
+}
+
+// checkAssertSort は Assert 関数の引数（変換後の式）のソートを検査する関数。
+// Int と Num が混在する箇所は Int 側を Num に昇格させた式を返す。
+func checkAssertSort(expr ast.Expr) ast.Expr {
+	r, s := inferSort(expr)
+	if s != sortUnknown && s != sortBool {
+		sortError(exprPos(expr), "non-Bool expression of sort %s used as Assert condition", s)
+	}
+	return r
+}
+
+// checkAssumptionSort は CheckAssuming 関数の引数（変換後の式）のソートを検査する関数
+func checkAssumptionSort(expr ast.Expr) ast.Expr {
+	r, s := inferSort(expr)
+	if s != sortUnknown && s != sortBool {
+		sortError(exprPos(expr), "non-Bool expression of sort %s used as CheckAssuming assumption", s)
+	}
+	return r
+}
+
+// checkObjectiveSort は Minimize / Maximize 関数の引数（変換後の式）のソートを検査する関数
+func checkObjectiveSort(name string, expr ast.Expr) ast.Expr {
+	r, s := inferSort(expr)
+	if s == sortBool {
+		sortError(exprPos(expr), "Bool expression used as %s objective", name)
+	}
+	return r
+}
+
+// inferSort は変換後の式のソートを推論する関数。
+// 昇格が必要な箇所を書き換えた式とそのソートを返す。
+func inferSort(expr ast.Expr) (ast.Expr, string) {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return inferSort(e.X)
+
+	case *ast.Ident: // x
+		if v, ok := constraintVars[e.Name]; ok && v.size == 0 {
+			return e, v.sort
+		}
+
+	case *ast.IndexExpr: // x[i]
+		if ident, ok := e.X.(*ast.Ident); ok {
+			if v, ok := constraintVars[ident.Name]; ok && v.size > 0 {
+				return e, v.sort
+			}
+		}
+
+	case *ast.CallExpr:
+		switch fun := e.Fun.(type) {
+		case *ast.Ident:
+			switch fun.Name {
+			case "IntVal":
+				return e, sortInt
+			case "NumVal", "Rat":
+				return e, sortNum
+			case "True", "False":
+				return e, sortBool
+			}
+		case *ast.SelectorExpr:
+			return inferOpSort(e, fun)
+		}
+	}
+	return expr, sortUnknown
+}
+
+// inferOpSort は演算子のメソッド呼び出し x.Op(args...) のソートを推論する関数
+func inferOpSort(e *ast.CallExpr, se *ast.SelectorExpr) (ast.Expr, string) {
+	op := se.Sel.Name
+
+	// レシーバと引数を一つの列として扱う
+	operands := append([]ast.Expr{se.X}, e.Args...)
+	sorts := make([]string, len(operands))
+	for i, operand := range operands {
+		operands[i], sorts[i] = inferSort(operand)
+	}
+	pos := se.Sel.Pos()
+	if !pos.IsValid() {
+		pos = exprPos(e)
+	}
+	sym := opSymbols[op]
+	if sym == "" {
+		sym = op
+	}
+
+	result := sortUnknown
+	switch op {
+	case "Add", "Sub", "Mul", "Div", "Pow", "Neg":
+		if checkOperands(pos, sym, sorts, sortInt, sortNum) {
+			result = promoteOperands(operands, sorts)
+		}
+	case "Mod":
+		if checkOperands(pos, sym, sorts, sortInt) {
+			result = joinSorts(sorts)
+		}
+	case "Gt", "Ge", "Lt", "Le":
+		if checkOperands(pos, sym, sorts, sortInt, sortNum) {
+			promoteOperands(operands, sorts)
+		}
+		result = sortBool
+	case "Eq", "Distinct":
+		if checkSameClass(pos, sym, sorts) {
+			promoteOperands(operands, sorts)
+		}
+		result = sortBool
+	case "And", "Or", "Xor", "Implies", "Iff", "Not":
+		checkOperands(pos, sym, sorts, sortBool)
+		result = sortBool
+	case "Ite":
+		if len(operands) != 3 {
+			break
+		}
+		checkOperands(pos, sym, sorts[:1], sortBool)
+		if checkSameClass(pos, sym, sorts[1:]) {
+			result = promoteOperands(operands[1:], sorts[1:])
+		}
+	case "ToReal": // ToNum(x)
+		if !checkOperands(pos, "ToNum", sorts, sortInt, sortNum) {
+			break
+		}
+		if sorts[0] == sortNum {
+			// Num から Num への変換は不要
+			return operands[0], sortNum
+		}
+		result = sortNum
+	case "ToInt": // ToInt(x)
+		if !checkOperands(pos, op, sorts, sortInt, sortNum) {
+			break
+		}
+		if sorts[0] == sortInt {
+			// Int から Int への変換は不要
+			return operands[0], sortInt
+		}
+		result = sortInt
+	case "IsInt": // IsInt(x)
+		if checkOperands(pos, op, sorts, sortInt, sortNum) && sorts[0] == sortInt {
+			// Z3 の is_int は Real のみを受け付けるので昇格させる
+			operands[0] = promote(operands[0])
+		}
+		result = sortBool
+	default:
+		// 上記以外のメソッドは検査しない
+		return e, sortUnknown
+	}
+
+	se.X, e.Args = operands[0], operands[1:]
+	return e, result
+}
+
+// checkOperands は判定できたソートがすべて許可されたソートかどうかを検査する関数
+func checkOperands(pos token.Pos, sym string, sorts []string, allowed ...string) bool {
+	for _, s := range sorts {
+		if s == sortUnknown {
+			continue
+		}
+		ok := false
+		for _, a := range allowed {
+			if s == a {
+				ok = true
+			}
+		}
+		if !ok {
+			sortError(pos, "invalid operation: operator %s not defined on %s", sym, s)
+			return false
+		}
+	}
+	return true
+}
+
+// checkSameClass は Bool と数値（Int, Num）が混在していないかを検査する関数
+func checkSameClass(pos token.Pos, sym string, sorts []string) bool {
+	first := sortUnknown
+	for _, s := range sorts {
+		if s == sortUnknown {
+			continue
+		}
+		if first == sortUnknown {
+			first = s
+			continue
+		}
+		if (first == sortBool) != (s == sortBool) {
+			sortError(pos, "invalid operation: mismatched sorts %s and %s in %s", first, s, sym)
+			return false
+		}
+	}
+	return true
+}
+
+// joinSorts は演算結果のソートを求める関数。判定できないソートを含む場合は不明とする。
+func joinSorts(sorts []string) string {
+	result := sortUnknown
+	for _, s := range sorts {
+		switch {
+		case s == sortUnknown:
+			return sortUnknown
+		case result == sortUnknown || s == sortNum:
+			result = s
+		}
+	}
+	return result
+}
+
+// promoteOperands は Int と Num が混在する場合に Int の被演算子を Num に昇格させる関数。
+// 演算結果のソートを返す。
+func promoteOperands(operands []ast.Expr, sorts []string) string {
+	hasNum := false
+	for _, s := range sorts {
+		if s == sortNum {
+			hasNum = true
+		}
+	}
+	if hasNum {
+		for i, s := range sorts {
+			if s == sortInt {
+				operands[i] = promote(operands[i])
+				sorts[i] = sortNum
+			}
+		}
+	}
+	result := joinSorts(sorts)
+	if result != sortUnknown || !(hasNum || numDeclared()) {
+		return result
+	}
+
+	// ソートを判定できない被演算子がある場合は実行時に昇格させる
+	// Before: x.Add(y)
+	// After:  Promote(x, y).Add(Promote(y, x))
+	orig := append([]ast.Expr{}, operands...)
+	for i, s := range sorts {
+		if s == sortNum || (hasNum && s != sortUnknown) {
+			continue
+		}
+		args := []ast.Expr{orig[i]}
+		for j := range orig {
+			if j != i {
+				args = append(args, orig[j])
+			}
+		}
+		operands[i] = &ast.CallExpr{
+			Fun:  ast.NewIdent("Promote"),
+			Args: args,
+		}
+	}
+	if hasNum {
+		// Num を含む演算の結果は Num となる
+		return sortNum
+	}
+	return result
+}
+
+// numDeclared は Num の制約変数が宣言されているかどうかを調べる関数
+func numDeclared() bool {
+	for _, v := range constraintVars {
+		if v.sort == sortNum {
+			return true
+		}
+	}
+	return false
+}
+
+// promote は Int の式を Num に昇格させる式を生成する関数
+func promote(expr ast.Expr) ast.Expr {
+	// Before: IntVal(3)
+	// After:  NumVal("3")
+	if ce, ok := expr.(*ast.CallExpr); ok && isIdent(ce.Fun, "IntVal") && len(ce.Args) == 1 {
+		if lit, ok := ce.Args[0].(*ast.BasicLit); ok && lit.Kind == token.INT && isDecimal(lit.Value) {
+			return convBasicLit(&ast.BasicLit{
+				ValuePos: lit.ValuePos,
+				Kind:     token.FLOAT,
+				Value:    lit.Value,
+			})
+		}
+	}
+
+	// Before: expr
+	// After:  expr.ToReal()
+	return &ast.CallExpr{
+		Fun: &ast.SelectorExpr{
+			X:   expr,
+			Sel: ast.NewIdent("ToReal"),
+		},
+	}
+}
+
+// isDecimal は整数リテラルが 10 進表記かどうかを調べる関数
+func isDecimal(s string) bool {
+	if len(s) > 1 && s[0] == '0' {
+		// 0x10, 0o17, 017 など
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
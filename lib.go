@@ -1,136 +1,138 @@
 package main
 
+//go:generate go run ./bindgen -o lib2.go
+
 import (
+	"flag"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+
+	"github.com/bunji2/practiceofdsl/smt"
+	_ "github.com/bunji2/practiceofdsl/smt/fd"
+	_ "github.com/bunji2/practiceofdsl/smt/lp"
+	_ "github.com/bunji2/practiceofdsl/smt/mzn"
+	_ "github.com/bunji2/practiceofdsl/smt/sat"
+	"github.com/bunji2/practiceofdsl/smt/smtlib"
+	_ "github.com/bunji2/practiceofdsl/smt/z3"
+)
 
-	"github.com/mitchellh/go-z3"
+// コマンドライン引数
+var (
+	numFormatFlag = flag.String("num", smt.NumFormatZ3, "output format of Num values: z3, frac, dec or both")
+	digitsFlag    = flag.Int("digits", 10, "number of decimal places for -num dec and both")
+	backendFlag   = flag.String("backend", "z3", "solver backend: "+strings.Join(smt.Backends(), ", "))
+	solverFlag    = flag.String("solver", smtlib.Command, "solver command line for -backend smtlib")
+	exportFlag    = flag.String("export", "", "write the problem at Solve instead of solving it: "+strings.Join(smt.Exporters(), ", "))
+	outputFlag    = flag.String("o", "", "output file for -export (default: standard output)")
+	formatFlag    = flag.String("format", smt.OutputText, "output format of Solve and SolveAll: text, json or csv")
+	svgFlag       = flag.String("svg", "", "also render array solutions as boards into this SVG file")
+	timeoutFlag   = flag.Int("timeout", 0, "time limit of each Solve and SolveAll in milliseconds (0: no limit)")
+	verboseFlag   = flag.Bool("v", false, "print details such as the detected logic to standard error")
+	statsFlag     = flag.Bool("stats", false, "print statistics such as the number of variables and check time to standard error at the end")
 )
 
-// Context は z3 のコンテクストとソルバーを保持する構造体型
-type Context struct {
-	ctx    *z3.Context
-	solver *z3.Solver
-	vars   map[string]bool
-}
+// exitInterrupted は Ctrl-C で中断したときの終了コード（128 + SIGINT）
+const exitInterrupted = 130
 
-// NewContext は新しいコンテクストを生成する関数
-func NewContext() Context {
-	// コンテクストの作成
-	config := z3.NewConfig()
-	ctx := z3.NewContext(config)
-	config.Close()
-	return Context{
-		ctx:    ctx,
-		solver: ctx.NewSolver(),
-		vars:   map[string]bool{},
+// NewContext はコマンドライン引数を反映した新しいコンテクストを生成する関数
+func NewContext() *smt.Context {
+	if !flag.Parsed() {
+		flag.Parse()
 	}
-}
 
-// Close はコンテクストをクローズする関数
-func (c Context) Close() {
-	if c.solver != nil {
-		c.solver.Close()
+	if *exportFlag != "" {
+		return newExportContext()
 	}
-	if c.ctx != nil {
-		c.ctx.Close()
-	}
-}
-
-// BoolVar はブール型の制約変数のASTノードを作成する関数
-func (c Context) BoolVar(name string) *z3.AST {
-	c.vars[name] = true
-	return c.ctx.Const(c.ctx.Symbol(name), c.ctx.BoolSort())
-}
-
-// IntVar は整数型の制約変数のASTノードを作成する関数
-func (c Context) IntVar(name string) *z3.AST {
-	c.vars[name] = true
-	return c.ctx.Const(c.ctx.Symbol(name), c.ctx.IntSort())
-}
-
-// IntVal は整数値のASTノードを作成する関数
-func (c Context) IntVal(value int) *z3.AST {
-	return c.ctx.Int(value, c.ctx.IntSort())
-}
-
-// NumVar は数値型の制約変数のASTノードを作成する関数
-func (c Context) NumVar(name string) *z3.AST {
-	c.vars[name] = true
-	return c.ctx.Const(c.ctx.Symbol(name), c.ctx.RealSort())
-}
-
-// NumVal は数値のASTノードを作成する関数
-func (c Context) NumVal(value string) *z3.AST {
-	return c.ctx.Num(value, c.ctx.RealSort())
-}
-
-/*
-// NewVar は指定されたソートの制約変数のASTノードを作成する関数
-func (c Context) NewVar(name string, idx int, sort *z3.Sort) *z3.AST {
-
-	c.vars[name] = idx+1
-	return c.ctx.Const(c.ctx.Symbol(name), sort)
-}
-*/
 
-/*
-// FloatVar は浮動小数点型の制約変数のASTノードを作成する関数
-func (c Context) FloatVar(name string) *z3.AST {
-	return c.ctx.Const(c.ctx.Symbol(name), c.ctx.FloatSort())
-}
-
-// FloatVal は浮動小数点のASTノードを作成する関数
-func (c Context) FloatVal(value float64) *z3.AST {
-	return c.ctx.Float(value, c.ctx.FloatSort())
+	smtlib.Command = *solverFlag
+	c, err := smt.Open(*backendFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	c.SetNumFormat(*numFormatFlag, *digitsFlag)
+	if err := c.SetOutputFormat(*formatFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	c.SetSVG(*svgFlag)
+	c.SetTimeout(*timeoutFlag)
+	c.SetVerbose(*verboseFlag)
+	c.SetPrintStats(*statsFlag)
+	handleInterrupt(c)
+	return c
 }
-*/
 
-// Assert は制約条件を宣言する関数
-func (c Context) Assert(cond *z3.AST) {
-	c.solver.Assert(cond)
+// handleInterrupt は Ctrl-C で実行中の Solve を中断するシグナルハンドラを登録する関数。
+// 中断したら "interrupted" とそれまでの統計情報を表示し、
+// コンテクストをクローズして終了コード exitInterrupted で終了する。
+// もう一度 Ctrl-C を押すと、中断を待たずに終了する。
+func handleInterrupt(c *smt.Context) {
+	// 中断された Solve から戻った main とシグナルハンドラのどちらか先に呼び出した方が終了する
+	var once sync.Once
+	exit := func() {
+		once.Do(func() {
+			fmt.Fprintln(os.Stderr, "interrupted")
+			if !*statsFlag {
+				// -stats の場合は Close が表示する
+				c.Stats()
+			}
+			c.Close()
+			os.Exit(exitInterrupted)
+		})
+	}
+	c.OnInterrupt(exit)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		signal.Reset(os.Interrupt)
+		c.Interrupt()
+		exit()
+	}()
 }
 
-// Solve は制約を解決する変数の値を表示する関数
-func (c Context) Solve(names ...string) {
-	// 解決可能かどうかを調べる
-	if v := c.solver.Check(); v != z3.True {
-		fmt.Println("unsolvable")
-		return
+// newExportContext は Solve で問題を書き出すコンテクストを生成する関数。
+// 問題を解決しないのでバックエンドは使わない。
+// 書き出しに失敗したら（エラーは Solve が表示する）コンテクストをクローズして終了コード 1 で終了する。
+func newExportContext() *smt.Context {
+	var w io.Writer = os.Stdout
+	if *outputFlag != "" {
+		w = &lazyFile{name: *outputFlag}
 	}
 
-	// 制約を満たす値の取得
-	m := c.solver.Model()
-	values := m.Assignments()
-	m.Close()
-
-	// 可変引数で指定された変数名の値を表示
-	for _, name := range names {
-		//fmt.Println("name =", name)
-		if c.vars[name] {
-			fmt.Printf("%s = %s\n", name, values[name].String())
-		} else {
-			// 配列の可能性
-			i := 0
-			for {
-				idxName := fmt.Sprintf("%s[%d]", name, i)
-				if c.vars[idxName] {
-					fmt.Printf("%s = %s\n", idxName, values[idxName].String())
-				} else {
-					break
-				}
-				i++
-			}
-		}
-		//fmt.Printf("%s = %s.\n", name, values[name].FString2())
+	c := smt.NewContext(nil)
+	if err := c.SetExport(*exportFlag, w); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
+	c.OnExportError(func(error) {
+		c.Close()
+		os.Exit(1)
+	})
+	return c
 }
 
-// True は True 値のASTノードを作成する関数
-func (c Context) True() *z3.AST {
-	return c.ctx.True()
+// lazyFile は最初に書き込むときに作成するファイル。
+// 書き出しに失敗した場合に -o のファイルを空にしたり、空のファイルを残したりしない。
+type lazyFile struct {
+	name string
+	f    *os.File
 }
 
-// False は False 値のASTノードを作成する関数
-func (c Context) False() *z3.AST {
-	return c.ctx.False()
+// Write はファイルに書き込む関数。最初の書き込みでファイルを作成する
+func (lf *lazyFile) Write(p []byte) (int, error) {
+	if lf.f == nil {
+		f, err := os.Create(lf.name)
+		if err != nil {
+			return 0, err
+		}
+		lf.f = f
+	}
+	return lf.f.Write(p)
 }
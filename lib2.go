@@ -1,65 +1,431 @@
-package main
-
-import (
-	"github.com/mitchellh/go-z3"
-)
-
-// グローバル変数
-var ccc Context
-
-// IntVar は整数型の制約変数を作成する関数
-func IntVar(name string) *z3.AST {
-	return ccc.IntVar(name)
-}
-
-// IntVal は整数値を作成する関数
-func IntVal(value int) *z3.AST {
-	return ccc.IntVal(value)
-}
-
-// BoolVar はブール型の制約変数を作成する関数
-func BoolVar(name string) *z3.AST {
-	return ccc.BoolVar(name)
-}
-
-// NumVar は数値型の制約変数を作成する関数
-func NumVar(name string) *z3.AST {
-	return ccc.NumVar(name)
-}
-
-// NumVal は数値のASTノードを作成する関数
-func NumVal(value string) *z3.AST {
-	return ccc.NumVal(value)
-}
-
-/*
-// FloatVar は浮動小数点型の制約変数を作成する関数
-func FloatVar(name string) *z3.AST {
-	return ccc.FloatVar(name)
-}
-
-// FloatVal は整数値を作成する関数
-func FloatVal(value float64) *z3.AST {
-	return ccc.FloatVal(value)
-}
-*/
-
-// Assert は制約条件を宣言する関数
-func Assert(cond *z3.AST) {
-	ccc.Assert(cond)
-}
-
-// Solve は制約を解決する変数の値を表示する関数
-func Solve(names ...string) {
-	ccc.Solve(names...)
-}
-
-// True は True 値のASTノードを作成する関数
-func True() *z3.AST {
-	return ccc.True()
-}
-
-// False は False 値のASTノードを作成する関数
-func False() *z3.AST {
-	return ccc.False()
-}
+// Code generated by bindgen from package smt; DO NOT EDIT.
+
+package main
+
+import (
+	"context"
+	"github.com/bunji2/practiceofdsl/smt"
+	"io"
+)
+
+// ccc は DSL の制約条件を保持するコンテクスト
+var ccc *smt.Context
+
+// Assumer は smt.Assumer の別名
+type Assumer = smt.Assumer
+
+// Backend は smt.Backend の別名
+type Backend = smt.Backend
+
+// BackendFactory は smt.BackendFactory の別名
+type BackendFactory = smt.BackendFactory
+
+// Configurer は smt.Configurer の別名
+type Configurer = smt.Configurer
+
+// Option は smt.Option の別名
+type Option = smt.Option
+
+// Context は smt.Context の別名
+type Context = smt.Context
+
+// Evaluator は smt.Evaluator の別名
+type Evaluator = smt.Evaluator
+
+// Problem は smt.Problem の別名
+type Problem = smt.Problem
+
+// Exporter は smt.Exporter の別名
+type Exporter = smt.Exporter
+
+// LogicSelector は smt.LogicSelector の別名
+type LogicSelector = smt.LogicSelector
+
+// Objective は smt.Objective の別名
+type Objective = smt.Objective
+
+// Optimizer は smt.Optimizer の別名
+type Optimizer = smt.Optimizer
+
+// Status は smt.Status の別名
+type Status = smt.Status
+
+// Value は smt.Value の別名
+type Value = smt.Value
+
+// Result は smt.Result の別名
+type Result = smt.Result
+
+// Stat は smt.Stat の別名
+type Stat = smt.Stat
+
+// Statistician は smt.Statistician の別名
+type Statistician = smt.Statistician
+
+// Op は smt.Op の別名
+type Op = smt.Op
+
+// Term は smt.Term の別名
+type Term = smt.Term
+
+// Interrupter は smt.Interrupter の別名
+type Interrupter = smt.Interrupter
+
+// TimeoutSetter は smt.TimeoutSetter の別名
+type TimeoutSetter = smt.TimeoutSetter
+
+// UnknownReasoner は smt.UnknownReasoner の別名
+type UnknownReasoner = smt.UnknownReasoner
+
+// smt パッケージの定数
+const (
+	SenseMin      = smt.SenseMin
+	SenseMax      = smt.SenseMax
+	OutputText    = smt.OutputText
+	OutputJSON    = smt.OutputJSON
+	OutputCSV     = smt.OutputCSV
+	StatusUnknown = smt.StatusUnknown
+	StatusSat     = smt.StatusSat
+	StatusUnsat   = smt.StatusUnsat
+	SortInt       = smt.SortInt
+	SortNum       = smt.SortNum
+	SortBool      = smt.SortBool
+	NumFormatZ3   = smt.NumFormatZ3
+	NumFormatFrac = smt.NumFormatFrac
+	NumFormatDec  = smt.NumFormatDec
+	NumFormatBoth = smt.NumFormatBoth
+	OpVar         = smt.OpVar
+	OpConst       = smt.OpConst
+	OpAdd         = smt.OpAdd
+	OpSub         = smt.OpSub
+	OpMul         = smt.OpMul
+	OpDiv         = smt.OpDiv
+	OpMod         = smt.OpMod
+	OpPow         = smt.OpPow
+	OpNeg         = smt.OpNeg
+	OpEq          = smt.OpEq
+	OpDistinct    = smt.OpDistinct
+	OpLt          = smt.OpLt
+	OpLe          = smt.OpLe
+	OpGt          = smt.OpGt
+	OpGe          = smt.OpGe
+	OpNot         = smt.OpNot
+	OpAnd         = smt.OpAnd
+	OpOr          = smt.OpOr
+	OpXor         = smt.OpXor
+	OpImplies     = smt.OpImplies
+	OpIff         = smt.OpIff
+	OpIte         = smt.OpIte
+	OpToReal      = smt.OpToReal
+	OpToInt       = smt.OpToInt
+	OpIsInt       = smt.OpIsInt
+)
+
+// IntArrayVar は与えられた名前群の整数型制約変数のリストを作成する関数
+func IntArrayVar(name string, num int) (r []*smt.Term) {
+	return ccc.IntArrayVar(name, num)
+}
+
+// BoolArrayVar は与えられた名前群のブール型制約変数のリストを作成する関数
+func BoolArrayVar(name string, num int) (r []*smt.Term) {
+	return ccc.BoolArrayVar(name, num)
+}
+
+// NumArrayVar は与えられた名前群の数値型制約変数のリストを作成する関数
+func NumArrayVar(name string, num int) (r []*smt.Term) {
+	return ccc.NumArrayVar(name, num)
+}
+
+// CheckAssuming は lits の制約条件を一時的に仮定して、制約が解決可能かどうかを調べる関数。
+// Assert と違って仮定はこの Check の間だけ有効なので、一つの Context で
+// 仮定を変えながら何度も問い合わせることができる。解決可能な場合は Model で値を取得できる。
+// SetTimeout の時間制限を適用する。
+func CheckAssuming(lits ...*smt.Term) (smt.Status, error) {
+	return ccc.CheckAssuming(lits...)
+}
+
+// SetOption はソルバーのオプションを設定する関数。
+// SetOption("smt.random_seed", "7") のように、値は文字列で指定する。
+// 最初の Assert の前に呼び出すこと（DSL では conv がプログラムの先頭に移動する）。
+func SetOption(name, value string) {
+	ccc.SetOption(name, value)
+}
+
+// UseTactic は names のタクティク（"simplify"、"qfnra-nlsat" など）を順に適用するソルバーを使うように設定する関数。
+// UseLogic と両方を指定した場合は UseTactic を優先する。最初の Assert の前に呼び出すこと。
+func UseTactic(names ...string) {
+	ccc.UseTactic(names...)
+}
+
+// UseLogic は SMT-LIB のロジック（"QF_LIA"、"QF_NRA" など）用のソルバーを使うように設定する関数。
+// 最初の Assert の前に呼び出すこと。
+func UseLogic(logic string) {
+	ccc.UseLogic(logic)
+}
+
+// SetNumFormat は Solve で表示する数値の形式を設定する関数。
+// kind は NumFormatZ3, NumFormatFrac, NumFormatDec, NumFormatBoth のいずれか。
+// digits は小数で表示する場合の小数点以下の桁数。
+func SetNumFormat(kind string, digits int) {
+	ccc.SetNumFormat(kind, digits)
+}
+
+// BoolVar はブール型の制約変数の項を作成する関数
+func BoolVar(name string) *smt.Term {
+	return ccc.BoolVar(name)
+}
+
+// IntVar は整数型の制約変数の項を作成する関数
+func IntVar(name string) *smt.Term {
+	return ccc.IntVar(name)
+}
+
+// IntVal は整数値の項を作成する関数
+func IntVal(value int) *smt.Term {
+	return ccc.IntVal(value)
+}
+
+// NumVar は数値型の制約変数の項を作成する関数
+func NumVar(name string) *smt.Term {
+	return ccc.NumVar(name)
+}
+
+// NumVal は数値の項を作成する関数。"1/3" のような分数も指定できる。
+func NumVal(value string) *smt.Term {
+	return ccc.NumVal(value)
+}
+
+// Rat は分数 num/den の数値の項を作成する関数
+func Rat(num, den int) *smt.Term {
+	return ccc.Rat(num, den)
+}
+
+// Promote は整数の項を、他のいずれかが数値の場合に数値へ昇格させる関数
+func Promote(a *smt.Term, others ...*smt.Term) *smt.Term {
+	return ccc.Promote(a, others...)
+}
+
+// Assert は制約条件を宣言する関数
+func Assert(cond *smt.Term) {
+	ccc.Assert(cond)
+}
+
+// Check は制約が解決可能かどうかを調べる関数
+func Check() (smt.Status, error) {
+	return ccc.Check()
+}
+
+// Model は制約を解決し、制約を満たす値を返す関数。
+// 直前の Check または CheckAssuming が解決可能で、その後に制約条件を追加していない場合は、
+// 解決し直さずにその解を返す。解決可能でない場合はエラーを返す。
+func Model() (*smt.Result, error) {
+	return ccc.Model()
+}
+
+// Solve は制約を解決する変数の値を表示する関数
+func Solve(names ...string) {
+	ccc.Solve(names...)
+}
+
+// SolveAll は制約を満たすすべての解を列挙して表示する関数。
+// 解を見つけるたびに、names の変数（省略した場合はすべての制約変数）の値が
+// その解と異なるという制約条件を追加して解決し直す。
+// バックエンドが Assumer を実装していれば、この制約条件は列挙のための制約変数を仮定したときだけ有効になるので、
+// 列挙の後の Solve は列挙の前と同じ問題を解決する。実装していなければ制約条件は Assert したものとして残り、
+// その後の Solve は見つけた解を除いて解決する。
+func SolveAll(names ...string) {
+	ccc.SolveAll(names...)
+}
+
+// True は True 値の項を作成する関数
+func True() *smt.Term {
+	return ccc.True()
+}
+
+// False は False 値の項を作成する関数
+func False() *smt.Term {
+	return ccc.False()
+}
+
+// Display は配列 name の制約変数を Solve で表形式で表示するように設定する関数。
+// spec は空白で区切った次の設定の並び。
+//
+//	cols=9              一行の列数（既定は配列の長さで、一行で表示する）
+//	box=3x3             3行ごと、3列ごとに区切りを入れる
+//	glyph=1:Q,0:.       値 1 を Q、0 を . で表示する（Bool は true:Q,false:.）
+//	positions           x[i] を i 行目のマスの位置とみなし、盤面で表示する（8クイーンなど）
+//
+// positions では、マスに置かれている場合を値 true、置かれていない場合を false として glyph を適用する。
+func Display(name string, spec string) {
+	ccc.Display(name, spec)
+}
+
+// SolveGrid は制約を解決し、配列 name の値を一行 cols 列の表で表示する関数。
+// Display で設定した区切りと記号も使う。
+func SolveGrid(name string, cols int) {
+	ccc.SolveGrid(name, cols)
+}
+
+// Eval は直前の解のもとで項 t の値を求める関数。
+// 解は直前に解決可能だった Solve、Model、Check、CheckAssuming のもので、
+// その後に Assert した場合も次の Check まで保持する。解に現れない制約変数は既定値で補完する。
+// バックエンドが Evaluator を実装していればそれを使い、実装していなければ解の値から計算する。
+// DSL の Value(expr) は conv が Eval に変換する。
+func Eval(t *smt.Term) (smt.Value, error) {
+	return ccc.Eval(t)
+}
+
+// Show は直前の解のもとで項の値を name = value の行で表示する関数。
+// name は Label で設定した名前で、設定していなければ項の SMT-LIB2 形式の表現とする。
+func Show(terms ...*smt.Term) {
+	ccc.Show(terms...)
+}
+
+// SetExport は Solve で問題を解決する代わりに、形式 format で w に書き出すように設定する関数
+func SetExport(format string, w io.Writer) error {
+	return ccc.SetExport(format, w)
+}
+
+// Snapshot はこれまでに宣言された制約変数と制約条件を返す関数。
+// names には Solve で指定する制約変数の名前を指定する。
+func Snapshot(names ...string) *smt.Problem {
+	return ccc.Snapshot(names...)
+}
+
+// OnExportError は Solve と SolveAll が問題を書き出せなかった場合に、ロックを解放した後に
+// そのエラーを渡して呼び出す関数を設定する関数。書き出しに失敗したらプログラムを終了する場合などに使う。
+func OnExportError(f func(err error)) {
+	ccc.OnExportError(f)
+}
+
+// SetVerbose は検出したロジックなどの詳細を標準エラー出力に表示するかどうかを設定する関数
+func SetVerbose(verbose bool) {
+	ccc.SetVerbose(verbose)
+}
+
+// Logic は直前の Check で検出したロジックを返す関数。
+// UseLogic または UseTactic を指定した場合と、まだ Check していない場合は空文字列を返す。
+func Logic() string {
+	return ccc.Logic()
+}
+
+// Minimize は項 t を最小化する目的関数を設定する関数
+func Minimize(t *smt.Term) {
+	ccc.Minimize(t)
+}
+
+// Maximize は項 t を最大化する目的関数を設定する関数
+func Maximize(t *smt.Term) {
+	ccc.Maximize(t)
+}
+
+// SetOutputFormat は Solve と SolveAll の出力形式を設定する関数。
+// format は OutputText, OutputJSON, OutputCSV のいずれか。
+func SetOutputFormat(format string) error {
+	return ccc.SetOutputFormat(format)
+}
+
+// Statistics は宣言した制約変数と制約条件の数、項をバックエンドの表現に変換した時間、
+// これまでの Check の回数と所要時間（時間はミリ秒）に、バックエンドの統計情報を加えて返す関数
+func Statistics() []smt.Stat {
+	return ccc.Statistics()
+}
+
+// Stats は Statistics の統計情報を一行に一項目ずつ標準エラー出力に表示する関数。
+// 制約の書き方（Distinct と != の組み合わせなど）を比べるのに使う。
+func Stats() {
+	ccc.Stats()
+}
+
+// SetPrintStats は Close の際に統計情報を標準エラー出力に表示するかどうかを設定する関数
+func SetPrintStats(on bool) {
+	ccc.SetPrintStats(on)
+}
+
+// SetSVG は Solve で配列の解を盤面の図にして SVG ファイル path に書き出すように設定する関数。
+// Solve のたびにファイルを書き直す。path が空文字列の場合は書き出さない。
+func SetSVG(path string) {
+	ccc.SetSVG(path)
+}
+
+// SetTimeout は Solve と SolveAll の時間制限をミリ秒で設定する関数。
+// 時間制限は Solve ごとに適用され、SolveAll ではすべての解の列挙に適用される。
+// 時間内に判定できなかった場合は unknown と表示する。ms が 0 以下の場合は時間制限を解除する。
+func SetTimeout(ms int) {
+	ccc.SetTimeout(ms)
+}
+
+// ReasonUnknown は直前の Check が StatusUnknown を返した理由を返す関数。
+// 理由が分からない場合は空文字列を返す。
+func ReasonUnknown() string {
+	return ccc.ReasonUnknown()
+}
+
+// CheckContext は制約が解決可能かどうかを ctx が終了するまでに調べる関数。
+// ctx の期限はバックエンドの時間制限として設定し、ctx がキャンセルされると
+// バックエンドの実行中の Check を中断する。この場合は StatusUnknown を返し、
+// ReasonUnknown がその理由を返す。SetTimeout の時間制限は適用しない。
+// Interrupt を呼び出した場合も中断する。
+func CheckContext(ctx context.Context) (smt.Status, error) {
+	return ccc.CheckContext(ctx)
+}
+
+// Interrupt は実行中の Check を中断し、以後の Solve と SolveAll を何も表示せずに終了させる関数。
+// Ctrl-C のシグナルハンドラのように、Solve を実行しているのとは別のゴルーチンから呼び出す。
+// 中断した後は Statistics で統計情報を取得し、Close で資源を解放すること。
+func Interrupt() {
+	ccc.Interrupt()
+}
+
+// OnInterrupt は Interrupt で中断された Solve と SolveAll が、ロックを解放した後に呼び出す関数を設定する関数。
+// 中断したときに統計情報を表示してプログラムを終了する場合などに使う。
+func OnInterrupt(f func()) {
+	ccc.OnInterrupt(f)
+}
+
+// Sat は直前の Check（Solve、SolveAll、Model、CheckAssuming を含む）が解決可能だったかどうかを返す関数。
+// 直前が SolveAll の場合は解を一つ以上見つけたかどうかを返す。
+// DSL では if Sat() { ... } のように解の有無で処理を分けるのに使う。
+func Sat() bool {
+	return ccc.Sat()
+}
+
+// Unsat は直前の Check が解決不能だったかどうかを返す関数。
+// 直前が SolveAll の場合は解が一つもなかったかどうかを返す。
+// 判定できなかった場合とまだ Check していない場合は、Sat と Unsat のどちらも false を返す。
+func Unsat() bool {
+	return ccc.Unsat()
+}
+
+// IntValue は直前の解のもとでの整数の項の値を返す関数。
+// 値を求められない場合はエラーを標準エラー出力に表示して 0 を返す。
+func IntValue(t *smt.Term) int {
+	return ccc.IntValue(t)
+}
+
+// BoolValue は直前の解のもとでのブール型の項の値を返す関数。
+// 値を求められない場合はエラーを標準エラー出力に表示して false を返す。
+func BoolValue(t *smt.Term) bool {
+	return ccc.BoolValue(t)
+}
+
+// NumValue は直前の解のもとでの数値（または整数）の項の値を float64 で返す関数。
+// 無理数の場合は近似値を返す。値を求められない場合はエラーを標準エラー出力に表示して 0 を返す。
+func NumValue(t *smt.Term) float64 {
+	return ccc.NumValue(t)
+}
+
+// IntArrayValue は直前の解のもとでの整数の項の配列の値を返す関数
+func IntArrayValue(ts []*smt.Term) []int {
+	return ccc.IntArrayValue(ts)
+}
+
+// BoolArrayValue は直前の解のもとでのブール型の項の配列の値を返す関数
+func BoolArrayValue(ts []*smt.Term) []bool {
+	return ccc.BoolArrayValue(ts)
+}
+
+// NumArrayValue は直前の解のもとでの数値の項の配列の値を float64 で返す関数
+func NumArrayValue(ts []*smt.Term) []float64 {
+	return ccc.NumArrayValue(ts)
+}
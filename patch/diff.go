@@ -2,6 +2,32 @@ package z3
 
 // #include <stdlib.h>
 // #include "go-z3.h"
+/*
+int _Z3_is_numeral_ast(Z3_context c, Z3_ast a) {
+  return Z3_is_numeral_ast(c, a) ? 1 : 0;
+}
+
+int _Z3_is_algebraic_number(Z3_context c, Z3_ast a) {
+  return Z3_is_algebraic_number(c, a) ? 1 : 0;
+}
+
+void _Z3_params_set_bool(Z3_context c, Z3_params p, Z3_symbol k, int v) {
+  Z3_params_set_bool(c, p, k, v != 0);
+}
+
+int _Z3_global_param_get(Z3_string id) {
+  Z3_string v;
+  int ok;
+  Z3_toggle_warning_messages(0);
+  ok = Z3_global_param_get(id, &v) ? 1 : 0;
+  Z3_toggle_warning_messages(1);
+  return ok;
+}
+
+int _Z3_stats_is_uint(Z3_context c, Z3_stats s, unsigned idx) {
+  return Z3_stats_is_uint(c, s, idx) ? 1 : 0;
+}
+*/
 import "C"
 import "unsafe"
 
@@ -39,6 +65,94 @@ func (a *AST) Mod(a2 *AST) *AST {
 	}
 }
 
+// ToReal creates an AST node that coerces an int to a real.
+//
+// Maps to: Z3_mk_int2real
+func (a *AST) ToReal() *AST {
+	return &AST{
+		rawCtx: a.rawCtx,
+		rawAST: C.Z3_mk_int2real(a.rawCtx, a.rawAST),
+	}
+}
+
+// ToInt creates an AST node that coerces a real to an int (floor).
+//
+// Maps to: Z3_mk_real2int
+func (a *AST) ToInt() *AST {
+	return &AST{
+		rawCtx: a.rawCtx,
+		rawAST: C.Z3_mk_real2int(a.rawCtx, a.rawAST),
+	}
+}
+
+// IsInt creates an AST node that checks whether a real is an integer.
+//
+// Maps to: Z3_mk_is_int
+func (a *AST) IsInt() *AST {
+	return &AST{
+		rawCtx: a.rawCtx,
+		rawAST: C.Z3_mk_is_int(a.rawCtx, a.rawAST),
+	}
+}
+
+// HasIntSort returns true if the sort of the AST is int.
+//
+// Maps to: Z3_get_sort, Z3_get_sort_kind
+func (a *AST) HasIntSort() bool {
+	s := C.Z3_get_sort(a.rawCtx, a.rawAST)
+	return C.Z3_get_sort_kind(a.rawCtx, s) == C.Z3_INT_SORT
+}
+
+// HasRealSort returns true if the sort of the AST is real.
+//
+// Maps to: Z3_get_sort, Z3_get_sort_kind
+func (a *AST) HasRealSort() bool {
+	s := C.Z3_get_sort(a.rawCtx, a.rawAST)
+	return C.Z3_get_sort_kind(a.rawCtx, s) == C.Z3_REAL_SORT
+}
+
+// Div creates an AST node representing arg1 / arg2.
+//
+// Maps to: Z3_mk_div
+func (a *AST) Div(a2 *AST) *AST {
+	return &AST{
+		rawCtx: a.rawCtx,
+		rawAST: C.Z3_mk_div(a.rawCtx, a.rawAST, a2.rawAST),
+	}
+}
+
+// IsNumeral returns true if the AST is a numeral (int or rational).
+//
+// Maps to: Z3_is_numeral_ast
+func (a *AST) IsNumeral() bool {
+	return C._Z3_is_numeral_ast(a.rawCtx, a.rawAST) != 0
+}
+
+// IsAlgebraicNumber returns true if the AST is an irrational algebraic
+// number (root object).
+//
+// Maps to: Z3_is_algebraic_number
+func (a *AST) IsAlgebraicNumber() bool {
+	return C._Z3_is_algebraic_number(a.rawCtx, a.rawAST) != 0
+}
+
+// NumeralString returns the numeral as a string, e.g. "-3" or "8/3".
+//
+// Maps to: Z3_get_numeral_string
+func (a *AST) NumeralString() string {
+	return C.GoString(C.Z3_get_numeral_string(a.rawCtx, a.rawAST))
+}
+
+// DecimalString returns the numeral or algebraic number in decimal
+// notation with at most precision decimal places. A trailing "?"
+// indicates that the value was truncated.
+//
+// Maps to: Z3_get_numeral_decimal_string
+func (a *AST) DecimalString(precision int) string {
+	return C.GoString(C.Z3_get_numeral_decimal_string(
+		a.rawCtx, a.rawAST, C.uint(precision)))
+}
+
 //
 
 // RealSort returns the int type.
@@ -61,3 +175,181 @@ func (c *Context) Num(v string, typ *Sort) *AST {
 		rawAST: aa,
 	}
 }
+
+// Interrupt interrupts a running Solver.Check of the context.
+// It may be called from another goroutine; the interrupted
+// check returns Undef.
+//
+// Maps to: Z3_interrupt
+func (c *Context) Interrupt() {
+	C.Z3_interrupt(c.raw)
+}
+
+// SetTimeout sets the timeout of Check in milliseconds.
+// A timeout of 0 removes the limit.
+func (s *Solver) SetTimeout(ms uint) {
+	if ms == 0 {
+		ms = 4294967295 // UINT_MAX: no limit
+	}
+	s.SetUintParam("timeout", ms)
+}
+
+// SetUintParam sets an unsigned integer parameter of the solver.
+//
+// Maps to: Z3_params_set_uint, Z3_solver_set_params
+func (s *Solver) SetUintParam(name string, v uint) {
+	s.setParam(name, func(p C.Z3_params, k C.Z3_symbol) {
+		C.Z3_params_set_uint(s.rawCtx, p, k, C.uint(v))
+	})
+}
+
+// SetBoolParam sets a Boolean parameter of the solver, e.g.
+// "ctrl_c" to false to keep Check from handling SIGINT itself.
+//
+// Maps to: Z3_params_set_bool, Z3_solver_set_params
+func (s *Solver) SetBoolParam(name string, v bool) {
+	flag := 0
+	if v {
+		flag = 1
+	}
+	s.setParam(name, func(p C.Z3_params, k C.Z3_symbol) {
+		C._Z3_params_set_bool(s.rawCtx, p, k, C.int(flag))
+	})
+}
+
+// setParam sets a parameter of the solver by calling set with
+// a new parameter set and the symbol of name.
+func (s *Solver) setParam(name string, set func(C.Z3_params, C.Z3_symbol)) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	p := C.Z3_mk_params(s.rawCtx)
+	C.Z3_params_inc_ref(s.rawCtx, p)
+	set(p, C.Z3_mk_string_symbol(s.rawCtx, cname))
+	C.Z3_solver_set_params(s.rawCtx, s.rawSolver, p)
+	C.Z3_params_dec_ref(s.rawCtx, p)
+}
+
+// ReasonUnknown returns the reason why the last Check returned Undef,
+// e.g. "timeout", "canceled" or "incomplete".
+//
+// Maps to: Z3_solver_get_reason_unknown
+func (s *Solver) ReasonUnknown() string {
+	return C.GoString(C.Z3_solver_get_reason_unknown(s.rawCtx, s.rawSolver))
+}
+
+// CheckAssumptions checks the assertions of the solver assuming
+// that the Boolean constants (or their negations) in assumptions
+// are true. The assumptions hold only during this check.
+//
+// Maps to: Z3_solver_check_assumptions
+func (s *Solver) CheckAssumptions(assumptions ...*AST) LBool {
+	if len(assumptions) == 0 {
+		return s.Check()
+	}
+	raw := make([]C.Z3_ast, len(assumptions))
+	for i, a := range assumptions {
+		raw[i] = a.rawAST
+	}
+	return LBool(C.Z3_solver_check_assumptions(s.rawCtx, s.rawSolver, C.uint(len(raw)), &raw[0]))
+}
+
+// Statistic is a key/value pair of the solver statistics.
+type Statistic struct {
+	Key   string
+	Value float64
+}
+
+// Statistics returns the statistics of the solver, e.g. "conflicts",
+// "decisions" and "memory", in the order reported by Z3.
+//
+// Maps to: Z3_solver_get_statistics, Z3_stats_size, Z3_stats_get_key,
+// Z3_stats_is_uint, Z3_stats_get_uint_value, Z3_stats_get_double_value
+func (s *Solver) Statistics() []Statistic {
+	st := C.Z3_solver_get_statistics(s.rawCtx, s.rawSolver)
+	C.Z3_stats_inc_ref(s.rawCtx, st)
+	defer C.Z3_stats_dec_ref(s.rawCtx, st)
+
+	n := C.Z3_stats_size(s.rawCtx, st)
+	stats := make([]Statistic, 0, int(n))
+	for i := C.uint(0); i < n; i++ {
+		key := C.GoString(C.Z3_stats_get_key(s.rawCtx, st, i))
+		var v float64
+		if C._Z3_stats_is_uint(s.rawCtx, st, i) != 0 {
+			v = float64(C.Z3_stats_get_uint_value(s.rawCtx, st, i))
+		} else {
+			v = float64(C.Z3_stats_get_double_value(s.rawCtx, st, i))
+		}
+		stats = append(stats, Statistic{Key: key, Value: v})
+	}
+	return stats
+}
+
+// SetGlobalParam sets a global (or module) parameter shared by all
+// contexts, e.g. "smt.random_seed". It takes effect on the solvers
+// created afterwards. It returns false if the parameter does not exist.
+//
+// Maps to: Z3_global_param_get, Z3_global_param_set
+func SetGlobalParam(name, value string) bool {
+	cname := C.CString(name)
+	cvalue := C.CString(value)
+	defer C.free(unsafe.Pointer(cname))
+	defer C.free(unsafe.Pointer(cvalue))
+	if C._Z3_global_param_get(cname) == 0 {
+		return false
+	}
+	C.Z3_global_param_set(cname, cvalue)
+	return true
+}
+
+// NewSolverForLogic creates a solver customized for the SMT-LIB
+// logic, e.g. "QF_LIA". The logic must be one that Z3 recognizes,
+// otherwise Z3 reports an error.
+//
+// Maps to: Z3_mk_solver_for_logic
+func (c *Context) NewSolverForLogic(logic string) *Solver {
+	clogic := C.CString(logic)
+	defer C.free(unsafe.Pointer(clogic))
+	s := C.Z3_mk_solver_for_logic(c.raw, C.Z3_mk_string_symbol(c.raw, clogic))
+	C.Z3_solver_inc_ref(c.raw, s)
+	return &Solver{rawCtx: c.raw, rawSolver: s}
+}
+
+// TacticNames returns the names of the tactics built into Z3.
+//
+// Maps to: Z3_get_num_tactics, Z3_get_tactic_name
+func (c *Context) TacticNames() []string {
+	n := C.Z3_get_num_tactics(c.raw)
+	names := make([]string, 0, int(n))
+	for i := C.uint(0); i < n; i++ {
+		names = append(names, C.GoString(C.Z3_get_tactic_name(c.raw, i)))
+	}
+	return names
+}
+
+// NewSolverFromTactics creates a solver that applies the tactics one
+// after another, e.g. "simplify" and "qfnra-nlsat". The names must be
+// in TacticNames, otherwise Z3 reports an error.
+//
+// Maps to: Z3_mk_tactic, Z3_tactic_and_then, Z3_mk_solver_from_tactic
+func (c *Context) NewSolverFromTactics(names ...string) *Solver {
+	var t C.Z3_tactic
+	for i, name := range names {
+		cname := C.CString(name)
+		next := C.Z3_mk_tactic(c.raw, cname)
+		C.free(unsafe.Pointer(cname))
+		C.Z3_tactic_inc_ref(c.raw, next)
+		if i == 0 {
+			t = next
+			continue
+		}
+		both := C.Z3_tactic_and_then(c.raw, t, next)
+		C.Z3_tactic_inc_ref(c.raw, both)
+		C.Z3_tactic_dec_ref(c.raw, t)
+		C.Z3_tactic_dec_ref(c.raw, next)
+		t = both
+	}
+	s := C.Z3_mk_solver_from_tactic(c.raw, t)
+	C.Z3_solver_inc_ref(c.raw, s)
+	C.Z3_tactic_dec_ref(c.raw, t)
+	return &Solver{rawCtx: c.raw, rawSolver: s}
+}
@@ -1,7 +1,12 @@
-filename=`basename $1 .txt`.go
+src=$1
+shift
+filename=`basename $src .txt`.go
 
-./conv $1 $filename
+# Ctrl-C で中断したら変換した .go ファイルを削除する
+trap 'rm -f $filename; exit 130' INT
 
-go run $filename lib.go lib2.go lib3.go
+./conv $src $filename
 
-#rm $filename
\ No newline at end of file
+go run $filename lib.go lib2.go lib3.go "$@"
+
+#rm $filename*.rlib
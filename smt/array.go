@@ -0,0 +1,27 @@
+package smt
+
+import "fmt"
+
+// IntArrayVar は与えられた名前群の整数型制約変数のリストを作成する関数
+func (c *Context) IntArrayVar(name string, num int) (r []*Term) {
+	for i := 0; i < num; i++ {
+		r = append(r, c.IntVar(fmt.Sprintf("%s[%d]", name, i)))
+	}
+	return
+}
+
+// BoolArrayVar は与えられた名前群のブール型制約変数のリストを作成する関数
+func (c *Context) BoolArrayVar(name string, num int) (r []*Term) {
+	for i := 0; i < num; i++ {
+		r = append(r, c.BoolVar(fmt.Sprintf("%s[%d]", name, i)))
+	}
+	return
+}
+
+// NumArrayVar は与えられた名前群の数値型制約変数のリストを作成する関数
+func (c *Context) NumArrayVar(name string, num int) (r []*Term) {
+	for i := 0; i < num; i++ {
+		r = append(r, c.NumVar(fmt.Sprintf("%s[%d]", name, i)))
+	}
+	return
+}
@@ -0,0 +1,32 @@
+package smt
+
+import "fmt"
+
+// Assumer は一時的な仮定のもとで Check できるバックエンドが実装するインタフェース。
+// 仮定は CheckAssuming の間だけ有効で、その後の Check には影響しない。
+type Assumer interface {
+	CheckAssuming(lits []*Term) (Status, error)
+}
+
+// CheckAssuming は lits の制約条件を一時的に仮定して、制約が解決可能かどうかを調べる関数。
+// Assert と違って仮定はこの Check の間だけ有効なので、一つの Context で
+// 仮定を変えながら何度も問い合わせることができる。解決可能な場合は Model で値を取得できる。
+// SetTimeout の時間制限を適用する。
+func (c *Context) CheckAssuming(lits ...*Term) (Status, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, lit := range lits {
+		if lit.err != nil {
+			return StatusUnknown, fmt.Errorf("CheckAssuming: %v", lit.err)
+		}
+		if lit.Sort != SortBool {
+			return StatusUnknown, fmt.Errorf("CheckAssuming: assumption is %s, not Bool", lit.Sort)
+		}
+	}
+	if _, ok := c.backend.(Assumer); c.backend != nil && !ok && len(lits) > 0 {
+		return StatusUnknown, fmt.Errorf("CheckAssuming: the backend does not support assumptions")
+	}
+	ctx, cancel := c.withTimeout()
+	defer cancel()
+	return c.checkContext(ctx, lits...)
+}
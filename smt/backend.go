@@ -0,0 +1,69 @@
+package smt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Backend は制約を解決するソルバーを表すインタフェース。
+// 項（Term）はソルバーに依存せずに組み立てられ、Assert の際にバックエンドが
+// ソルバーの表現に変換する。
+type Backend interface {
+	// DeclareVar は制約変数を宣言する
+	DeclareVar(name, sort string) error
+	// Assert は制約条件を追加する
+	Assert(cond *Term) error
+	// Check は制約が解決可能かどうかを調べる
+	Check() (Status, error)
+	// Model は直前の Check で解決可能だった場合に、宣言されたすべての制約変数の値を返す
+	Model() (map[string]Value, error)
+	// Close はソルバーの資源を解放する
+	Close() error
+}
+
+// BackendFactory はバックエンドを生成する関数の型
+type BackendFactory func() (Backend, error)
+
+// バックエンドの登録簿
+var (
+	backendsMu sync.Mutex
+	backends   = map[string]BackendFactory{}
+)
+
+// RegisterBackend はバックエンドを名前で登録する関数。
+// バックエンドのパッケージの init から呼び出す。
+func RegisterBackend(name string, f BackendFactory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[name] = f
+}
+
+// Backends は登録されているバックエンドの名前を返す関数
+func Backends() []string {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	var names []string
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open は名前で指定したバックエンドを使う新しいコンテクストを生成する関数
+func Open(name string) (*Context, error) {
+	backendsMu.Lock()
+	f, ok := backends[name]
+	backendsMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q (available: %s)", name, strings.Join(Backends(), ", "))
+	}
+
+	b, err := f()
+	if err != nil {
+		return nil, fmt.Errorf("backend %s: %v", name, err)
+	}
+	return NewContext(b), nil
+}
@@ -0,0 +1,79 @@
+package smt
+
+import (
+	"fmt"
+	"os"
+)
+
+// Configurer はソルバーのオプション、タクティク、ロジックを設定できるバックエンドが実装するインタフェース。
+// いずれもソルバーを作成する前、つまり最初の Assert の前に呼び出す必要がある。
+type Configurer interface {
+	// SetOption はソルバーのオプション（"smt.random_seed" など）を設定する
+	SetOption(name, value string) error
+	// UseTactic は names のタクティクを順に適用するソルバーを使うように設定する
+	UseTactic(names ...string) error
+	// UseLogic は SMT-LIB のロジック（"QF_LIA" など）用のソルバーを使うように設定する
+	UseLogic(logic string) error
+}
+
+// Option はソルバーのオプションの名前と値
+type Option struct {
+	Name  string
+	Value string
+}
+
+// SetOption はソルバーのオプションを設定する関数。
+// SetOption("smt.random_seed", "7") のように、値は文字列で指定する。
+// 最初の Assert の前に呼び出すこと（DSL では conv がプログラムの先頭に移動する）。
+func (c *Context) SetOption(name, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.options = append(c.options, Option{Name: name, Value: value})
+	c.configure("SetOption", func(cf Configurer) error {
+		return cf.SetOption(name, value)
+	})
+}
+
+// UseTactic は names のタクティク（"simplify"、"qfnra-nlsat" など）を順に適用するソルバーを使うように設定する関数。
+// UseLogic と両方を指定した場合は UseTactic を優先する。最初の Assert の前に呼び出すこと。
+func (c *Context) UseTactic(names ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(names) == 0 {
+		c.setErr(fmt.Errorf("UseTactic: no tactic"))
+		return
+	}
+	c.tactics = append([]string{}, names...)
+	c.configure("UseTactic", func(cf Configurer) error {
+		return cf.UseTactic(names...)
+	})
+}
+
+// UseLogic は SMT-LIB のロジック（"QF_LIA"、"QF_NRA" など）用のソルバーを使うように設定する関数。
+// 最初の Assert の前に呼び出すこと。
+func (c *Context) UseLogic(logic string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logic = logic
+	c.configure("UseLogic", func(cf Configurer) error {
+		return cf.UseLogic(logic)
+	})
+}
+
+// configure はバックエンドに設定を適用する関数。
+// バックエンドが Configurer を実装していない場合は警告を表示して設定を無視する。
+// 呼び出し側でロックを取得していること。
+func (c *Context) configure(fn string, apply func(Configurer) error) {
+	if c.backend == nil {
+		// 問題を書き出す場合は Problem に含める
+		return
+	}
+	cf, ok := c.backend.(Configurer)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "warning: the backend does not support %s; it is ignored\n", fn)
+		return
+	}
+	if err := apply(cf); err != nil {
+		c.setErr(fmt.Errorf("%s: %v", fn, err))
+	}
+}
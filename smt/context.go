@@ -0,0 +1,438 @@
+// Package smt は DSL の制約条件をソルバーで解決するためのライブラリ。
+// ソルバーは Backend インタフェースを実装したバックエンドとして差し替えられる。
+package smt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// Context はバックエンドのソルバーと宣言された制約変数を保持する構造体型。
+// 一つの Context は一つの問題に対応する。
+// Context のメソッドは複数のゴルーチンから呼び出してもよいが、
+// 独立した問題は別々の Context を作成して並行に解決すること。
+type Context struct {
+	mu      sync.Mutex
+	backend Backend
+	vars    map[string]*Term
+	names   []string // 宣言順の制約変数名
+	asserts []*Term
+	err     error // 最初に検出したエラー。Check と Model が返す
+
+	// 直前の Check が解決可能で、その後に制約条件が追加されていないことを示す。
+	// この場合 Model は Check し直さずにその解を返す。
+	// last は直前に取得した解で、Eval と Show が使う。次の Check まで保持する
+	solved bool
+	last   *Result
+
+	// Solve の時間制限と、直前の Check が判定できなかった理由。
+	// base は Interrupt でキャンセルされる、すべての Check の親のコンテクスト
+	timeout     time.Duration
+	reason      string
+	lastStatus  Status // 直前の Check の結果。Sat と Unsat が返す
+	found       bool   // 直前の SolveAll が解を一つ以上見つけたことを示す
+	base        context.Context
+	stop        context.CancelFunc
+	onInterrupt func()
+
+	// Check の回数と、項の変換、Check、値の取得の所要時間の合計。
+	// printStats は Close の際に統計情報を表示することを示す
+	checks      int
+	convertTime time.Duration
+	checkTime   time.Duration
+	modelTime   time.Duration
+	printStats  bool
+
+	// ソルバーのオプション、タクティク、ロジック
+	options []Option
+	tactics []string
+	logic   string
+
+	// 検出したロジックと、ロジックの検出に使った制約条件の数と特徴
+	detected string
+	analyzed int
+	features logicFeatures
+	verbose  bool // 詳細を標準エラー出力に表示する
+
+	// 目的関数。unoptimized はバックエンドが目的関数をサポートしないことを示す
+	objective   *Objective
+	unoptimized bool
+
+	// 数値の表示形式と Solve の出力形式、配列を表で表示する設定
+	numFormat string
+	digits    int
+	output    string
+	displays  map[string]*display
+	svgPath   string // 盤面の図を書き出す SVG ファイル
+
+	// Solve で問題を書き出す場合の形式と出力先。
+	// exportErr は直前の書き出しのエラーで、OnExportError で設定した onExportError に渡す
+	exporter      Exporter
+	exportTo      io.Writer
+	exported      int // 書き出した回数
+	exportErr     error
+	onExportError func(err error)
+
+	guards int // SolveAll で宣言した、解を除く制約条件を有効にする制約変数の数
+}
+
+// NewContext はバックエンド b を使う新しいコンテクストを生成する関数。
+// 名前でバックエンドを指定する場合は Open を使う。
+// b が nil の場合は問題を蓄積するだけで解決しない（問題を書き出す場合に使う）。
+func NewContext(b Backend) *Context {
+	c := &Context{
+		backend:   b,
+		vars:      map[string]*Term{},
+		numFormat: NumFormatZ3,
+		digits:    10,
+		output:    OutputText,
+	}
+	c.base, c.stop = context.WithCancel(context.Background())
+	return c
+}
+
+// SetNumFormat は Solve で表示する数値の形式を設定する関数。
+// kind は NumFormatZ3, NumFormatFrac, NumFormatDec, NumFormatBoth のいずれか。
+// digits は小数で表示する場合の小数点以下の桁数。
+func (c *Context) SetNumFormat(kind string, digits int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.numFormat = kind
+	c.digits = digits
+}
+
+// Close はコンテクストをクローズする関数
+func (c *Context) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stop()
+	if c.printStats {
+		c.printStatistics()
+		c.printStats = false
+	}
+	if c.backend != nil {
+		c.backend.Close()
+		c.backend = nil
+	}
+}
+
+// setErr は最初に検出したエラーを記録する関数。呼び出し側でロックを取得していること。
+func (c *Context) setErr(err error) {
+	if c.err == nil && err != nil {
+		c.err = err
+	}
+}
+
+// newVar は制約変数の項を作成して登録する関数
+func (c *Context) newVar(name, sort string) *Term {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.vars[name]
+	if !ok {
+		v = varTerm(name, sort)
+		c.vars[name] = v
+		c.names = append(c.names, name)
+		c.solved = false
+		if c.backend != nil {
+			start := time.Now()
+			c.setErr(c.backend.DeclareVar(name, sort))
+			c.convertTime += time.Since(start)
+		}
+	}
+	return v
+}
+
+// BoolVar はブール型の制約変数の項を作成する関数
+func (c *Context) BoolVar(name string) *Term {
+	return c.newVar(name, SortBool)
+}
+
+// IntVar は整数型の制約変数の項を作成する関数
+func (c *Context) IntVar(name string) *Term {
+	return c.newVar(name, SortInt)
+}
+
+// IntVal は整数値の項を作成する関数
+func (c *Context) IntVal(value int) *Term {
+	return IntConst(big.NewInt(int64(value)))
+}
+
+// NumVar は数値型の制約変数の項を作成する関数
+func (c *Context) NumVar(name string) *Term {
+	return c.newVar(name, SortNum)
+}
+
+// NumVal は数値の項を作成する関数。"1/3" のような分数も指定できる。
+func (c *Context) NumVal(value string) *Term {
+	r, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return &Term{Op: OpConst, Sort: SortNum, err: fmt.Errorf("NumVal: invalid number %q", value)}
+	}
+	return NumConst(r)
+}
+
+// Rat は分数 num/den の数値の項を作成する関数
+func (c *Context) Rat(num, den int) *Term {
+	if den == 0 {
+		return &Term{Op: OpConst, Sort: SortNum, err: fmt.Errorf("Rat: division by zero")}
+	}
+	return NumConst(big.NewRat(int64(num), int64(den)))
+}
+
+// Promote は整数の項を、他のいずれかが数値の場合に数値へ昇格させる関数
+func (c *Context) Promote(a *Term, others ...*Term) *Term {
+	if !a.HasIntSort() {
+		return a
+	}
+	for _, other := range others {
+		if other.HasRealSort() {
+			return a.ToReal()
+		}
+	}
+	return a
+}
+
+// Assert は制約条件を宣言する関数
+func (c *Context) Assert(cond *Term) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cond.err != nil {
+		c.setErr(fmt.Errorf("Assert: %v", cond.err))
+		return
+	}
+	if cond.Sort != SortBool {
+		c.setErr(fmt.Errorf("Assert: condition is %s, not Bool", cond.Sort))
+		return
+	}
+	c.asserts = append(c.asserts, cond)
+	c.solved = false
+	if c.backend != nil {
+		start := time.Now()
+		c.setErr(c.backend.Assert(cond))
+		c.convertTime += time.Since(start)
+	}
+}
+
+// Check は制約が解決可能かどうかを調べる関数
+func (c *Context) Check() (Status, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.check()
+}
+
+// check は Check の本体。SetTimeout の時間制限を適用する。
+// 呼び出し側でロックを取得していること。
+func (c *Context) check() (Status, error) {
+	ctx, cancel := c.withTimeout()
+	defer cancel()
+	return c.checkContext(ctx)
+}
+
+// Model は制約を解決し、制約を満たす値を返す関数。
+// 直前の Check または CheckAssuming が解決可能で、その後に制約条件を追加していない場合は、
+// 解決し直さずにその解を返す。解決可能でない場合はエラーを返す。
+func (c *Context) Model() (*Result, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.model()
+}
+
+// model は Model の本体。呼び出し側でロックを取得していること。
+func (c *Context) model() (*Result, error) {
+	if !c.solved {
+		// 解決可能かどうかを調べる
+		st, err := c.check()
+		if err != nil {
+			return nil, err
+		}
+		if st != StatusSat {
+			return nil, fmt.Errorf("no model: %s", st)
+		}
+	}
+	return c.values()
+}
+
+// values は直前の Check で解決可能だった場合に、制約を満たす値を取得する関数。
+// 呼び出し側でロックを取得していること。
+func (c *Context) values() (*Result, error) {
+	start := time.Now()
+	values, err := c.backend.Model()
+	c.modelTime += time.Since(start)
+	if err != nil {
+		return nil, err
+	}
+	r := &Result{names: append([]string{}, c.names...), values: map[string]Value{}}
+	for _, name := range c.names {
+		v, ok := values[name]
+		if !ok {
+			return nil, fmt.Errorf("no value for %s", name)
+		}
+		r.values[name] = v
+	}
+	c.last = r
+	return r, nil
+}
+
+// Solve は制約を解決する変数の値を表示する関数
+func (c *Context) Solve(names ...string) {
+	defer c.notifyInterrupt()
+	defer c.notifyExportError()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.exporter != nil {
+		c.exportSolve(names)
+		return
+	}
+
+	ctx, cancel := c.withTimeout()
+	defer cancel()
+	s := &solveStats{}
+	c.solveOnce(ctx, s)
+	if c.interrupted() {
+		return
+	}
+	// 可変引数で指定された変数名（配列は展開する）の値を表示
+	c.printSolutions(os.Stdout, names, s, false)
+}
+
+// SolveAll は制約を満たすすべての解を列挙して表示する関数。
+// 解を見つけるたびに、names の変数（省略した場合はすべての制約変数）の値が
+// その解と異なるという制約条件を追加して解決し直す。
+// バックエンドが Assumer を実装していれば、この制約条件は列挙のための制約変数を仮定したときだけ有効になるので、
+// 列挙の後の Solve は列挙の前と同じ問題を解決する。実装していなければ制約条件は Assert したものとして残り、
+// その後の Solve は見つけた解を除いて解決する。
+func (c *Context) SolveAll(names ...string) {
+	defer c.notifyInterrupt()
+	defer c.notifyExportError()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.exporter != nil {
+		c.exportSolve(names)
+		return
+	}
+
+	block := c.expand(names)
+	if len(names) == 0 {
+		block = c.names
+	}
+	ctx, cancel := c.withTimeout()
+	defer cancel()
+	s := &solveStats{}
+	var guard []*Term
+	if _, ok := c.backend.(Assumer); ok && c.err == nil {
+		g, err := c.newGuard()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		guard = []*Term{g}
+	}
+	for c.solveOnce(ctx, s, guard...) {
+		// 見つけた解を除く
+		r := s.solutions[len(s.solutions)-1]
+		var diffs []*Term
+		for _, name := range block {
+			v, _ := r.Value(name)
+			t, ok := v.term()
+			if !ok {
+				s.err = fmt.Errorf("SolveAll: cannot exclude the value %s of %s", v.Text, name)
+				fmt.Fprintln(os.Stderr, s.err)
+				break
+			}
+			diffs = append(diffs, c.vars[name].Eq(t).Not())
+		}
+		if s.err != nil || len(diffs) == 0 {
+			break
+		}
+		cond := diffs[0].Or(diffs[1:]...)
+		if len(guard) > 0 {
+			cond = guard[0].Implies(cond)
+		} else {
+			c.asserts = append(c.asserts, cond)
+		}
+		c.solved = false
+		if err := c.backend.Assert(cond); err != nil {
+			s.err = err
+			fmt.Fprintln(os.Stderr, err)
+			break
+		}
+	}
+	if len(guard) > 0 {
+		// 列挙が終わったら解を除く制約条件を無効にする
+		c.setErr(c.backend.Assert(guard[0].Not()))
+	}
+	// 最後の Check は解を除いた問題が解決不能だったことを示すだけなので、Sat と Unsat には見つけた解の有無を返させる
+	c.found = len(s.solutions) > 0
+	if c.interrupted() {
+		return
+	}
+	c.printSolutions(os.Stdout, names, s, true)
+}
+
+// newGuard は SolveAll で解を除く制約条件を有効にするブール型の制約変数を、
+// 宣言された制約変数と重ならない名前でバックエンドにだけ宣言する関数。
+// 呼び出し側でロックを取得していること。
+func (c *Context) newGuard() (*Term, error) {
+	for {
+		c.guards++
+		name := fmt.Sprintf("solveall!%d", c.guards)
+		if _, ok := c.vars[name]; ok {
+			continue
+		}
+		if err := c.backend.DeclareVar(name, SortBool); err != nil {
+			return nil, err
+		}
+		return varTerm(name, SortBool), nil
+	}
+}
+
+// solveOnce は ctx が終了するまでに lits を仮定して制約を解決し、解が見つかれば s に追加して true を返す関数。
+// 解決不能でなくエラーの場合は、その内容を標準エラー出力に表示する。
+// 呼び出し側でロックを取得していること。
+func (c *Context) solveOnce(ctx context.Context, s *solveStats, lits ...*Term) bool {
+	if c.unoptimized {
+		fmt.Fprintln(os.Stderr, "warning: the backend does not support optimization; the objective is ignored")
+		c.unoptimized = false
+	}
+
+	start := time.Now()
+	st, err := c.checkContext(ctx, lits...)
+	s.check += time.Since(start)
+	s.status, s.reason = st, c.reason
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		s.err = err
+		return false
+	}
+	if st != StatusSat {
+		return false
+	}
+
+	start = time.Now()
+	r, err := c.values()
+	s.model += time.Since(start)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		s.err = err
+		return false
+	}
+	s.solutions = append(s.solutions, r)
+	return true
+}
+
+// True は True 値の項を作成する関数
+func (c *Context) True() *Term {
+	return BoolConst(true)
+}
+
+// False は False 値の項を作成する関数
+func (c *Context) False() *Term {
+	return BoolConst(false)
+}
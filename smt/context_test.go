@@ -0,0 +1,48 @@
+package smt_test
+
+import (
+	"testing"
+
+	"github.com/bunji2/practiceofdsl/smt"
+	"github.com/bunji2/practiceofdsl/smt/fd"
+)
+
+// noAssumer は仮定をサポートしないバックエンド。fd の CheckAssuming を隠す
+type noAssumer struct {
+	smt.Backend
+}
+
+func TestSolveAllScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend smt.Backend
+		want    smt.Status // 列挙の後の Check の結果
+		asserts int        // 列挙の後の制約条件の数
+	}{
+		{"assumptions", fd.New(), smt.StatusSat, 1},
+		{"no assumptions", noAssumer{fd.New()}, smt.StatusUnsat, 4},
+	}
+	for _, tt := range tests {
+		c := smt.NewContext(tt.backend)
+		x := c.IntVar("x")
+		c.Assert(x.Ge(c.IntVal(0)).And(x.Le(c.IntVal(2))))
+		c.SolveAll("x")
+		if st, err := c.Check(); st != tt.want || err != nil {
+			t.Errorf("%s: Check() after SolveAll = %s, %v; want %s", tt.name, st, err, tt.want)
+		}
+		if n := len(c.Snapshot().Asserts); n != tt.asserts {
+			t.Errorf("%s: %d asserts after SolveAll; want %d", tt.name, n, tt.asserts)
+		}
+		if tt.want == smt.StatusSat {
+			// 解を除く制約条件は仮定したときだけ有効なので、同じ解をもう一度見つけられる
+			if st, err := c.CheckAssuming(x.Eq(c.IntVal(1))); st != smt.StatusSat || err != nil {
+				t.Errorf("%s: CheckAssuming(x == 1) = %s, %v; want sat", tt.name, st, err)
+			}
+			c.SolveAll("x")
+			if st, _ := c.Check(); st != smt.StatusSat {
+				t.Errorf("%s: Check() after the second SolveAll = %s; want sat", tt.name, st)
+			}
+		}
+		c.Close()
+	}
+}
@@ -0,0 +1,201 @@
+package smt
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// display は配列の制約変数を表形式で表示する設定を表す構造体型
+type display struct {
+	cols      int               // 一行の列数。0 は配列の長さ（一行）
+	boxRows   int               // 区切り線を入れる行数。0 は区切らない
+	boxCols   int               // 区切りを入れる列数。0 は区切らない
+	glyphs    map[string]string // 値の文字列と表示する記号の対応
+	positions bool              // 各要素をその行でのマスの位置（列の番号）とみなす
+}
+
+// Display は配列 name の制約変数を Solve で表形式で表示するように設定する関数。
+// spec は空白で区切った次の設定の並び。
+//
+//	cols=9              一行の列数（既定は配列の長さで、一行で表示する）
+//	box=3x3             3行ごと、3列ごとに区切りを入れる
+//	glyph=1:Q,0:.       値 1 を Q、0 を . で表示する（Bool は true:Q,false:.）
+//	positions           x[i] を i 行目のマスの位置とみなし、盤面で表示する（8クイーンなど）
+//
+// positions では、マスに置かれている場合を値 true、置かれていない場合を false として glyph を適用する。
+func (c *Context) Display(name string, spec string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, err := parseDisplay(spec)
+	if err != nil {
+		c.setErr(fmt.Errorf("Display %s: %v", name, err))
+		return
+	}
+	if c.displays == nil {
+		c.displays = map[string]*display{}
+	}
+	c.displays[name] = d
+}
+
+// SolveGrid は制約を解決し、配列 name の値を一行 cols 列の表で表示する関数。
+// Display で設定した区切りと記号も使う。
+func (c *Context) SolveGrid(name string, cols int) {
+	c.mu.Lock()
+	prev, ok := c.displays[name]
+	d := &display{}
+	if ok {
+		*d = *prev
+	}
+	d.cols = cols
+	if c.displays == nil {
+		c.displays = map[string]*display{}
+	}
+	c.displays[name] = d
+	c.mu.Unlock()
+
+	c.Solve(name)
+
+	// SolveGrid の列数は Display の設定に残さない
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ok {
+		c.displays[name] = prev
+	} else {
+		delete(c.displays, name)
+	}
+}
+
+// parseDisplay は Display の設定を解析する関数
+func parseDisplay(spec string) (*display, error) {
+	d := &display{glyphs: map[string]string{}}
+	for _, field := range strings.Fields(spec) {
+		key, value := field, ""
+		if i := strings.Index(field, "="); i >= 0 {
+			key, value = field[:i], field[i+1:]
+		}
+		var err error
+		switch key {
+		case "cols":
+			d.cols, err = strconv.Atoi(value)
+			if err == nil && d.cols <= 0 {
+				err = fmt.Errorf("cols must be positive")
+			}
+		case "box":
+			rc := strings.SplitN(value, "x", 2)
+			if len(rc) != 2 {
+				return nil, fmt.Errorf("box must be ROWSxCOLS: %s", value)
+			}
+			if d.boxRows, err = strconv.Atoi(rc[0]); err == nil {
+				d.boxCols, err = strconv.Atoi(rc[1])
+			}
+		case "glyph":
+			for _, pair := range strings.Split(value, ",") {
+				kv := strings.SplitN(pair, ":", 2)
+				if len(kv) != 2 {
+					return nil, fmt.Errorf("glyph must be VALUE:GLYPH: %s", pair)
+				}
+				d.glyphs[kv[0]] = kv[1]
+			}
+		case "positions":
+			d.positions = true
+		default:
+			return nil, fmt.Errorf("unknown option %q", field)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", field, err)
+		}
+	}
+	return d, nil
+}
+
+// grid は配列の値を表示する記号の表にする関数
+func (d *display) grid(values []Value) [][]string {
+	var cells []string
+	cols := d.cols
+	if d.positions {
+		// 盤面の大きさは既定で配列の長さの正方形
+		if cols == 0 {
+			cols = len(values)
+		}
+		for _, v := range values {
+			for j := 0; j < cols; j++ {
+				cells = append(cells, d.glyph(strconv.FormatBool(v.Int != nil && v.Int.IsInt64() && v.Int.Int64() == int64(j))))
+			}
+		}
+	} else {
+		if cols == 0 {
+			cols = len(values)
+		}
+		for _, v := range values {
+			cells = append(cells, d.glyph(csvValue(v)))
+		}
+	}
+
+	var rows [][]string
+	for i := 0; i < len(cells); i += cols {
+		j := i + cols
+		if j > len(cells) {
+			j = len(cells)
+		}
+		rows = append(rows, cells[i:j])
+	}
+	return rows
+}
+
+// glyph は値の文字列に対応する記号を返す関数。対応がなければ値の文字列をそのまま返す。
+func (d *display) glyph(s string) string {
+	if g, ok := d.glyphs[s]; ok {
+		return g
+	}
+	return s
+}
+
+// write は配列 name の値を表として w に書き出す関数。
+// 各欄は最も長い記号の幅に右揃えし、box の指定に従って区切りを入れる。
+func (d *display) write(w io.Writer, name string, values []Value) {
+	rows := d.grid(values)
+	width := 1
+	for _, row := range rows {
+		for _, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > width {
+				width = n
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "%s =\n", name)
+	for i, row := range rows {
+		if i > 0 && d.boxRows > 0 && i%d.boxRows == 0 {
+			fmt.Fprintf(w, "  %s\n", d.separator(len(rows[0]), width))
+		}
+		var b strings.Builder
+		for j, cell := range row {
+			if j > 0 {
+				b.WriteString(" ")
+				if d.boxCols > 0 && j%d.boxCols == 0 {
+					b.WriteString("| ")
+				}
+			}
+			b.WriteString(strings.Repeat(" ", width-utf8.RuneCountInString(cell)) + cell)
+		}
+		fmt.Fprintf(w, "  %s\n", b.String())
+	}
+}
+
+// separator は box の行の区切り線を返す関数
+func (d *display) separator(cols, width int) string {
+	var b strings.Builder
+	for j := 0; j < cols; j++ {
+		if j > 0 {
+			if d.boxCols > 0 && j%d.boxCols == 0 {
+				b.WriteString("-+")
+			}
+			b.WriteString("-")
+		}
+		b.WriteString(strings.Repeat("-", width))
+	}
+	return b.String()
+}
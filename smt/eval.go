@@ -0,0 +1,239 @@
+package smt
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// Evaluator は直前に値を取得した解のもとで項を評価できるバックエンドが実装するインタフェース。
+// 解に現れない制約変数は既定値で補完して評価する（モデルの補完）。
+type Evaluator interface {
+	Eval(t *Term) (Value, error)
+}
+
+// errNoModel は評価に使う解がない場合のエラー
+var errNoModel = errors.New("no model; call Solve or Check first")
+
+// maxPowBits は Eval で求める累乗の結果のおおよその最大ビット数
+const maxPowBits = 1 << 20
+
+// Label は Show で表示する名前を text とした項を返す関数。項の意味は変わらない。
+// DSL の Show(x + y) は conv が Show(x.Add(y).Label("x + y")) に変換する。
+func (t *Term) Label(text string) *Term {
+	l := *t
+	l.label = text
+	return &l
+}
+
+// Eval は直前の解のもとで項 t の値を求める関数。
+// 解は直前に解決可能だった Solve、Model、Check、CheckAssuming のもので、
+// その後に Assert した場合も次の Check まで保持する。解に現れない制約変数は既定値で補完する。
+// バックエンドが Evaluator を実装していればそれを使い、実装していなければ解の値から計算する。
+// DSL の Value(expr) は conv が Eval に変換する。
+func (c *Context) Eval(t *Term) (Value, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.eval(t)
+}
+
+// eval は Eval の本体。呼び出し側でロックを取得していること。
+func (c *Context) eval(t *Term) (Value, error) {
+	if t.err != nil {
+		return Value{}, t.err
+	}
+	if c.last == nil {
+		if !c.solved {
+			return Value{}, errNoModel
+		}
+		if _, err := c.values(); err != nil {
+			return Value{}, err
+		}
+	}
+	if e, ok := c.backend.(Evaluator); ok {
+		return e.Eval(t)
+	}
+	x, err := c.last.eval(t)
+	if err != nil {
+		return Value{}, err
+	}
+	switch t.Sort {
+	case SortBool:
+		return NewBoolValue(x.b), nil
+	case SortInt:
+		return NewIntValue(x.n.Num()), nil
+	}
+	return NewNumValue(x.n), nil
+}
+
+// Show は直前の解のもとで項の値を name = value の行で表示する関数。
+// name は Label で設定した名前で、設定していなければ項の SMT-LIB2 形式の表現とする。
+func (c *Context) Show(terms ...*Term) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range terms {
+		name := t.label
+		if name == "" {
+			name = t.String()
+		}
+		v, err := c.eval(t)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Show: %s: %v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "%s = %s\n", name, v.Format(c.numFormat, c.digits))
+	}
+}
+
+// evalValue は項の評価の途中の値。数は有理数で表す
+type evalValue struct {
+	n *big.Rat
+	b bool
+}
+
+// eval は解の値から項の値を計算する関数。
+// 解に値のない制約変数は既定値（0、0.0、false）とする。
+func (r *Result) eval(t *Term) (evalValue, error) {
+	switch t.Op {
+	case OpVar:
+		v, ok := r.values[t.Name]
+		switch {
+		case t.Sort == SortBool:
+			return evalValue{b: ok && v.Bool}, nil
+		case !ok:
+			return evalValue{n: new(big.Rat)}, nil
+		case v.Int != nil:
+			return evalValue{n: new(big.Rat).SetInt(v.Int)}, nil
+		case v.Rat != nil:
+			return evalValue{n: v.Rat}, nil
+		}
+		return evalValue{}, fmt.Errorf("cannot evaluate with the irrational value %s of %s", v.Text, t.Name)
+	case OpConst:
+		return evalValue{n: t.Num, b: t.Bool}, nil
+	}
+
+	args := make([]evalValue, len(t.Args))
+	for i, arg := range t.Args {
+		a, err := r.eval(arg)
+		if err != nil {
+			return evalValue{}, err
+		}
+		args[i] = a
+	}
+	num := func(n *big.Rat) (evalValue, error) { return evalValue{n: n}, nil }
+	boolean := func(b bool) (evalValue, error) { return evalValue{b: b}, nil }
+	x := args[0]
+
+	switch t.Op {
+	case OpAdd, OpSub, OpMul:
+		n := new(big.Rat).Set(x.n)
+		for _, a := range args[1:] {
+			switch t.Op {
+			case OpAdd:
+				n.Add(n, a.n)
+			case OpSub:
+				n.Sub(n, a.n)
+			default:
+				n.Mul(n, a.n)
+			}
+		}
+		return num(n)
+	case OpNeg:
+		return num(new(big.Rat).Neg(x.n))
+	case OpDiv, OpMod:
+		y := args[1]
+		if y.n.Sign() == 0 {
+			return evalValue{}, fmt.Errorf("division by zero in %s", t)
+		}
+		if t.Op == OpDiv && t.Sort == SortNum {
+			return num(new(big.Rat).Quo(x.n, y.n))
+		}
+		// Int の div と mod は SMT-LIB と同じくユークリッド除算
+		q, m := new(big.Int).DivMod(x.n.Num(), y.n.Num(), new(big.Int))
+		if t.Op == OpDiv {
+			return num(new(big.Rat).SetInt(q))
+		}
+		return num(new(big.Rat).SetInt(m))
+	case OpPow:
+		y := args[1]
+		if !y.n.IsInt() || !y.n.Num().IsInt64() || t.Sort == SortInt && y.n.Sign() < 0 {
+			return evalValue{}, fmt.Errorf("cannot evaluate the exponent %s in %s", y.n.RatString(), t)
+		}
+		e := y.n.Num().Int64()
+		if e < 0 && x.n.Sign() == 0 {
+			return evalValue{}, fmt.Errorf("division by zero in %s", t)
+		}
+		k := big.NewInt(e)
+		k.Abs(k)
+		p, q := x.n.Num(), x.n.Denom()
+		// 0、1、-1 以外の底では、結果の桁数は指数に比例するので大きすぎる指数を拒否する
+		bits := p.BitLen()
+		if q.BitLen() > bits {
+			bits = q.BitLen()
+		}
+		if bits > 1 && (!k.IsInt64() || k.Int64() > maxPowBits/int64(bits-1)) {
+			return evalValue{}, fmt.Errorf("the exponent %d is too large to evaluate %s", e, t)
+		}
+		n := new(big.Rat).SetFrac(new(big.Int).Exp(p, k, nil), new(big.Int).Exp(q, k, nil))
+		if e < 0 {
+			n.Inv(n)
+		}
+		return num(n)
+	case OpEq, OpIff:
+		return boolean(equal(t.Args[0].Sort, x, args[1]))
+	case OpDistinct:
+		for i := range args {
+			for j := i + 1; j < len(args); j++ {
+				if equal(t.Args[0].Sort, args[i], args[j]) {
+					return boolean(false)
+				}
+			}
+		}
+		return boolean(true)
+	case OpLt:
+		return boolean(x.n.Cmp(args[1].n) < 0)
+	case OpLe:
+		return boolean(x.n.Cmp(args[1].n) <= 0)
+	case OpGt:
+		return boolean(x.n.Cmp(args[1].n) > 0)
+	case OpGe:
+		return boolean(x.n.Cmp(args[1].n) >= 0)
+	case OpNot:
+		return boolean(!x.b)
+	case OpAnd, OpOr:
+		b := t.Op == OpAnd
+		for _, a := range args {
+			if a.b != b {
+				return boolean(!b)
+			}
+		}
+		return boolean(b)
+	case OpXor:
+		return boolean(x.b != args[1].b)
+	case OpImplies:
+		return boolean(!x.b || args[1].b)
+	case OpIte:
+		if x.b {
+			return args[1], nil
+		}
+		return args[2], nil
+	case OpToReal:
+		return x, nil
+	case OpToInt:
+		// 床関数
+		q, _ := new(big.Int).DivMod(x.n.Num(), x.n.Denom(), new(big.Int))
+		return num(new(big.Rat).SetInt(q))
+	case OpIsInt:
+		return boolean(x.n.IsInt())
+	}
+	return evalValue{}, fmt.Errorf("cannot evaluate the operator %s", t.Op)
+}
+
+// equal は sort の二つの値が等しいかどうかを調べる関数
+func equal(sort string, x, y evalValue) bool {
+	if sort == SortBool {
+		return x.b == y.b
+	}
+	return x.n.Cmp(y.n) == 0
+}
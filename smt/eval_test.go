@@ -0,0 +1,50 @@
+package smt_test
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/bunji2/practiceofdsl/smt"
+	"github.com/bunji2/practiceofdsl/smt/fd"
+)
+
+func TestEvalPow(t *testing.T) {
+	// fd は Evaluator を実装しないので、解の値から累乗を計算する
+	c := smt.NewContext(fd.New())
+	defer c.Close()
+	x, y := c.IntVar("x"), c.IntVar("y")
+	c.Assert(x.Eq(c.IntVal(2)).And(y.Eq(c.IntVal(1))))
+	if st, err := c.Check(); st != smt.StatusSat || err != nil {
+		t.Fatalf("Check() = %s, %v; want sat", st, err)
+	}
+	pow := func(b *smt.Term, e int64) *smt.Term { return b.Pow(smt.IntConst(big.NewInt(e))) }
+	tests := []struct {
+		t    *smt.Term
+		want string // 値。"error:" で始まる場合はエラーの内容
+	}{
+		{pow(x, 10), "1024"},
+		{pow(x, 0), "1"},
+		{pow(x, 100), new(big.Int).Lsh(big.NewInt(1), 100).String()},
+		{pow(x.ToReal(), -3), "1/8"},
+		{pow(c.NumVal("0.5"), 4), "1/16"},
+		// 底が 1 の累乗は指数が大きくても計算できる
+		{pow(y, 1<<62), "1"},
+		{pow(y.Neg(), 1<<62+1), "-1"},
+		{pow(x, 1<<40), "error:too large"},
+		{pow(x.ToReal(), -(1 << 40)), "error:too large"},
+	}
+	for _, tt := range tests {
+		v, err := c.Eval(tt.t)
+		switch {
+		case strings.HasPrefix(tt.want, "error:"):
+			if err == nil || !strings.Contains(err.Error(), strings.TrimPrefix(tt.want, "error:")) {
+				t.Errorf("Eval(%s): error = %v; want %s", tt.t, err, tt.want)
+			}
+		case err != nil:
+			t.Errorf("Eval(%s): %v", tt.t, err)
+		case v.Int != nil && v.Int.String() != tt.want, v.Rat != nil && v.Rat.RatString() != tt.want:
+			t.Errorf("Eval(%s) = %s; want %s", tt.t, v.Text, tt.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package smt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Problem は Context に蓄積された問題を表す構造体型
+type Problem struct {
+	Vars    []*Term  // 宣言順の制約変数
+	Asserts []*Term  // 宣言順の制約条件
+	Solve   []string // Solve で指定された制約変数の名前。配列は name[i] に展開する
+	Seq     int      // 何番目の Solve から書き出したか（0 から）
+
+	Objective *Objective // 目的関数。なければ nil
+
+	// SetOption、UseTactic、UseLogic で設定したソルバーのオプション、タクティク、ロジック
+	Options []Option
+	Tactics []string
+	Logic   string
+}
+
+// Exporter は問題を他のソルバーの入力形式で書き出す関数の型
+type Exporter func(w io.Writer, p *Problem) error
+
+// 書き出し形式の登録簿
+var (
+	exportersMu sync.Mutex
+	exporters   = map[string]Exporter{}
+)
+
+// RegisterExporter は書き出し形式を名前で登録する関数
+func RegisterExporter(format string, f Exporter) {
+	exportersMu.Lock()
+	defer exportersMu.Unlock()
+	exporters[format] = f
+}
+
+// Exporters は登録されている書き出し形式の名前を返す関数
+func Exporters() []string {
+	exportersMu.Lock()
+	defer exportersMu.Unlock()
+	var names []string
+	for name := range exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetExport は Solve で問題を解決する代わりに、形式 format で w に書き出すように設定する関数
+func (c *Context) SetExport(format string, w io.Writer) error {
+	exportersMu.Lock()
+	f, ok := exporters[format]
+	exportersMu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown export format %q (available: %s)", format, strings.Join(Exporters(), ", "))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.exporter, c.exportTo = f, w
+	return nil
+}
+
+// Snapshot はこれまでに宣言された制約変数と制約条件を返す関数。
+// names には Solve で指定する制約変数の名前を指定する。
+func (c *Context) Snapshot(names ...string) *Problem {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.problem(names)
+}
+
+// problem は Snapshot の本体。呼び出し側でロックを取得していること。
+func (c *Context) problem(names []string) *Problem {
+	p := &Problem{
+		Asserts: append([]*Term{}, c.asserts...),
+		Solve:   c.expand(names),
+		Seq:     c.exported,
+
+		Objective: c.objective,
+
+		Options: append([]Option{}, c.options...),
+		Tactics: append([]string{}, c.tactics...),
+		Logic:   c.logic,
+	}
+	for _, name := range c.names {
+		p.Vars = append(p.Vars, c.vars[name])
+	}
+	return p
+}
+
+// expand は制約変数の名前のうち、配列の名前を name[0], name[1], ... に展開する関数
+func (c *Context) expand(names []string) (r []string) {
+	for _, name := range names {
+		if _, ok := c.vars[name]; ok {
+			r = append(r, name)
+			continue
+		}
+		for i := 0; ; i++ {
+			idxName := fmt.Sprintf("%s[%d]", name, i)
+			if _, ok := c.vars[idxName]; !ok {
+				break
+			}
+			r = append(r, idxName)
+		}
+	}
+	return
+}
+
+// OnExportError は Solve と SolveAll が問題を書き出せなかった場合に、ロックを解放した後に
+// そのエラーを渡して呼び出す関数を設定する関数。書き出しに失敗したらプログラムを終了する場合などに使う。
+func (c *Context) OnExportError(f func(err error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onExportError = f
+}
+
+// export は Solve の代わりに問題を書き出す関数。呼び出し側でロックを取得していること。
+// 書き出しに失敗した場合に途中までの内容を残さないよう、すべて書き出せたときにだけ出力先に書き込む。
+func (c *Context) export(names []string) error {
+	if c.err != nil {
+		return c.err
+	}
+	var b bytes.Buffer
+	err := c.exporter(&b, c.problem(names))
+	c.exported++
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteTo(c.exportTo)
+	return err
+}
+
+// exportSolve は Solve と SolveAll の代わりに問題を書き出し、エラーを標準エラー出力に表示する関数。
+// エラーは OnExportError で設定した関数に渡すために記録する。呼び出し側でロックを取得していること。
+func (c *Context) exportSolve(names []string) {
+	if err := c.export(names); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		c.exportErr = err
+	}
+}
+
+// notifyExportError は直前の書き出しに失敗していれば OnExportError で設定した関数を呼び出す関数。
+// 呼び出し側でロックを取得していないこと。
+func (c *Context) notifyExportError() {
+	c.mu.Lock()
+	err, f := c.exportErr, c.onExportError
+	c.exportErr = nil
+	c.mu.Unlock()
+	if err != nil && f != nil {
+		f(err)
+	}
+}
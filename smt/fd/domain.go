@@ -0,0 +1,245 @@
+package fd
+
+import "math"
+
+// 区間の端点として使う無限大
+const (
+	inf  = math.MaxInt64
+	ninf = math.MinInt64
+)
+
+// smallDomain はこの要素数以下になった領域を値の列で保持する
+const smallDomain = 4096
+
+// domain は制約変数が取りうる値の集合（領域）を表す構造体型。
+// vals が nil の場合は区間 [lo, hi] のすべての整数を表す。
+// vals は共有されるので、変更するときは新しいスライスを作ること。
+type domain struct {
+	lo, hi int64
+	vals   []int64 // 昇順
+}
+
+// newDomain は区間 [lo, hi] の領域を作成する関数
+func newDomain(lo, hi int64) domain {
+	d := domain{lo: lo, hi: hi}
+	d.materialize()
+	return d
+}
+
+// empty は領域が空かどうかを調べる関数
+func (d *domain) empty() bool {
+	return d.lo > d.hi
+}
+
+// fixed は領域の要素が一つだけかどうかを調べる関数
+func (d *domain) fixed() bool {
+	return d.lo == d.hi
+}
+
+// bounded は領域が有限かどうかを調べる関数
+func (d *domain) bounded() bool {
+	return d.lo != ninf && d.hi != inf
+}
+
+// size は領域の要素数を返す関数。無限の場合は math.MaxUint64 を返す。
+func (d *domain) size() uint64 {
+	switch {
+	case d.empty():
+		return 0
+	case d.vals != nil:
+		return uint64(len(d.vals))
+	case !d.bounded():
+		return math.MaxUint64
+	}
+	return uint64(d.hi-d.lo) + 1
+}
+
+// materialize は要素数が少ない区間を値の列に変換する関数
+func (d *domain) materialize() {
+	if d.vals != nil || d.empty() || d.size() > smallDomain {
+		return
+	}
+	d.vals = make([]int64, 0, d.size())
+	for v := d.lo; ; v++ {
+		d.vals = append(d.vals, v)
+		if v == d.hi {
+			break
+		}
+	}
+}
+
+// contains は値 v が領域に含まれるかどうかを調べる関数
+func (d *domain) contains(v int64) bool {
+	if v < d.lo || v > d.hi {
+		return false
+	}
+	if d.vals == nil {
+		return true
+	}
+	for _, x := range d.vals {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// restrict は領域を区間 [lo, hi] との共通部分に狭める関数。
+// 領域が変化した場合は true を返す。
+func (d *domain) restrict(lo, hi int64) bool {
+	if lo <= d.lo && hi >= d.hi {
+		return false
+	}
+	if d.vals == nil {
+		if lo > d.lo {
+			d.lo = lo
+		}
+		if hi < d.hi {
+			d.hi = hi
+		}
+		d.materialize()
+		return true
+	}
+	return d.filter(func(v int64) bool { return lo <= v && v <= hi })
+}
+
+// remove は値 v を領域から取り除く関数。領域が変化した場合は true を返す。
+// 値の列で保持していない大きな領域では、端点の値だけを取り除く。
+func (d *domain) remove(v int64) bool {
+	if !d.contains(v) {
+		return false
+	}
+	if d.vals == nil {
+		switch v {
+		case d.lo:
+			d.lo++
+		case d.hi:
+			d.hi--
+		default:
+			return false
+		}
+		d.materialize()
+		return true
+	}
+	return d.filter(func(x int64) bool { return x != v })
+}
+
+// filter は条件 keep を満たす値だけを残す関数
+func (d *domain) filter(keep func(int64) bool) bool {
+	var vals []int64
+	for _, v := range d.vals {
+		if keep(v) {
+			vals = append(vals, v)
+		}
+	}
+	if len(vals) == len(d.vals) {
+		return false
+	}
+	d.vals = vals
+	if len(vals) == 0 {
+		d.lo, d.hi = 1, 0
+	} else {
+		d.lo, d.hi = vals[0], vals[len(vals)-1]
+	}
+	return true
+}
+
+// values は値の列を返す関数。区間で保持している場合は nil を返す。
+func (d *domain) values() []int64 {
+	return d.vals
+}
+
+// addSat は無限大を考慮し、桁あふれを飽和させる加算
+func addSat(x, y int64) int64 {
+	switch {
+	case x == inf || x == ninf:
+		return x
+	case y == inf || y == ninf:
+		return y
+	}
+	r := x + y
+	if x > 0 && y > 0 && r < 0 {
+		return inf
+	}
+	if x < 0 && y < 0 && r >= 0 {
+		return ninf
+	}
+	return r
+}
+
+// negSat は無限大を考慮した符号反転
+func negSat(x int64) int64 {
+	switch x {
+	case inf:
+		return ninf
+	case ninf:
+		return inf
+	}
+	return -x
+}
+
+// mulSat は無限大を考慮し、桁あふれを飽和させる乗算
+func mulSat(x, y int64) int64 {
+	if x == 0 || y == 0 {
+		return 0
+	}
+	var sign int64 = inf
+	if (x < 0) != (y < 0) {
+		sign = ninf
+	}
+	if x == inf || x == ninf || y == inf || y == ninf {
+		return sign
+	}
+	r := x * y
+	if r/y != x || (x == -1 && y == ninf) || (y == -1 && x == ninf) {
+		return sign
+	}
+	return r
+}
+
+// powSat は無限大を考慮し、桁あふれを飽和させるべき乗。e は非負であること。
+func powSat(x, e int64) int64 {
+	switch {
+	case e == 0 || x == 1:
+		return 1
+	case x == 0:
+		return 0
+	case x == -1:
+		if e%2 == 0 {
+			return 1
+		}
+		return -1
+	}
+	// |x| >= 2 なので 64 回以内に飽和する
+	r := int64(1)
+	for i := int64(0); i < e && r != inf && r != ninf; i++ {
+		r = mulSat(r, x)
+	}
+	return r
+}
+
+// euclidDiv は Z3 と同じく剰余が非負となる整数除算
+func euclidDiv(x, y int64) int64 {
+	q, r := x/y, x%y
+	if r < 0 {
+		if y > 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
+
+// euclidMod は Z3 と同じく非負となる剰余
+func euclidMod(x, y int64) int64 {
+	r := x % y
+	if r < 0 {
+		if y > 0 {
+			r += y
+		} else {
+			r -= y
+		}
+	}
+	return r
+}
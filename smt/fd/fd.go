@@ -0,0 +1,237 @@
+// Package fd は有限領域の Int と Bool の制約を Go だけで解決する smt パッケージのバックエンド。
+// 制約伝播とバックトラックで解を探索するので、Z3 をリンクできない環境でも
+// 数独や8クイーンのような問題を解決できる。
+// インポートすると "fd" という名前でバックエンドが登録される。
+//
+// 整数型の制約変数は Assert(x >= 1 && x <= 9) のような制約で有限の範囲に
+// 限定されている必要がある。Num（実数）はサポートしない。
+package fd
+
+import (
+	"fmt"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+func init() {
+	smt.RegisterBackend("fd", func() (smt.Backend, error) {
+		return New(), nil
+	})
+}
+
+// maxRounds は一度の制約伝播で制約を走査する回数の上限。
+// 上限に達しても解の検査は葉で厳密に行うので、結果は正しい。
+const maxRounds = 1000
+
+// variable は宣言された制約変数を表す構造体型
+type variable struct {
+	name string
+	sort string
+	used bool // 制約に現れるかどうか
+}
+
+// Backend は制約変数と制約条件を保持する構造体型
+type Backend struct {
+	vars  []variable
+	index map[string]int
+	conds []*node
+
+	solved   bool // 直前の Check の後に制約が追加されていないか
+	assumed  bool // 直前の Check が仮定のもとでの CheckAssuming だったか
+	status   smt.Status
+	solution []int64 // 直前の Check で見つけた解
+
+	stop atomic.Bool // Interrupt で探索の中断を求められたか
+}
+
+// New は有限領域のバックエンドを生成する関数
+func New() *Backend {
+	return &Backend{index: map[string]int{}}
+}
+
+// DeclareVar は制約変数を宣言する関数
+func (b *Backend) DeclareVar(name, sort string) error {
+	if sort != smt.SortInt && sort != smt.SortBool {
+		return fmt.Errorf("fd: %s: sort %s is not supported; use the z3 backend", name, sort)
+	}
+	b.index[name] = len(b.vars)
+	b.vars = append(b.vars, variable{name: name, sort: sort})
+	b.solved = false
+	return nil
+}
+
+// Assert は制約条件を追加する関数
+func (b *Backend) Assert(cond *smt.Term) error {
+	n, err := b.compile(cond)
+	if err != nil {
+		return err
+	}
+	b.conds = append(b.conds, n)
+	b.solved = false
+	return nil
+}
+
+// node は制約変数を添字で参照するように変換した項を表す構造体型
+type node struct {
+	op     smt.Op
+	args   []*node
+	v      int   // op が OpVar の場合の制約変数の添字
+	c      int64 // op が OpConst の場合の値。Bool は 0 か 1
+	isBool bool
+}
+
+// compile は項を node に変換する関数
+func (b *Backend) compile(t *smt.Term) (*node, error) {
+	if t.Sort == smt.SortNum {
+		return nil, fmt.Errorf("fd: Num is not supported: %s", t)
+	}
+	n := &node{op: t.Op, isBool: t.Sort == smt.SortBool}
+	switch t.Op {
+	case smt.OpVar:
+		i, ok := b.index[t.Name]
+		if !ok {
+			return nil, fmt.Errorf("fd: undeclared variable %s", t.Name)
+		}
+		b.vars[i].used = true
+		n.v = i
+		return n, nil
+	case smt.OpConst:
+		if n.isBool {
+			if t.Bool {
+				n.c = 1
+			}
+			return n, nil
+		}
+		if !t.Num.Num().IsInt64() {
+			return nil, fmt.Errorf("fd: integer constant out of range: %s", t.Num.Num())
+		}
+		n.c = t.Num.Num().Int64()
+		return n, nil
+	case smt.OpToReal, smt.OpToInt, smt.OpIsInt:
+		return nil, fmt.Errorf("fd: operator %s is not supported", t.Op)
+	}
+	for _, arg := range t.Args {
+		a, err := b.compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		n.args = append(n.args, a)
+	}
+	return n, nil
+}
+
+// Check は制約が解決可能かどうかを調べる関数
+func (b *Backend) Check() (smt.Status, error) {
+	if b.solved && !b.assumed {
+		return b.status, nil
+	}
+	b.assumed = false
+	return b.check(b.conds)
+}
+
+// CheckAssuming は lits の制約条件を一時的に加えて、制約が解決可能かどうかを調べる関数
+func (b *Backend) CheckAssuming(lits []*smt.Term) (smt.Status, error) {
+	// 仮定にだけ現れる変数は、次の Check では制約に現れない変数として扱う
+	used := make([]bool, len(b.vars))
+	for i, v := range b.vars {
+		used[i] = v.used
+	}
+	defer func() {
+		for i := range b.vars {
+			b.vars[i].used = used[i]
+		}
+	}()
+
+	conds := append([]*node{}, b.conds...)
+	for _, t := range lits {
+		n, err := b.compile(t)
+		if err != nil {
+			return smt.StatusUnknown, err
+		}
+		conds = append(conds, n)
+	}
+	b.assumed = true
+	return b.check(conds)
+}
+
+// check は conds の制約条件を満たす解を探す関数
+func (b *Backend) check(conds []*node) (smt.Status, error) {
+	b.stop.Store(false)
+	s := &solver{conds: conds, doms: make([]domain, len(b.vars)), stop: &b.stop}
+	for i, v := range b.vars {
+		if v.sort == smt.SortBool {
+			s.doms[i] = newDomain(0, 1)
+		} else {
+			s.doms[i] = newDomain(ninf, inf)
+		}
+	}
+
+	// 最初の制約伝播で変数の範囲を求める
+	b.status, b.solution = smt.StatusUnsat, nil
+	if s.propagate() {
+		for i, v := range b.vars {
+			d := &s.doms[i]
+			if v.used && !d.bounded() {
+				return smt.StatusUnknown, fmt.Errorf("fd: cannot find a finite domain for %s; add bounds such as Assert(%s >= 0 && %s < 10)", v.name, v.name, v.name)
+			}
+			if !v.used {
+				// 制約に現れない変数は 0 に近い値とする
+				d.restrict(closestToZero(d), closestToZero(d))
+			}
+		}
+		found := s.search()
+		if b.stop.Load() {
+			// 中断された場合は判定できない。次の Check で探索し直す
+			b.status, b.solution = smt.StatusUnknown, nil
+			return b.status, nil
+		}
+		if found {
+			b.status = smt.StatusSat
+			b.solution = make([]int64, len(s.doms))
+			for i := range s.doms {
+				b.solution[i] = s.doms[i].lo
+			}
+		}
+	}
+	b.solved = true
+	return b.status, nil
+}
+
+// Interrupt は実行中の Check の探索を中断する関数。別のゴルーチンから呼び出してよい。
+func (b *Backend) Interrupt() {
+	b.stop.Store(true)
+}
+
+// closestToZero は領域のうち 0 に最も近い値を返す関数
+func closestToZero(d *domain) int64 {
+	switch {
+	case d.lo > 0:
+		return d.lo
+	case d.hi < 0:
+		return d.hi
+	}
+	return 0
+}
+
+// Model は宣言されたすべての制約変数の値を返す関数
+func (b *Backend) Model() (map[string]smt.Value, error) {
+	if !b.solved || b.status != smt.StatusSat {
+		return nil, fmt.Errorf("fd: no model")
+	}
+	values := map[string]smt.Value{}
+	for i, v := range b.vars {
+		if v.sort == smt.SortBool {
+			values[v.name] = smt.NewBoolValue(b.solution[i] == 1)
+		} else {
+			values[v.name] = smt.NewIntValue(big.NewInt(b.solution[i]))
+		}
+	}
+	return values, nil
+}
+
+// Close は何もしない。Backend インタフェースを満たすための関数。
+func (b *Backend) Close() error {
+	return nil
+}
@@ -0,0 +1,302 @@
+package fd
+
+import (
+	"math"
+	"math/big"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+func TestPrune(t *testing.T) {
+	// x は [-3, 3] の整数、p は Bool。want となるように刈り込んだ後の x と p の領域を調べる
+	tests := []struct {
+		name         string
+		cond         func(x, p *smt.Term) *smt.Term
+		want         bool
+		p            domain // p の最初の領域
+		ok           bool
+		wantX, wantP [2]int64
+	}{
+		{"Or with the other disjunct false", func(x, p *smt.Term) *smt.Term { return ltZero(x).Or(p) }, true, newDomain(0, 0), true, [2]int64{-3, -1}, [2]int64{0, 0}},
+		{"Or with one disjunct", func(x, p *smt.Term) *smt.Term { return ltZero(x).Or() }, true, newDomain(0, 1), true, [2]int64{-3, -1}, [2]int64{0, 1}},
+		{"Or with two open disjuncts", func(x, p *smt.Term) *smt.Term { return ltZero(x).Or(p) }, true, newDomain(0, 1), true, [2]int64{-3, 3}, [2]int64{0, 1}},
+		{"Or already true", func(x, p *smt.Term) *smt.Term { return ltZero(x).Or(p) }, true, newDomain(1, 1), true, [2]int64{-3, 3}, [2]int64{1, 1}},
+		{"Or that cannot be true", func(x, p *smt.Term) *smt.Term { return x.Gt(smt.IntConst(big.NewInt(5))).Or(p) }, true, newDomain(0, 0), false, [2]int64{}, [2]int64{}},
+		{"false Or", func(x, p *smt.Term) *smt.Term { return ltZero(x).Or(p) }, false, newDomain(0, 1), true, [2]int64{0, 3}, [2]int64{0, 0}},
+		{"true And", func(x, p *smt.Term) *smt.Term { return ltZero(x).And(p) }, true, newDomain(0, 1), true, [2]int64{-3, -1}, [2]int64{1, 1}},
+		{"false And with the other conjunct true", func(x, p *smt.Term) *smt.Term { return ltZero(x).And(p) }, false, newDomain(1, 1), true, [2]int64{0, 3}, [2]int64{1, 1}},
+		{"false And with one conjunct", func(x, p *smt.Term) *smt.Term { return ltZero(x).And() }, false, newDomain(0, 1), true, [2]int64{0, 3}, [2]int64{0, 1}},
+		{"false And with two open conjuncts", func(x, p *smt.Term) *smt.Term { return ltZero(x).And(p) }, false, newDomain(0, 1), true, [2]int64{-3, 3}, [2]int64{0, 1}},
+	}
+	for _, tt := range tests {
+		b := New()
+		c := smt.NewContext(b)
+		n, err := b.compile(tt.cond(c.IntVar("x"), c.BoolVar("p")))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		s := &solver{doms: []domain{newDomain(-3, 3), tt.p}}
+		_, ok := s.prune(n, tt.want)
+		switch {
+		case ok != tt.ok:
+			t.Errorf("%s: prune ok = %v; want %v", tt.name, ok, tt.ok)
+		case !ok:
+		case s.doms[0].lo != tt.wantX[0] || s.doms[0].hi != tt.wantX[1]:
+			t.Errorf("%s: x in [%d, %d]; want [%d, %d]", tt.name, s.doms[0].lo, s.doms[0].hi, tt.wantX[0], tt.wantX[1])
+		case s.doms[1].lo != tt.wantP[0] || s.doms[1].hi != tt.wantP[1]:
+			t.Errorf("%s: p in [%d, %d]; want [%d, %d]", tt.name, s.doms[1].lo, s.doms[1].hi, tt.wantP[0], tt.wantP[1])
+		}
+		c.Close()
+	}
+}
+
+// ltZero は x < 0 の項を返す関数
+func ltZero(x *smt.Term) *smt.Term {
+	return x.Lt(smt.IntConst(big.NewInt(0)))
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		src  func(c *smt.Context)
+		want smt.Status
+	}{
+		{"Or under And", func(c *smt.Context) {
+			v := c.IntVar("v")
+			c.Assert(v.Ge(c.IntVal(-3)).And(v.Lt(c.IntVal(4))))
+			c.Assert(c.IntVal(1).Eq(c.IntVal(3)).Not().Or(c.IntVal(5).Gt(v)).And(v.Div(c.IntVal(2)).Neg().Ge(c.IntVal(1).Mul(v.Neg()))))
+		}, smt.StatusSat},
+		{"unit clause", func(c *smt.Context) {
+			p1, p2, p3 := c.BoolVar("p1"), c.BoolVar("p2"), c.BoolVar("p3")
+			c.Assert(p1.Not().Or(p2, p3.Not()))
+			c.Assert(p1.Not().Or())
+		}, smt.StatusSat},
+		{"pigeonhole", func(c *smt.Context) {
+			var xs []*smt.Term
+			for _, name := range []string{"a", "b", "c", "d"} {
+				x := c.IntVar(name)
+				c.Assert(x.Ge(c.IntVal(1)).And(x.Le(c.IntVal(3))))
+				xs = append(xs, x)
+			}
+			c.Assert(xs[0].Distinct(xs[1:]...))
+		}, smt.StatusUnsat},
+		{"negative mod", func(c *smt.Context) {
+			x := c.IntVar("x")
+			c.Assert(x.Ge(c.IntVal(-10)).And(x.Le(c.IntVal(-1))))
+			c.Assert(x.Mod(c.IntVal(-3)).Eq(c.IntVal(2)).And(x.Div(c.IntVal(3)).Eq(c.IntVal(-4))))
+		}, smt.StatusSat},
+	}
+	for _, tt := range tests {
+		c := smt.NewContext(New())
+		tt.src(c)
+		if st, err := c.Check(); st != tt.want || err != nil {
+			t.Errorf("%s: Check() = %s, %v; want %s", tt.name, st, err, tt.want)
+		}
+		c.Close()
+	}
+}
+
+func TestUnbounded(t *testing.T) {
+	c := smt.NewContext(New())
+	defer c.Close()
+	x := c.IntVar("x")
+	c.Assert(x.Gt(c.IntVal(0)))
+	_, err := c.Check()
+	if err == nil || !strings.Contains(err.Error(), "cannot find a finite domain for x") {
+		t.Errorf("Check() error = %v; want a missing bounds error", err)
+	}
+}
+
+func TestSaturation(t *testing.T) {
+	tests := []struct {
+		name      string
+		got, want int64
+	}{
+		{"add overflow", addSat(math.MaxInt64-1, 5), inf},
+		{"add underflow", addSat(math.MinInt64+1, -5), ninf},
+		{"add to -inf", addSat(ninf, 7), ninf},
+		{"mul overflow", mulSat(1<<40, 1<<40), inf},
+		{"mul underflow", mulSat(-(1 << 40), 1<<40), ninf},
+		{"mul by zero", mulSat(inf, 0), 0},
+		{"neg inf", negSat(inf), ninf},
+		{"pow overflow", powSat(2, 70), inf},
+		{"pow of negative", powSat(-2, 3), -8},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %d; want %d", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestEuclid(t *testing.T) {
+	// math/big の DivMod もユークリッド除算
+	for x := int64(-20); x <= 20; x++ {
+		for y := int64(-6); y <= 6; y++ {
+			if y == 0 {
+				continue
+			}
+			q, m := new(big.Int).DivMod(big.NewInt(x), big.NewInt(y), new(big.Int))
+			if euclidDiv(x, y) != q.Int64() || euclidMod(x, y) != m.Int64() {
+				t.Errorf("euclidDiv, euclidMod(%d, %d) = %d, %d; want %s, %s", x, y, euclidDiv(x, y), euclidMod(x, y), q, m)
+			}
+		}
+	}
+}
+
+// randomBound は TestRandom の制約変数の範囲 [-randomBound, randomBound]
+const randomBound = 3
+
+func TestRandom(t *testing.T) {
+	// 乱数で生成した小さな問題の結果を、すべての値の組み合わせを調べた結果と比べる
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 3000; i++ {
+		c := smt.NewContext(New())
+		var vars []*smt.Term
+		for _, name := range []string{"x", "y", "z"} {
+			v := c.IntVar(name)
+			c.Assert(v.Ge(c.IntVal(-randomBound)).And(v.Le(c.IntVal(randomBound))))
+			vars = append(vars, v)
+		}
+		cond, eval := randomBool(r, vars, 3)
+		c.Assert(cond)
+
+		want := smt.StatusUnsat
+		env := make([]int64, len(vars))
+		for k := 0; k < pow7(len(vars)) && want == smt.StatusUnsat; k++ {
+			for j, n := 0, k; j < len(env); j, n = j+1, n/7 {
+				env[j] = int64(n%7) - randomBound
+			}
+			if eval(env) {
+				want = smt.StatusSat
+			}
+		}
+		st, err := c.Check()
+		if err != nil || st != want {
+			t.Fatalf("Check() = %s, %v; want %s for %s", st, err, want, cond)
+		}
+		if st == smt.StatusSat {
+			m, err := c.Model()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for j, v := range vars {
+				n, _ := m.Int(v.Name)
+				env[j] = n.Int64()
+			}
+			if !eval(env) {
+				t.Fatalf("model %v does not satisfy %s", env, cond)
+			}
+		}
+		c.Close()
+	}
+}
+
+// pow7 は 7 の n 乗（範囲 [-3, 3] の n 個の変数の値の組み合わせの数）を返す関数
+func pow7(n int) int {
+	r := 1
+	for i := 0; i < n; i++ {
+		r *= 7
+	}
+	return r
+}
+
+// randomInt は乱数で整数の項と、その項を Go で評価する関数を生成する関数。
+// 0 で割らないように、除数は 0 でない定数とする。
+func randomInt(r *rand.Rand, vars []*smt.Term, depth int) (*smt.Term, func([]int64) int64) {
+	if depth == 0 || r.Intn(3) == 0 {
+		if r.Intn(2) == 0 {
+			i := r.Intn(len(vars))
+			return vars[i], func(env []int64) int64 { return env[i] }
+		}
+		k := int64(r.Intn(9) - 4)
+		return smt.IntConst(big.NewInt(k)), func([]int64) int64 { return k }
+	}
+	a, fa := randomInt(r, vars, depth-1)
+	if r.Intn(3) == 0 {
+		k := int64(r.Intn(7) - 3)
+		if k == 0 {
+			k = 4
+		}
+		kt := smt.IntConst(big.NewInt(k))
+		if r.Intn(2) == 0 {
+			return a.Div(kt), func(env []int64) int64 { return euclidDiv(fa(env), k) }
+		}
+		return a.Mod(kt), func(env []int64) int64 { return euclidMod(fa(env), k) }
+	}
+	b, fb := randomInt(r, vars, depth-1)
+	switch r.Intn(3) {
+	case 0:
+		return a.Add(b), func(env []int64) int64 { return fa(env) + fb(env) }
+	case 1:
+		return a.Sub(b), func(env []int64) int64 { return fa(env) - fb(env) }
+	}
+	return a.Mul(b), func(env []int64) int64 { return fa(env) * fb(env) }
+}
+
+// randomBool は乱数でブール型の項と、その項を Go で評価する関数を生成する関数。
+// 被演算子が一つの And と Or も生成する。
+func randomBool(r *rand.Rand, vars []*smt.Term, depth int) (*smt.Term, func([]int64) bool) {
+	if depth == 0 || r.Intn(3) == 0 {
+		a, fa := randomInt(r, vars, 2)
+		b, fb := randomInt(r, vars, 2)
+		switch r.Intn(4) {
+		case 0:
+			return a.Eq(b), func(env []int64) bool { return fa(env) == fb(env) }
+		case 1:
+			return a.Distinct(b), func(env []int64) bool { return fa(env) != fb(env) }
+		case 2:
+			return a.Lt(b), func(env []int64) bool { return fa(env) < fb(env) }
+		}
+		return a.Ge(b), func(env []int64) bool { return fa(env) >= fb(env) }
+	}
+	a, fa := randomBool(r, vars, depth-1)
+	switch r.Intn(7) {
+	case 0:
+		return a.Not(), func(env []int64) bool { return !fa(env) }
+	case 1:
+		return a.Or(), fa
+	case 2:
+		return a.And(), fa
+	}
+	b, fb := randomBool(r, vars, depth-1)
+	switch r.Intn(4) {
+	case 0:
+		return a.And(b), func(env []int64) bool { return fa(env) && fb(env) }
+	case 1:
+		return a.Or(b), func(env []int64) bool { return fa(env) || fb(env) }
+	case 2:
+		return a.Implies(b), func(env []int64) bool { return !fa(env) || fb(env) }
+	}
+	return a.Xor(b), func(env []int64) bool { return fa(env) != fb(env) }
+}
+
+func TestCheckAssuming(t *testing.T) {
+	c := smt.NewContext(New())
+	defer c.Close()
+	x, y := c.IntVar("x"), c.IntVar("y")
+	c.Assert(x.Ge(c.IntVal(0)).And(x.Le(c.IntVal(5))))
+
+	// 仮定のもとで解決不能でも、仮定を外せば解決可能に戻る
+	if st, err := c.CheckAssuming(x.Gt(c.IntVal(5))); st != smt.StatusUnsat || err != nil {
+		t.Errorf("CheckAssuming(x > 5) = %s, %v; want unsat", st, err)
+	}
+	// y は仮定にだけ現れるので、範囲は仮定から求める
+	if st, err := c.CheckAssuming(y.Eq(x.Add(c.IntVal(2))), x.Eq(c.IntVal(3))); st != smt.StatusSat || err != nil {
+		t.Fatalf("CheckAssuming(y == x + 2, x == 3) = %s, %v; want sat", st, err)
+	}
+	r, err := c.Model()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := r.Int("y"); v.Int64() != 5 {
+		t.Errorf("y = %s under the assumptions; want 5", v)
+	}
+	// 仮定を外した Check では y は制約に現れない変数に戻る
+	if st, err := c.Check(); st != smt.StatusSat || err != nil {
+		t.Errorf("Check() = %s, %v after CheckAssuming; want sat", st, err)
+	}
+}
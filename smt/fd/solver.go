@@ -0,0 +1,549 @@
+package fd
+
+import (
+	"sync/atomic"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+// solver は探索中の変数の領域を保持する構造体型
+type solver struct {
+	conds []*node
+	doms  []domain
+	stop  *atomic.Bool // 真になったら探索を中断する
+}
+
+// ival は項の値の範囲を表す区間。Bool は偽を 0、真を 1 とする。
+type ival struct {
+	lo, hi int64
+}
+
+// 真理値の区間
+var (
+	valFalse   = ival{0, 0}
+	valTrue    = ival{1, 1}
+	valUnknown = ival{0, 1}
+	valAny     = ival{ninf, inf}
+)
+
+// boolVal は真理値の区間を返す関数
+func boolVal(b bool) ival {
+	if b {
+		return valTrue
+	}
+	return valFalse
+}
+
+// fixed は区間の値が一つに定まっているかどうかを調べる関数
+func (v ival) fixed() bool {
+	return v.lo == v.hi
+}
+
+// eval は現在の領域のもとで項が取りうる値の区間を求める関数
+func (s *solver) eval(n *node) ival {
+	switch n.op {
+	case smt.OpVar:
+		d := &s.doms[n.v]
+		return ival{d.lo, d.hi}
+	case smt.OpConst:
+		return ival{n.c, n.c}
+	}
+
+	args := make([]ival, len(n.args))
+	for i, arg := range n.args {
+		args[i] = s.eval(arg)
+	}
+	x := args[0]
+
+	switch n.op {
+	case smt.OpAdd:
+		for _, y := range args[1:] {
+			x = ival{addSat(x.lo, y.lo), addSat(x.hi, y.hi)}
+		}
+		return x
+	case smt.OpSub:
+		for _, y := range args[1:] {
+			x = ival{addSat(x.lo, negSat(y.hi)), addSat(x.hi, negSat(y.lo))}
+		}
+		return x
+	case smt.OpNeg:
+		return ival{negSat(x.hi), negSat(x.lo)}
+	case smt.OpMul:
+		for _, y := range args[1:] {
+			x = hull(mulSat(x.lo, y.lo), mulSat(x.lo, y.hi), mulSat(x.hi, y.lo), mulSat(x.hi, y.hi))
+		}
+		return x
+	case smt.OpDiv:
+		y := args[1]
+		if !y.fixed() || y.lo == 0 {
+			return valAny
+		}
+		if !x.bounded() {
+			return valAny
+		}
+		// 除数を固定すると商は被除数について単調
+		return hull(euclidDiv(x.lo, y.lo), euclidDiv(x.hi, y.lo))
+	case smt.OpMod:
+		y := args[1]
+		switch {
+		case y.fixed() && y.lo != 0 && x.fixed() && x.bounded():
+			r := euclidMod(x.lo, y.lo)
+			return ival{r, r}
+		case y.lo > 0 && y.hi != inf:
+			return ival{0, y.hi - 1}
+		case y.hi < 0 && y.lo != ninf:
+			return ival{0, -y.lo - 1}
+		}
+		return ival{0, inf}
+	case smt.OpPow:
+		e := args[1]
+		if !e.fixed() || e.lo < 0 {
+			return valAny
+		}
+		lo, hi := powSat(x.lo, e.lo), powSat(x.hi, e.lo)
+		if e.lo%2 == 0 && x.lo < 0 && x.hi > 0 {
+			return ival{0, maxInt(lo, hi)}
+		}
+		return hull(lo, hi)
+	case smt.OpLt:
+		return compare(x.hi < args[1].lo, x.lo >= args[1].hi)
+	case smt.OpLe:
+		return compare(x.hi <= args[1].lo, x.lo > args[1].hi)
+	case smt.OpGt:
+		return compare(x.lo > args[1].hi, x.hi <= args[1].lo)
+	case smt.OpGe:
+		return compare(x.lo >= args[1].hi, x.hi < args[1].lo)
+	case smt.OpEq, smt.OpIff:
+		return s.evalEq(n.args[0], n.args[1], x, args[1])
+	case smt.OpDistinct:
+		all := true
+		for i := range args {
+			all = all && args[i].fixed()
+			for j := i + 1; j < len(args); j++ {
+				if args[i].fixed() && args[j].fixed() && args[i].lo == args[j].lo {
+					return valFalse
+				}
+			}
+		}
+		if all {
+			return valTrue
+		}
+		return valUnknown
+	case smt.OpNot:
+		return ival{1 - x.hi, 1 - x.lo}
+	case smt.OpAnd:
+		for _, y := range args[1:] {
+			x = ival{minInt(x.lo, y.lo), minInt(x.hi, y.hi)}
+		}
+		return x
+	case smt.OpOr:
+		for _, y := range args[1:] {
+			x = ival{maxInt(x.lo, y.lo), maxInt(x.hi, y.hi)}
+		}
+		return x
+	case smt.OpXor:
+		v := s.evalEq(n.args[0], n.args[1], x, args[1])
+		return ival{1 - v.hi, 1 - v.lo}
+	case smt.OpImplies:
+		return ival{maxInt(1-x.hi, args[1].lo), maxInt(1-x.lo, args[1].hi)}
+	case smt.OpIte:
+		switch x {
+		case valTrue:
+			return args[1]
+		case valFalse:
+			return args[2]
+		}
+		return ival{minInt(args[1].lo, args[2].lo), maxInt(args[1].hi, args[2].hi)}
+	}
+	return valAny
+}
+
+// evalEq は等式 a == b の真理値の区間を求める関数
+func (s *solver) evalEq(a, b *node, x, y ival) ival {
+	switch {
+	case x.fixed() && y.fixed():
+		return boolVal(x.lo == y.lo)
+	case x.hi < y.lo || y.hi < x.lo:
+		return valFalse
+	case a.op == smt.OpVar && y.fixed() && !s.doms[a.v].contains(y.lo):
+		return valFalse
+	case b.op == smt.OpVar && x.fixed() && !s.doms[b.v].contains(x.lo):
+		return valFalse
+	}
+	return valUnknown
+}
+
+// compare は比較の結果が確定して真か、確定して偽かから真理値の区間を返す関数
+func compare(isTrue, isFalse bool) ival {
+	switch {
+	case isTrue:
+		return valTrue
+	case isFalse:
+		return valFalse
+	}
+	return valUnknown
+}
+
+// bounded は区間が有限かどうかを調べる関数
+func (v ival) bounded() bool {
+	return v.lo != ninf && v.hi != inf
+}
+
+// hull は値の集まりを含む最小の区間を返す関数
+func hull(vs ...int64) ival {
+	r := ival{vs[0], vs[0]}
+	for _, v := range vs[1:] {
+		r.lo, r.hi = minInt(r.lo, v), maxInt(r.hi, v)
+	}
+	return r
+}
+
+func minInt(x, y int64) int64 {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+func maxInt(x, y int64) int64 {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+// propagate はすべての制約を満たさない値を領域から取り除く関数。
+// 矛盾が見つかった場合は false を返す。
+func (s *solver) propagate() bool {
+	for round := 0; round < maxRounds; round++ {
+		changed := false
+		for _, c := range s.conds {
+			switch s.eval(c) {
+			case valFalse:
+				return false
+			case valTrue:
+				continue
+			}
+			ch, ok := s.prune(c, true)
+			if !ok {
+				return false
+			}
+			changed = changed || ch
+		}
+		if !changed {
+			break
+		}
+	}
+	return true
+}
+
+// prune は Bool の項 n が want となるように領域を狭める関数。
+// 領域が変化した場合は changed が、矛盾した場合は ok が false となる。
+func (s *solver) prune(n *node, want bool) (changed, ok bool) {
+	switch n.op {
+	case smt.OpVar, smt.OpConst:
+		return s.narrow(n, boolVal(want))
+	case smt.OpNot:
+		return s.prune(n.args[0], !want)
+	case smt.OpAnd, smt.OpOr:
+		// want が真の And と偽の Or はすべての被演算子に伝播する
+		if (n.op == smt.OpAnd) == want {
+			return s.pruneAll(n.args, want)
+		}
+		return s.pruneLast(n.args, want)
+	case smt.OpImplies:
+		if !want {
+			return s.pruneAll([]*node{n.args[0], n.args[1].negated()}, true)
+		}
+		switch {
+		case s.eval(n.args[0]) == valTrue:
+			return s.prune(n.args[1], true)
+		case s.eval(n.args[1]) == valFalse:
+			return s.prune(n.args[0], false)
+		}
+	case smt.OpEq, smt.OpIff:
+		return s.pruneEq(n.args[0], n.args[1], want)
+	case smt.OpXor:
+		return s.pruneEq(n.args[0], n.args[1], !want)
+	case smt.OpLt, smt.OpLe, smt.OpGt, smt.OpGe:
+		// a > b と a >= b は b < a と b <= a に読み替える
+		a, b := n.args[0], n.args[1]
+		if n.op == smt.OpGt || n.op == smt.OpGe {
+			a, b = b, a
+		}
+		strict := n.op == smt.OpLt || n.op == smt.OpGt
+		if want {
+			return s.pruneLess(a, b, strict)
+		}
+		// a < b の否定は b <= a、a <= b の否定は b < a
+		return s.pruneLess(b, a, !strict)
+	case smt.OpDistinct:
+		if want {
+			return s.pruneDistinct(n.args)
+		}
+	case smt.OpIte:
+		switch s.eval(n.args[0]) {
+		case valTrue:
+			return s.prune(n.args[1], want)
+		case valFalse:
+			return s.prune(n.args[2], want)
+		}
+	}
+	return false, true
+}
+
+// negated は Bool の項の否定を返す関数
+func (n *node) negated() *node {
+	return &node{op: smt.OpNot, args: []*node{n}, isBool: true}
+}
+
+// pruneAll はすべての項が want となるように領域を狭める関数
+func (s *solver) pruneAll(ns []*node, want bool) (changed, ok bool) {
+	for _, n := range ns {
+		ch, ok := s.prune(n, want)
+		if !ok {
+			return false, false
+		}
+		changed = changed || ch
+	}
+	return changed, true
+}
+
+// pruneLast は少なくとも一つの項が want となる制約について、
+// want となりうる項が一つだけ残っている場合にその項を want とする関数
+func (s *solver) pruneLast(ns []*node, want bool) (changed, ok bool) {
+	var last *node
+	for _, n := range ns {
+		if s.eval(n) != boolVal(!want) {
+			if last != nil {
+				return false, true
+			}
+			last = n
+		}
+	}
+	if last == nil {
+		return false, false
+	}
+	return s.prune(last, want)
+}
+
+// pruneEq は等式 a == b が want となるように領域を狭める関数
+func (s *solver) pruneEq(a, b *node, want bool) (changed, ok bool) {
+	x, y := s.eval(a), s.eval(b)
+	if want {
+		ch1, ok := s.narrow(a, y)
+		if !ok {
+			return false, false
+		}
+		ch2, ok := s.narrow(b, s.eval(a))
+		return ch1 || ch2, ok
+	}
+	switch {
+	case y.fixed() && a.op == smt.OpVar:
+		return s.removeValue(a.v, y.lo)
+	case x.fixed() && b.op == smt.OpVar:
+		return s.removeValue(b.v, x.lo)
+	case y.fixed() && a.isBool:
+		return s.prune(a, y.lo == 0)
+	case x.fixed() && b.isBool:
+		return s.prune(b, x.lo == 0)
+	}
+	return false, true
+}
+
+// pruneLess は a < b（strict が真の場合）または a <= b が成り立つように領域を狭める関数
+func (s *solver) pruneLess(a, b *node, strict bool) (changed, ok bool) {
+	off := int64(0)
+	if strict {
+		off = 1
+	}
+	x, y := s.eval(a), s.eval(b)
+	ch1, ok := s.narrow(a, ival{ninf, addSat(y.hi, -off)})
+	if !ok {
+		return false, false
+	}
+	ch2, ok := s.narrow(b, ival{addSat(x.lo, off), inf})
+	return ch1 || ch2, ok
+}
+
+// pruneDistinct は値の定まった項の値を、他の変数の領域から取り除く関数
+func (s *solver) pruneDistinct(ns []*node) (changed, ok bool) {
+	for i, n := range ns {
+		v := s.eval(n)
+		if !v.fixed() {
+			continue
+		}
+		for j, m := range ns {
+			if i == j || m.op != smt.OpVar {
+				continue
+			}
+			ch, ok := s.removeValue(m.v, v.lo)
+			if !ok {
+				return false, false
+			}
+			changed = changed || ch
+		}
+	}
+	return changed, true
+}
+
+// removeValue は変数 i の領域から値 v を取り除く関数
+func (s *solver) removeValue(i int, v int64) (changed, ok bool) {
+	d := &s.doms[i]
+	changed = d.remove(v)
+	return changed, !d.empty()
+}
+
+// narrow は項 n の値が区間 r に含まれるように領域を狭める関数。
+// 和、差、符号反転、定数倍は被演算子の区間に分配する。
+func (s *solver) narrow(n *node, r ival) (changed, ok bool) {
+	x := s.eval(n)
+	if r.lo <= x.lo && x.hi <= r.hi {
+		return false, true
+	}
+	if r.hi < x.lo || x.hi < r.lo {
+		return false, false
+	}
+	if n.isBool && n.op != smt.OpVar && r.fixed() {
+		return s.prune(n, r.lo == 1)
+	}
+
+	switch n.op {
+	case smt.OpVar:
+		d := &s.doms[n.v]
+		changed = d.restrict(r.lo, r.hi)
+		return changed, !d.empty()
+	case smt.OpNeg:
+		return s.narrow(n.args[0], ival{negSat(r.hi), negSat(r.lo)})
+	case smt.OpAdd, smt.OpSub:
+		// 各被演算子 a_i について、他の被演算子の区間を差し引いた範囲に狭める
+		for i, arg := range n.args {
+			neg := n.op == smt.OpSub && i > 0
+			rest := ival{0, 0}
+			for j, other := range n.args {
+				if i == j {
+					continue
+				}
+				v := s.eval(other)
+				if n.op == smt.OpSub && j > 0 {
+					v = ival{negSat(v.hi), negSat(v.lo)}
+				}
+				rest = ival{addSat(rest.lo, v.lo), addSat(rest.hi, v.hi)}
+			}
+			t := ival{ninf, inf}
+			if rest.hi != inf && r.lo != ninf {
+				t.lo = addSat(r.lo, negSat(rest.hi))
+			}
+			if rest.lo != ninf && r.hi != inf {
+				t.hi = addSat(r.hi, negSat(rest.lo))
+			}
+			if neg {
+				t = ival{negSat(t.hi), negSat(t.lo)}
+			}
+			ch, ok := s.narrow(arg, t)
+			if !ok {
+				return false, false
+			}
+			changed = changed || ch
+		}
+		return changed, true
+	case smt.OpMul:
+		// 定数倍 c * a の場合だけ a に分配する
+		if len(n.args) != 2 {
+			break
+		}
+		a, c := n.args[0], s.eval(n.args[1])
+		if !c.fixed() {
+			a, c = n.args[1], s.eval(n.args[0])
+		}
+		if !c.fixed() || c.lo == 0 || !c.bounded() {
+			break
+		}
+		t := ival{ninf, inf}
+		if r.lo != ninf {
+			t.lo = ceilDiv(r.lo, c.lo)
+		}
+		if r.hi != inf {
+			t.hi = floorDiv(r.hi, c.lo)
+		}
+		if c.lo < 0 {
+			t = ival{ninf, inf}
+			if r.hi != inf {
+				t.lo = ceilDiv(r.hi, c.lo)
+			}
+			if r.lo != ninf {
+				t.hi = floorDiv(r.lo, c.lo)
+			}
+		}
+		return s.narrow(a, t)
+	}
+	return false, true
+}
+
+// floorDiv は商を負の無限大の方向に丸める整数除算
+func floorDiv(x, y int64) int64 {
+	q := x / y
+	if (x%y != 0) && ((x < 0) != (y < 0)) {
+		q--
+	}
+	return q
+}
+
+// ceilDiv は商を正の無限大の方向に丸める整数除算
+func ceilDiv(x, y int64) int64 {
+	q := x / y
+	if (x%y != 0) && ((x < 0) == (y < 0)) {
+		q++
+	}
+	return q
+}
+
+// search はバックトラックで解を探索する関数。
+// 解が見つかった場合は s.doms にその値が残る。
+func (s *solver) search() bool {
+	if s.stop.Load() || !s.propagate() {
+		return false
+	}
+
+	// 領域が最小の未確定の変数を選ぶ
+	best := -1
+	for i := range s.doms {
+		d := &s.doms[i]
+		if !d.fixed() && (best < 0 || d.size() < s.doms[best].size()) {
+			best = i
+		}
+	}
+	if best < 0 {
+		// すべての変数が確定したら、すべての制約を厳密に検査する
+		for _, c := range s.conds {
+			if s.eval(c) != valTrue {
+				return false
+			}
+		}
+		return true
+	}
+
+	saved := append([]domain{}, s.doms...)
+	d := saved[best]
+	if vals := d.values(); vals != nil {
+		for _, v := range vals {
+			s.doms[best].restrict(v, v)
+			if s.search() {
+				return true
+			}
+			copy(s.doms, saved)
+		}
+		return false
+	}
+
+	// 大きな領域は二分する
+	mid := d.lo + (d.hi-d.lo)/2
+	for _, r := range []ival{{d.lo, mid}, {mid + 1, d.hi}} {
+		s.doms[best].restrict(r.lo, r.hi)
+		if s.search() {
+			return true
+		}
+		copy(s.doms, saved)
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package smt
+
+import (
+	"fmt"
+	"os"
+)
+
+// LogicSelector は検出したロジックに合ったソルバーを使えるバックエンドが実装するインタフェース。
+// UseLogic と UseTactic を指定していない場合に、Check の前に DetectLogic の結果を渡す。
+// 制約条件が追加されてロジックが変わると、もう一度呼び出される。
+type LogicSelector interface {
+	SelectLogic(logic string) error
+}
+
+// logicFeatures は制約条件に現れる理論の特徴
+type logicFeatures struct {
+	ints      bool // 整数の項がある
+	reals     bool // 数値の項がある
+	nonlinear bool // 非線形の演算がある
+}
+
+// DetectLogic は制約条件を分類し、SMT-LIB のロジックの名前を返す関数。
+// Bool だけの問題は QF_UF、整数だけの問題は QF_LIA か QF_NIA、数値だけの問題は QF_LRA か QF_NRA、
+// 両方を含む問題は QF_LIRA か QF_NIRA とする。
+// DSL の項には量化子や配列の理論がない（配列は要素ごとの制約変数に展開する）ので、
+// 結果は常に量化子のない（QF_）ロジックになる。
+func DetectLogic(terms []*Term) string {
+	var f logicFeatures
+	for _, t := range terms {
+		f.add(t)
+	}
+	return f.logic()
+}
+
+// add は項の特徴を追加する関数
+func (f *logicFeatures) add(t *Term) {
+	switch t.Sort {
+	case SortInt:
+		f.ints = true
+	case SortNum:
+		f.reals = true
+	}
+	switch t.Op {
+	case OpMul:
+		// 定数でない因子が二つ以上あれば非線形
+		n := 0
+		for _, arg := range t.Args {
+			if !isConstant(arg) {
+				n++
+			}
+		}
+		f.nonlinear = f.nonlinear || n > 1
+	case OpDiv, OpMod:
+		// 定数でない項で割る場合は非線形
+		for _, arg := range t.Args[1:] {
+			f.nonlinear = f.nonlinear || !isConstant(arg)
+		}
+	case OpPow:
+		f.nonlinear = f.nonlinear || !isConstant(t)
+	}
+	for _, arg := range t.Args {
+		f.add(arg)
+	}
+}
+
+// logic は特徴に対応するロジックの名前を返す関数
+func (f *logicFeatures) logic() string {
+	var arith string
+	switch {
+	case f.ints && f.reals:
+		arith = "IRA"
+	case f.ints:
+		arith = "IA"
+	case f.reals:
+		arith = "RA"
+	default:
+		return "QF_UF"
+	}
+	if f.nonlinear {
+		return "QF_N" + arith
+	}
+	return "QF_L" + arith
+}
+
+// isConstant は項が制約変数を含まないかどうかを調べる関数
+func isConstant(t *Term) bool {
+	if t.Op == OpVar {
+		return false
+	}
+	for _, arg := range t.Args {
+		if !isConstant(arg) {
+			return false
+		}
+	}
+	return true
+}
+
+// SetVerbose は検出したロジックなどの詳細を標準エラー出力に表示するかどうかを設定する関数
+func (c *Context) SetVerbose(verbose bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.verbose = verbose
+}
+
+// Logic は直前の Check で検出したロジックを返す関数。
+// UseLogic または UseTactic を指定した場合と、まだ Check していない場合は空文字列を返す。
+func (c *Context) Logic() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.detected
+}
+
+// selectLogic は Check の前に制約条件のロジックを検出し、変わっていればバックエンドに渡す関数。
+// CheckAssuming の仮定はロジックの検出に使わないので、仮定だけが違う Check でソルバーを作成し直すことはない。
+// 呼び出し側でロックを取得していること。
+func (c *Context) selectLogic() error {
+	if c.logic != "" || len(c.tactics) > 0 {
+		// 指定された設定を優先する
+		return nil
+	}
+
+	// 前回の Check の後に追加された制約条件だけを調べる
+	for _, t := range c.asserts[c.analyzed:] {
+		c.features.add(t)
+	}
+	c.analyzed = len(c.asserts)
+	logic := c.features.logic()
+	if logic == c.detected {
+		return nil
+	}
+	c.detected = logic
+	if c.verbose {
+		fmt.Fprintf(os.Stderr, "logic: %s\n", logic)
+	}
+	if ls, ok := c.backend.(LogicSelector); ok {
+		if err := ls.SelectLogic(logic); err != nil {
+			return fmt.Errorf("SelectLogic: %v", err)
+		}
+	}
+	return nil
+}
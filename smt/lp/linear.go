@@ -0,0 +1,384 @@
+package lp
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+// linExpr は線形式 Σ coef[x]·x + c を表す構造体型
+type linExpr struct {
+	coef map[string]*big.Rat
+	c    *big.Rat
+}
+
+// newLinExpr は定数 c の線形式を生成する関数
+func newLinExpr(c *big.Rat) *linExpr {
+	return &linExpr{coef: map[string]*big.Rat{}, c: new(big.Rat).Set(c)}
+}
+
+// addScaled は線形式に k·e を加える関数
+func (l *linExpr) addScaled(e *linExpr, k *big.Rat) {
+	for name, a := range e.coef {
+		s, ok := l.coef[name]
+		if !ok {
+			s = new(big.Rat)
+			l.coef[name] = s
+		}
+		s.Add(s, new(big.Rat).Mul(a, k))
+		if s.Sign() == 0 {
+			delete(l.coef, name)
+		}
+	}
+	l.c.Add(l.c, new(big.Rat).Mul(e.c, k))
+}
+
+// isConst は線形式が定数かどうかを返す関数
+func (l *linExpr) isConst() bool {
+	return len(l.coef) == 0
+}
+
+// nonlinearError は線形でない項を表すエラー型
+type nonlinearError struct {
+	t *smt.Term
+}
+
+func (e *nonlinearError) Error() string {
+	return fmt.Sprintf("nonlinear term %s", e.t)
+}
+
+// linear は Int または Num の項を線形式に変換する関数。
+// 定数倍と定数による除算以外の積と商、剰余、べき乗、ite などは線形でないのでエラーとする。
+func linear(t *smt.Term) (*linExpr, error) {
+	switch t.Op {
+	case smt.OpVar:
+		l := newLinExpr(new(big.Rat))
+		l.coef[t.Name] = big.NewRat(1, 1)
+		return l, nil
+	case smt.OpConst:
+		return newLinExpr(t.Num), nil
+	case smt.OpToReal:
+		return linear(t.Args[0])
+	}
+
+	args := make([]*linExpr, len(t.Args))
+	for i, arg := range t.Args {
+		if arg.Sort == smt.SortBool {
+			return nil, &nonlinearError{t}
+		}
+		l, err := linear(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = l
+	}
+
+	one, minusOne := big.NewRat(1, 1), big.NewRat(-1, 1)
+	l := newLinExpr(new(big.Rat))
+	switch t.Op {
+	case smt.OpAdd:
+		for _, a := range args {
+			l.addScaled(a, one)
+		}
+		return l, nil
+	case smt.OpSub:
+		l.addScaled(args[0], one)
+		for _, a := range args[1:] {
+			l.addScaled(a, minusOne)
+		}
+		return l, nil
+	case smt.OpNeg:
+		l.addScaled(args[0], minusOne)
+		return l, nil
+	case smt.OpMul:
+		// 定数でない因子は一つまで
+		k := big.NewRat(1, 1)
+		var x *linExpr
+		for _, a := range args {
+			switch {
+			case a.isConst():
+				k.Mul(k, a.c)
+			case x == nil:
+				x = a
+			default:
+				return nil, &nonlinearError{t}
+			}
+		}
+		if x == nil {
+			x = newLinExpr(big.NewRat(1, 1))
+		}
+		l.addScaled(x, k)
+		return l, nil
+	case smt.OpDiv:
+		// Int の除算は切り捨てるので線形でない
+		if t.Sort == smt.SortNum && args[1].isConst() && args[1].c.Sign() != 0 {
+			l.addScaled(args[0], new(big.Rat).Inv(args[1].c))
+			return l, nil
+		}
+	}
+	return nil, &nonlinearError{t}
+}
+
+// row は制約の行 expr op rhs を表す構造体型。op は "<=", ">=", "=" のいずれか。
+type row struct {
+	name string
+	expr *linExpr
+	op   string
+	rhs  *big.Rat
+}
+
+// bound は制約変数の下限と上限を表す構造体型。nil は無限大を表す。
+type bound struct {
+	lo, hi *big.Rat
+}
+
+// model は線形計画問題を表す構造体型
+type model struct {
+	vars   []*smt.Term       // 宣言順の制約変数
+	names  map[string]string // 制約変数名と LP/MPS での名前
+	rows   []row
+	bounds map[string]*bound
+	obj    *linExpr
+	sense  string
+}
+
+// build は問題を線形計画問題に変換する関数。
+// 線形でない制約条件は何番目の Assert かを示すエラーとする。
+func build(format string, p *smt.Problem) (*model, error) {
+	if p.Seq > 0 {
+		return nil, fmt.Errorf("%s: only the first Solve can be exported", format)
+	}
+
+	m := &model{names: map[string]string{}, bounds: map[string]*bound{}, sense: smt.SenseMin}
+	used := map[string]bool{}
+	for _, v := range p.Vars {
+		if v.Sort == smt.SortBool {
+			return nil, fmt.Errorf("%s: %s: Bool variables are not supported", format, v.Name)
+		}
+		m.vars = append(m.vars, v)
+		m.names[v.Name] = colName(v.Name, used)
+		m.bounds[v.Name] = &bound{}
+	}
+
+	for i, a := range p.Asserts {
+		n := len(m.rows)
+		if err := m.addConstraint(fmt.Sprintf("c%d", i+1), a); err != nil {
+			return nil, fmt.Errorf("%s: Assert #%d: %v in %s", format, i+1, err, a)
+		}
+		// 一つの Assert が複数の行になる場合は c3_1, c3_2, ... とする
+		if len(m.rows)-n > 1 {
+			for j := n; j < len(m.rows); j++ {
+				m.rows[j].name = fmt.Sprintf("c%d_%d", i+1, j-n+1)
+			}
+		}
+	}
+
+	if o := p.Objective; o != nil {
+		obj, err := linear(o.Term)
+		if err != nil {
+			return nil, fmt.Errorf("%s: objective: %v in %s", format, err, o.Term)
+		}
+		// 目的関数は定数倍すると最適値が変わるので、有限小数で表せない係数は書き出さない
+		for _, a := range append([]*big.Rat{obj.c}, values(obj.coef)...) {
+			if !decimal(a) {
+				return nil, fmt.Errorf("%s: objective: coefficient %s cannot be written exactly in %s", format, a.RatString(), o.Term)
+			}
+		}
+		m.obj, m.sense = obj, o.Sense
+	}
+	return m, nil
+}
+
+// addConstraint は制約条件を行または変数の範囲として追加する関数。
+// 最上位の論理積は複数の制約に分ける。
+func (m *model) addConstraint(name string, t *smt.Term) error {
+	var op string
+	switch t.Op {
+	case smt.OpAnd:
+		for _, arg := range t.Args {
+			if err := m.addConstraint(name, arg); err != nil {
+				return err
+			}
+		}
+		return nil
+	case smt.OpConst:
+		if t.Bool {
+			return nil
+		}
+		return fmt.Errorf("constraint is always false")
+	case smt.OpLe, smt.OpLt:
+		op = "<="
+	case smt.OpGe, smt.OpGt:
+		op = ">="
+	case smt.OpEq:
+		op = "="
+	default:
+		return fmt.Errorf("operator %s is not a linear constraint", t.Op)
+	}
+	if t.Args[0].Sort == smt.SortBool {
+		return fmt.Errorf("operator %s over Bool is not a linear constraint", t.Op)
+	}
+
+	// a op b op c ... は a op b, b op c, ... とする
+	for i := 0; i+1 < len(t.Args); i++ {
+		l, err := linear(t.Args[i])
+		if err != nil {
+			return err
+		}
+		r, err := linear(t.Args[i+1])
+		if err != nil {
+			return err
+		}
+		l.addScaled(r, big.NewRat(-1, 1))
+		rhs := new(big.Rat).Neg(l.c)
+		l.c = new(big.Rat)
+
+		// 真に小さい（大きい）は、すべて整数の場合に限り 1 ずらした非真の不等式にする
+		if t.Op == smt.OpLt || t.Op == smt.OpGt {
+			if !m.integral(l, rhs) {
+				return fmt.Errorf("strict inequality %s over Num cannot be expressed", t.Op)
+			}
+			if t.Op == smt.OpLt {
+				rhs.Sub(rhs, big.NewRat(1, 1))
+			} else {
+				rhs.Add(rhs, big.NewRat(1, 1))
+			}
+		}
+		if l.isConst() {
+			// 0 op rhs が成り立てば行は不要
+			if c := rhs.Sign(); op == "<=" && c < 0 || op == ">=" && c > 0 || op == "=" && c != 0 {
+				return fmt.Errorf("constraint is always false")
+			}
+			continue
+		}
+		m.addRow(name, l, op, rhs)
+	}
+	return nil
+}
+
+// integral は線形式の変数がすべて Int で、係数と右辺がすべて整数かどうかを返す関数
+func (m *model) integral(l *linExpr, rhs *big.Rat) bool {
+	if !rhs.IsInt() {
+		return false
+	}
+	for _, v := range m.vars {
+		if a, ok := l.coef[v.Name]; ok && (v.Sort != smt.SortInt || !a.IsInt()) {
+			return false
+		}
+	}
+	return true
+}
+
+// addRow は行を追加する関数。変数が一つだけの行は、範囲の端が有限小数で表せれば変数の範囲とする。
+// 有限小数で表せない係数（1/3 など）のある行は、分母の最小公倍数を掛けて係数を整数にする。
+func (m *model) addRow(name string, l *linExpr, op string, rhs *big.Rat) {
+	for x, a := range l.coef {
+		v := new(big.Rat).Quo(rhs, a)
+		if len(l.coef) != 1 || !decimal(v) {
+			break
+		}
+		if a.Sign() < 0 {
+			op = map[string]string{"<=": ">=", ">=": "<=", "=": "="}[op]
+		}
+		b := m.bounds[x]
+		if op != ">=" && (b.hi == nil || v.Cmp(b.hi) < 0) {
+			b.hi = v
+		}
+		if op != "<=" && (b.lo == nil || v.Cmp(b.lo) > 0) {
+			b.lo = v
+		}
+		return
+	}
+
+	nums := append([]*big.Rat{rhs}, values(l.coef)...)
+	exact := true
+	for _, a := range nums {
+		exact = exact && decimal(a)
+	}
+	if !exact {
+		k := new(big.Int).SetInt64(1)
+		for _, a := range nums {
+			g := new(big.Int).GCD(nil, nil, k, a.Denom())
+			k.Mul(k, new(big.Int).Quo(a.Denom(), g))
+		}
+		s := new(big.Rat).SetInt(k)
+		for _, a := range nums {
+			a.Mul(a, s)
+		}
+	}
+	m.rows = append(m.rows, row{name: name, expr: l, op: op, rhs: rhs})
+}
+
+// values は係数の一覧を返す関数
+func values(coef map[string]*big.Rat) []*big.Rat {
+	var r []*big.Rat
+	for _, a := range coef {
+		r = append(r, a)
+	}
+	return r
+}
+
+// decimal は数値が有限小数で表せる（分母が 2 と 5 の積である）かどうかを返す関数
+func decimal(r *big.Rat) bool {
+	_, ok := decimalDigits(r)
+	return ok
+}
+
+// decimalDigits は数値を有限小数で正確に表すのに必要な小数点以下の桁数を返す関数
+func decimalDigits(r *big.Rat) (int, bool) {
+	d := r.Denom()
+	p := big.NewInt(1)
+	ten := big.NewInt(10)
+	for n := 0; n <= d.BitLen(); n++ {
+		if new(big.Int).Rem(p, d).Sign() == 0 {
+			return n, true
+		}
+		p.Mul(p, ten)
+	}
+	return 0, false
+}
+
+// invalidChar は LP 形式の名前に使えない文字にマッチする正規表現
+var invalidChar = regexp.MustCompile("[^A-Za-z0-9!\"#$%&()/,.;?@_`'{}|~]")
+
+// colName は制約変数名を LP と MPS の両方で使える名前に変換する関数。
+// x[0] は x(0) とし、その他の使えない文字は _ に置き換える。
+func colName(name string, used map[string]bool) string {
+	s := strings.NewReplacer("[", "(", "]", ")").Replace(name)
+	s = invalidChar.ReplaceAllString(s, "_")
+	if s == "" || strings.ContainsAny(s[:1], "0123456789.") || isKeyword(s) {
+		s = "_" + s
+	}
+	base := s
+	for i := 2; used[s]; i++ {
+		s = fmt.Sprintf("%s_%d", base, i)
+	}
+	used[s] = true
+	return s
+}
+
+// isKeyword は名前が LP 形式のキーワードとみなされるかどうかを返す関数
+func isKeyword(s string) bool {
+	switch strings.ToLower(s) {
+	case "e", "inf", "infinity", "free", "st", "end", "bounds", "general", "generals", "binary", "binaries":
+		return true
+	}
+	return false
+}
+
+// number は数値を LP と MPS の数値の表記に変換する関数。
+// 有限小数で表せる数値は正確に書き、表せない数値は近似値とする（build は書き出す数値を有限小数にする）。
+func number(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	if n, ok := decimalDigits(r); ok {
+		return r.FloatString(n)
+	}
+	f, _ := r.Float64()
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,144 @@
+// Package lp は線形の問題を CPLEX LP 形式と MPS 形式で書き出す smt パッケージの補助パッケージ。
+// インポートすると "lp" と "mps" という名前で書き出し形式が登録される。
+//
+// 書き出せるのは Int と Num の制約変数について、和と差、定数倍、定数による除算、
+// 比較（<=, >=, ==, および Int だけの < と >）を論理積でつないだ制約条件と、
+// Minimize または Maximize で指定した線形の目的関数だけである。
+// 変数が一つだけの制約は変数の範囲として書き出す。Int の制約変数は整数変数とする。
+//
+// 数値は小数で正確に書き出す。1/3 のように有限小数で表せない係数のある制約は、
+// 分母の最小公倍数を掛けて係数を整数にする。目的関数は定数倍できないので、
+// 有限小数で表せない係数があればエラーとする。
+package lp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+func init() {
+	smt.RegisterExporter("lp", WriteLP)
+	smt.RegisterExporter("mps", WriteMPS)
+}
+
+// termsPerLine は LP 形式で一行に書く項の数
+const termsPerLine = 8
+
+// WriteLP は問題を CPLEX LP 形式で書き出す関数
+func WriteLP(w io.Writer, p *smt.Problem) error {
+	m, err := build("lp", p)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, `\ LP exported from the DSL`)
+	m.writeNameMap(bw, `\`)
+	if m.obj != nil && m.obj.c.Sign() != 0 {
+		fmt.Fprintf(bw, "\\ objective constant: %s\n", number(m.obj.c))
+	}
+
+	if m.sense == smt.SenseMax {
+		fmt.Fprintln(bw, "Maximize")
+	} else {
+		fmt.Fprintln(bw, "Minimize")
+	}
+	switch {
+	case m.obj != nil && !m.obj.isConst():
+		fmt.Fprintf(bw, " obj: %s\n", m.lpExpr(m.obj))
+	case len(m.vars) > 0:
+		fmt.Fprintf(bw, " obj: 0 %s\n", m.names[m.vars[0].Name])
+	default:
+		fmt.Fprintln(bw, " obj:")
+	}
+
+	fmt.Fprintln(bw, "Subject To")
+	for _, r := range m.rows {
+		fmt.Fprintf(bw, " %s: %s %s %s\n", r.name, m.lpExpr(r.expr), r.op, number(r.rhs))
+	}
+
+	fmt.Fprintln(bw, "Bounds")
+	for _, v := range m.vars {
+		name, b := m.names[v.Name], m.bounds[v.Name]
+		switch {
+		case b.lo == nil && b.hi == nil:
+			fmt.Fprintf(bw, " %s free\n", name)
+		case b.lo == nil:
+			fmt.Fprintf(bw, " -inf <= %s <= %s\n", name, number(b.hi))
+		case b.hi == nil:
+			fmt.Fprintf(bw, " %s >= %s\n", name, number(b.lo))
+		case b.lo.Cmp(b.hi) == 0:
+			fmt.Fprintf(bw, " %s = %s\n", name, number(b.lo))
+		default:
+			fmt.Fprintf(bw, " %s <= %s <= %s\n", number(b.lo), name, number(b.hi))
+		}
+	}
+
+	var ints []string
+	for _, v := range m.vars {
+		if v.Sort == smt.SortInt {
+			ints = append(ints, m.names[v.Name])
+		}
+	}
+	if len(ints) > 0 {
+		fmt.Fprintln(bw, "General")
+		for i := 0; i < len(ints); i += termsPerLine {
+			j := i + termsPerLine
+			if j > len(ints) {
+				j = len(ints)
+			}
+			fmt.Fprintf(bw, " %s\n", strings.Join(ints[i:j], " "))
+		}
+	}
+	fmt.Fprintln(bw, "End")
+	return bw.Flush()
+}
+
+// lpExpr は線形式の変数の項を宣言順に LP 形式で表す関数。定数項は含まない。
+func (m *model) lpExpr(l *linExpr) string {
+	var b strings.Builder
+	n := 0
+	for _, v := range m.vars {
+		a, ok := l.coef[v.Name]
+		if !ok {
+			continue
+		}
+		if n > 0 && n%termsPerLine == 0 {
+			b.WriteString("\n  ")
+		}
+		switch {
+		case a.Sign() < 0 && n == 0:
+			b.WriteString("- ")
+		case a.Sign() < 0:
+			b.WriteString(" - ")
+		case n > 0:
+			b.WriteString(" + ")
+		}
+		if abs := new(big.Rat).Abs(a); abs.Cmp(big.NewRat(1, 1)) != 0 {
+			b.WriteString(number(abs) + " ")
+		}
+		b.WriteString(m.names[v.Name])
+		n++
+	}
+	return b.String()
+}
+
+// writeNameMap は名前を変更した制約変数の対応をコメントとして書き出す関数
+func (m *model) writeNameMap(w io.Writer, comment string) {
+	header := false
+	for _, v := range m.vars {
+		if m.names[v.Name] == v.Name {
+			continue
+		}
+		if !header {
+			fmt.Fprintf(w, "%s variables:\n", comment)
+			header = true
+		}
+		fmt.Fprintf(w, "%s   %s %s\n", comment, m.names[v.Name], v.Name)
+	}
+}
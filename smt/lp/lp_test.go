@@ -0,0 +1,61 @@
+package lp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+func TestExactCoefficients(t *testing.T) {
+	// 有限小数で表せない係数のある行は整数倍し、目的関数ではエラーとする
+	tests := []struct {
+		name string
+		cond func(c *smt.Context, x, y *smt.Term) *smt.Term
+		obj  func(c *smt.Context, x, y *smt.Term) *smt.Term
+		want string // LP 形式の行。空文字列はエラー
+	}{
+		{"thirds", func(c *smt.Context, x, y *smt.Term) *smt.Term {
+			return x.Div(c.NumVal("3")).Add(y).Le(c.NumVal("1"))
+		}, nil, " c1: x + 3 y <= 3\n"},
+		{"bound with a third", func(c *smt.Context, x, y *smt.Term) *smt.Term {
+			return y.Ge(c.NumVal("1").Div(c.NumVal("3")))
+		}, nil, " c1: 3 y >= 1\n"},
+		{"decimal bound", func(c *smt.Context, x, y *smt.Term) *smt.Term {
+			return y.Le(c.NumVal("1").Div(c.NumVal("8")))
+		}, nil, " -inf <= y <= 0.125\n"},
+		{"decimals", func(c *smt.Context, x, y *smt.Term) *smt.Term {
+			return x.Mul(c.NumVal("0.1")).Add(y.Div(c.NumVal("4"))).Ge(c.NumVal("0.3"))
+		}, nil, " c1: 0.1 x + 0.25 y >= 0.3\n"},
+		{"objective", func(c *smt.Context, x, y *smt.Term) *smt.Term {
+			return x.Add(y).Le(c.NumVal("1"))
+		}, func(c *smt.Context, x, y *smt.Term) *smt.Term {
+			return x.Div(c.NumVal("8"))
+		}, " obj: 0.125 x\n"},
+		{"objective with a third", func(c *smt.Context, x, y *smt.Term) *smt.Term {
+			return x.Add(y).Le(c.NumVal("1"))
+		}, func(c *smt.Context, x, y *smt.Term) *smt.Term {
+			return x.Div(c.NumVal("3"))
+		}, ""},
+	}
+	for _, tt := range tests {
+		c := smt.NewContext(nil)
+		x, y := c.NumVar("x"), c.NumVar("y")
+		c.Assert(tt.cond(c, x, y))
+		if tt.obj != nil {
+			c.Minimize(tt.obj(c, x, y))
+		}
+		var b bytes.Buffer
+		err := WriteLP(&b, c.Snapshot())
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("%s: want an error in\n%s", tt.name, b.String())
+		case tt.want != "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.want != "" && !strings.Contains(b.String(), tt.want):
+			t.Errorf("%s: want %q in\n%s", tt.name, tt.want, b.String())
+		}
+		c.Close()
+	}
+}
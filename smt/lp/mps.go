@@ -0,0 +1,100 @@
+package lp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+// WriteMPS は問題を自由形式の MPS 形式で書き出す関数。
+// Int の制約変数は MARKER の INTORG と INTEND で囲む。
+func WriteMPS(w io.Writer, p *smt.Problem) error {
+	m, err := build("mps", p)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "* MPS exported from the DSL")
+	m.writeNameMap(bw, "*")
+	if m.obj != nil && m.obj.c.Sign() != 0 {
+		fmt.Fprintf(bw, "* objective constant: %s\n", number(m.obj.c))
+	}
+	fmt.Fprintln(bw, "NAME DSL")
+	if m.sense == smt.SenseMax {
+		fmt.Fprintln(bw, "OBJSENSE")
+		fmt.Fprintln(bw, "    MAX")
+	}
+
+	fmt.Fprintln(bw, "ROWS")
+	fmt.Fprintln(bw, " N  obj")
+	for _, r := range m.rows {
+		fmt.Fprintf(bw, " %s  %s\n", map[string]string{"<=": "L", ">=": "G", "=": "E"}[r.op], r.name)
+	}
+
+	fmt.Fprintln(bw, "COLUMNS")
+	integer := false
+	for i, v := range m.vars {
+		if isInt := v.Sort == smt.SortInt; isInt != integer {
+			marker := "INTORG"
+			if !isInt {
+				marker = "INTEND"
+			}
+			fmt.Fprintf(bw, "    MARKER%d  'MARKER'  '%s'\n", i, marker)
+			integer = isInt
+		}
+
+		name := m.names[v.Name]
+		entries := 0
+		if m.obj != nil {
+			if a, ok := m.obj.coef[v.Name]; ok {
+				fmt.Fprintf(bw, "    %s  obj  %s\n", name, number(a))
+				entries++
+			}
+		}
+		for _, r := range m.rows {
+			if a, ok := r.expr.coef[v.Name]; ok {
+				fmt.Fprintf(bw, "    %s  %s  %s\n", name, r.name, number(a))
+				entries++
+			}
+		}
+		if entries == 0 {
+			// どの行にも現れない変数も列として宣言する
+			fmt.Fprintf(bw, "    %s  obj  0\n", name)
+		}
+	}
+	if integer {
+		fmt.Fprintf(bw, "    MARKER%d  'MARKER'  'INTEND'\n", len(m.vars))
+	}
+
+	fmt.Fprintln(bw, "RHS")
+	for _, r := range m.rows {
+		if r.rhs.Sign() != 0 {
+			fmt.Fprintf(bw, "    RHS  %s  %s\n", r.name, number(r.rhs))
+		}
+	}
+
+	fmt.Fprintln(bw, "BOUNDS")
+	for _, v := range m.vars {
+		name, b := m.names[v.Name], m.bounds[v.Name]
+		switch {
+		case b.lo == nil && b.hi == nil:
+			fmt.Fprintf(bw, " FR BND  %s\n", name)
+		case b.lo != nil && b.hi != nil && b.lo.Cmp(b.hi) == 0:
+			fmt.Fprintf(bw, " FX BND  %s  %s\n", name, number(b.lo))
+		default:
+			if b.lo == nil {
+				fmt.Fprintf(bw, " MI BND  %s\n", name)
+			} else {
+				fmt.Fprintf(bw, " LO BND  %s  %s\n", name, number(b.lo))
+			}
+			if b.hi != nil {
+				fmt.Fprintf(bw, " UP BND  %s  %s\n", name, number(b.hi))
+			}
+		}
+	}
+	fmt.Fprintln(bw, "ENDATA")
+	return bw.Flush()
+}
@@ -0,0 +1,475 @@
+// Package mzn は問題を MiniZinc のモデルとして書き出す smt パッケージの補助パッケージ。
+// インポートすると "mzn" という名前で書き出し形式が登録される。
+//
+// name[0], name[1], ... と添え字の揃った制約変数（IntArrayVar などで作成したもの）は
+// 0 から始まる MiniZinc の配列とし、Distinct は alldifferent に変換する。
+// Int の div と mod は DSL（SMT-LIB）と同じく剰余が非負となるユークリッド除算なので、
+// 0 方向に切り捨てる MiniZinc の div と mod ではなく、モデルに定義する関数 ediv と emod に変換する。
+// Solve で指定した制約変数は DSL の Solve と同じ name = value の形式で出力する。
+package mzn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+func init() {
+	smt.RegisterExporter("mzn", WriteMiniZinc)
+}
+
+// mznTypes は制約変数のソートと MiniZinc の型の対応
+var mznTypes = map[string]string{
+	smt.SortInt:  "int",
+	smt.SortNum:  "float",
+	smt.SortBool: "bool",
+}
+
+// elemName は配列の要素の名前 x[0] にマッチする正規表現
+var elemName = regexp.MustCompile(`^(.+)\[([0-9]+)\]$`)
+
+// array は MiniZinc の配列として宣言する制約変数の並びを表す構造体型
+type array struct {
+	name string // MiniZinc での名前
+	size int
+	sort string
+}
+
+// writer は MiniZinc のモデルを組み立てる構造体型
+type writer struct {
+	names   map[string]string // 制約変数名と MiniZinc での表記（配列の要素は x[0]）
+	arrays  map[string]*array // 配列の元の名前と配列
+	renamed []string          // 名前の変更の説明
+	globals bool              // alldifferent を使うか
+	euclid  bool              // ediv と emod を使うか
+}
+
+// WriteMiniZinc は問題を MiniZinc のモデルとして書き出す関数
+func WriteMiniZinc(w io.Writer, p *smt.Problem) error {
+	if p.Seq > 0 {
+		return fmt.Errorf("mzn: only the first Solve can be exported")
+	}
+
+	m := newWriter(p.Vars)
+	var constraints []string
+	for i, a := range p.Asserts {
+		s, err := m.expr(a, 0)
+		if err != nil {
+			return fmt.Errorf("mzn: Assert #%d: %v in %s", i+1, err, a)
+		}
+		constraints = append(constraints, s)
+	}
+	solve := "solve satisfy;"
+	if o := p.Objective; o != nil {
+		s, err := m.expr(o.Term, 0)
+		if err != nil {
+			return fmt.Errorf("mzn: objective: %v in %s", err, o.Term)
+		}
+		solve = fmt.Sprintf("solve %simize %s;", o.Sense, s)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "% MiniZinc model exported from the DSL")
+	if len(m.renamed) > 0 {
+		fmt.Fprintln(bw, "% variables:")
+		for _, r := range m.renamed {
+			fmt.Fprintf(bw, "%%   %s\n", r)
+		}
+	}
+	if m.globals {
+		fmt.Fprintln(bw, `include "alldifferent.mzn";`)
+	}
+	fmt.Fprintln(bw)
+	if m.euclid {
+		fmt.Fprintln(bw, "% Euclidean div and mod of the DSL: the remainder is non-negative")
+		fmt.Fprintln(bw, "function var int: emod(var int: x, var int: y) = (x mod y + abs(y)) mod y;")
+		fmt.Fprintln(bw, "function var int: ediv(var int: x, var int: y) = (x - emod(x, y)) div y;")
+		fmt.Fprintln(bw)
+	}
+
+	// 制約変数の宣言。配列は最初の要素の位置で宣言する
+	for _, v := range p.Vars {
+		if base, i, ok := splitElem(v.Name); ok && m.arrays[base] != nil {
+			if a := m.arrays[base]; i == 0 {
+				fmt.Fprintf(bw, "array[0..%d] of var %s: %s;\n", a.size-1, mznTypes[a.sort], a.name)
+			}
+			continue
+		}
+		fmt.Fprintf(bw, "var %s: %s;\n", mznTypes[v.Sort], m.names[v.Name])
+	}
+	fmt.Fprintln(bw)
+
+	for _, c := range constraints {
+		fmt.Fprintf(bw, "constraint %s;\n", c)
+	}
+	fmt.Fprintln(bw)
+	fmt.Fprintln(bw, solve)
+
+	// Solve で指定した制約変数の出力。配列の全体は内包表記で出力する
+	var outputs []string
+	for _, name := range m.outputs(p.Solve) {
+		if a, ok := m.arrays[name]; ok {
+			outputs = append(outputs, fmt.Sprintf(`concat(["%s[\(i)] = \(%s[i])\n" | i in 0..%d])`, name, a.name, a.size-1))
+		} else {
+			outputs = append(outputs, fmt.Sprintf(`"%s = \(%s)\n"`, name, m.names[name]))
+		}
+	}
+	if len(outputs) > 0 {
+		fmt.Fprintf(bw, "\noutput [\n  %s\n];\n", strings.Join(outputs, ",\n  "))
+	}
+	return bw.Flush()
+}
+
+// newWriter は制約変数の MiniZinc での表記を決めて writer を生成する関数
+func newWriter(vars []*smt.Term) *writer {
+	m := &writer{names: map[string]string{}, arrays: map[string]*array{}}
+
+	// 添え字が 0 から揃っていて、ソートが同じ要素を配列とする
+	declared := map[string]bool{}
+	elems := map[string]map[int]string{}
+	for _, v := range vars {
+		declared[v.Name] = true
+		if base, i, ok := splitElem(v.Name); ok {
+			if elems[base] == nil {
+				elems[base] = map[int]string{}
+			}
+			elems[base][i] = v.Sort
+		}
+	}
+	used := map[string]bool{}
+	for base, es := range elems {
+		ok := !declared[base]
+		for i := 0; i < len(es) && ok; i++ {
+			ok = es[i] != "" && es[i] == es[0]
+		}
+		if ok {
+			m.arrays[base] = &array{size: len(es), sort: es[0]}
+		}
+	}
+
+	for _, v := range vars {
+		base, i, ok := splitElem(v.Name)
+		if a := m.arrays[base]; ok && a != nil {
+			if a.name == "" {
+				a.name = m.ident(base, used)
+			}
+			m.names[v.Name] = fmt.Sprintf("%s[%d]", a.name, i)
+			continue
+		}
+		m.names[v.Name] = m.ident(v.Name, used)
+	}
+	return m
+}
+
+// splitElem は配列の要素の名前 x[3] を x と 3 に分ける関数
+func splitElem(name string) (string, int, bool) {
+	sm := elemName.FindStringSubmatch(name)
+	if sm == nil {
+		return "", 0, false
+	}
+	i, err := strconv.Atoi(sm[2])
+	return sm[1], i, err == nil
+}
+
+// keywords は MiniZinc の予約語と、識別子に使うと紛らわしい組み込みの名前
+var keywords = map[string]bool{
+	"ann": true, "annotation": true, "any": true, "array": true, "bool": true, "case": true,
+	"constraint": true, "diff": true, "div": true, "else": true, "elseif": true, "endif": true,
+	"enum": true, "false": true, "float": true, "function": true, "if": true, "in": true,
+	"include": true, "int": true, "intersect": true, "let": true, "list": true, "maximize": true,
+	"minimize": true, "mod": true, "not": true, "of": true, "op": true, "opt": true, "output": true,
+	"par": true, "predicate": true, "record": true, "satisfy": true, "set": true, "solve": true,
+	"string": true, "subset": true, "superset": true, "symdiff": true, "test": true, "then": true,
+	"true": true, "tuple": true, "type": true, "union": true, "var": true, "where": true, "xor": true,
+	"alldifferent": true, "concat": true, "pow": true, "floor": true, "int2float": true,
+	"abs": true, "ediv": true, "emod": true,
+}
+
+// ident は名前を MiniZinc の識別子に変換する関数。変更した場合はその対応を記録する。
+func (m *writer) ident(name string, used map[string]bool) string {
+	var b strings.Builder
+	for _, c := range name {
+		if c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			b.WriteRune(c)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	id := b.String()
+	if id == "" || id[0] == '_' || id[0] >= '0' && id[0] <= '9' || keywords[id] {
+		id = "v_" + id
+	}
+	base := id
+	for i := 2; used[id]; i++ {
+		id = fmt.Sprintf("%s_%d", base, i)
+	}
+	used[id] = true
+	if id != name {
+		m.renamed = append(m.renamed, fmt.Sprintf("%s %s", id, name))
+	}
+	return id
+}
+
+// outputs は Solve で指定された制約変数の名前のうち、配列の全体を指定したものを配列の名前にまとめる関数
+func (m *writer) outputs(names []string) []string {
+	var r []string
+	for i := 0; i < len(names); i++ {
+		base, idx, ok := splitElem(names[i])
+		if a := m.arrays[base]; ok && a != nil && idx == 0 && i+a.size <= len(names) {
+			all := true
+			for j := 1; j < a.size && all; j++ {
+				all = names[i+j] == fmt.Sprintf("%s[%d]", base, j)
+			}
+			if all {
+				r = append(r, base)
+				i += a.size - 1
+				continue
+			}
+		}
+		r = append(r, names[i])
+	}
+	return r
+}
+
+// 演算子の優先順位（大きいほど強く結合する）
+const (
+	precIff = iota + 1
+	precImplies
+	precOr
+	precAnd
+	precCmp
+	precAdd
+	precMul
+	precUnary
+	precPrimary
+)
+
+// binaryOps は MiniZinc の二項演算子と優先順位
+var binaryOps = map[smt.Op]struct {
+	op   string
+	prec int
+}{
+	smt.OpIff:     {"<->", precIff},
+	smt.OpImplies: {"->", precImplies},
+	smt.OpOr:      {`\/`, precOr},
+	smt.OpXor:     {"xor", precOr},
+	smt.OpAnd:     {`/\`, precAnd},
+	smt.OpEq:      {"=", precCmp},
+	smt.OpLt:      {"<", precCmp},
+	smt.OpLe:      {"<=", precCmp},
+	smt.OpGt:      {">", precCmp},
+	smt.OpGe:      {">=", precCmp},
+	smt.OpAdd:     {"+", precAdd},
+	smt.OpSub:     {"-", precAdd},
+	smt.OpMul:     {"*", precMul},
+}
+
+// expr は項を優先順位 prec 以上の MiniZinc の式に変換する関数。
+// 優先順位が低い場合は括弧で囲む。
+func (m *writer) expr(t *smt.Term, prec int) (string, error) {
+	s, tp, err := m.term(t)
+	if err != nil {
+		return "", err
+	}
+	if tp < prec {
+		return "(" + s + ")", nil
+	}
+	return s, nil
+}
+
+// term は項を MiniZinc の式に変換し、その式の優先順位を返す関数
+func (m *writer) term(t *smt.Term) (string, int, error) {
+	switch t.Op {
+	case smt.OpVar:
+		return m.names[t.Name], precPrimary, nil
+	case smt.OpConst:
+		s, prec := constText(t)
+		return s, prec, nil
+	}
+
+	args := t.Args
+	switch t.Op {
+	case smt.OpNot:
+		if a := args[0]; a.Op == smt.OpEq && len(a.Args) == 2 {
+			// (not (= a b)) は a != b
+			s, err := m.binary("!=", precCmp, a.Args)
+			return s, precCmp, err
+		}
+		s, err := m.expr(args[0], precUnary)
+		return "not " + s, precUnary, err
+	case smt.OpNeg:
+		s, err := m.expr(args[0], precUnary)
+		return "-" + s, precUnary, err
+	case smt.OpDiv, smt.OpMod:
+		if t.Op == smt.OpDiv && t.Sort == smt.SortNum {
+			s, err := m.binary("/", precMul, args)
+			return s, precMul, err
+		}
+		// Int の div と mod はユークリッド除算の関数とする
+		m.euclid = true
+		fn := map[smt.Op]string{smt.OpDiv: "ediv", smt.OpMod: "emod"}[t.Op]
+		s, err := m.list(args)
+		return fn + "(" + s + ")", precPrimary, err
+	case smt.OpDistinct:
+		return m.distinct(args)
+	case smt.OpIte:
+		c, err := m.expr(args[0], 0)
+		if err != nil {
+			return "", 0, err
+		}
+		a, err := m.expr(args[1], 0)
+		if err != nil {
+			return "", 0, err
+		}
+		b, err := m.expr(args[2], 0)
+		return fmt.Sprintf("if %s then %s else %s endif", c, a, b), precPrimary, err
+	case smt.OpToReal:
+		if r, ok := intConst(args[0]); ok {
+			// int2float(3) は 3.0 とする
+			s, prec := constText(smt.NumConst(r))
+			return s, prec, nil
+		}
+		s, err := m.expr(args[0], 0)
+		return "int2float(" + s + ")", precPrimary, err
+	case smt.OpPow, smt.OpToInt:
+		fn := map[smt.Op]string{smt.OpPow: "pow", smt.OpToInt: "floor"}[t.Op]
+		s, err := m.list(args)
+		return fn + "(" + s + ")", precPrimary, err
+	case smt.OpIsInt:
+		s, err := m.expr(args[0], 0)
+		return fmt.Sprintf("int2float(floor(%s)) = %s", s, s), precCmp, err
+	}
+
+	if b, ok := binaryOps[t.Op]; ok {
+		if len(args) == 1 {
+			return m.term(args[0])
+		}
+		s, err := m.binary(b.op, b.prec, args)
+		return s, b.prec, err
+	}
+	return "", 0, fmt.Errorf("unsupported operator %s", t.Op)
+}
+
+// binary は二項演算子の式に変換する関数。
+// 左結合とし、比較と含意、同値は結合しないので両側を一つ高い優先順位とする。
+func (m *writer) binary(op string, prec int, args []*smt.Term) (string, error) {
+	left := prec
+	if prec <= precImplies || prec == precCmp {
+		left = prec + 1
+	}
+	// a < b < c のような連鎖は a < b /\ b < c とする
+	if prec == precCmp && len(args) > 2 {
+		var ss []string
+		for i := 0; i+1 < len(args); i++ {
+			s, err := m.binary(op, prec, args[i:i+2])
+			if err != nil {
+				return "", err
+			}
+			ss = append(ss, s)
+		}
+		return strings.Join(ss, ` /\ `), nil
+	}
+
+	s, err := m.expr(args[0], left)
+	if err != nil {
+		return "", err
+	}
+	for _, arg := range args[1:] {
+		r, err := m.expr(arg, prec+1)
+		if err != nil {
+			return "", err
+		}
+		s += " " + op + " " + r
+	}
+	return s, nil
+}
+
+// distinct は Distinct を変換する関数。Int は alldifferent とし、その他は対ごとの != とする。
+func (m *writer) distinct(args []*smt.Term) (string, int, error) {
+	if args[0].Sort == smt.SortInt && len(args) > 2 {
+		m.globals = true
+		s, err := m.list(args)
+		return "alldifferent([" + s + "])", precPrimary, err
+	}
+	var ss []string
+	for i := range args {
+		for j := i + 1; j < len(args); j++ {
+			s, err := m.binary("!=", precCmp, []*smt.Term{args[i], args[j]})
+			if err != nil {
+				return "", 0, err
+			}
+			ss = append(ss, s)
+		}
+	}
+	if len(ss) == 1 {
+		return ss[0], precCmp, nil
+	}
+	return strings.Join(ss, ` /\ `), precAnd, nil
+}
+
+// list は項の並びをカンマで区切った MiniZinc の式に変換する関数
+func (m *writer) list(args []*smt.Term) (string, error) {
+	var ss []string
+	for _, arg := range args {
+		s, err := m.expr(arg, 0)
+		if err != nil {
+			return "", err
+		}
+		ss = append(ss, s)
+	}
+	return strings.Join(ss, ", "), nil
+}
+
+// constText は定数を MiniZinc のリテラルで表す関数。
+// float の定数は有限小数で表せなければ分数の式とする。
+func constText(t *smt.Term) (string, int) {
+	s, prec := "", precPrimary
+	switch {
+	case t.Sort == smt.SortBool:
+		return strconv.FormatBool(t.Bool), precPrimary
+	case t.Sort == smt.SortInt:
+		s = t.Num.Num().String()
+	case t.Num.IsInt():
+		s = t.Num.Num().String() + ".0"
+	default:
+		s = decimal(t.Num)
+		if s == "" {
+			s, prec = fmt.Sprintf("%s.0 / %s.0", t.Num.Num(), t.Num.Denom()), precMul
+		}
+	}
+	if t.Num.Sign() < 0 {
+		// x - -1 や -1 * x とならないように、負の数は和と同じ優先順位とする
+		prec = precAdd
+	}
+	return s, prec
+}
+
+// intConst は Int の定数、またはその符号を反転した項の値を返す関数
+func intConst(t *smt.Term) (*big.Rat, bool) {
+	switch t.Op {
+	case smt.OpConst:
+		return t.Num, true
+	case smt.OpNeg:
+		if r, ok := intConst(t.Args[0]); ok {
+			return new(big.Rat).Neg(r), true
+		}
+	}
+	return nil, false
+}
+
+// decimal は有理数を有限小数で表す関数。表せない場合は空文字列を返す。
+func decimal(r *big.Rat) string {
+	for digits := 1; digits <= 20; digits++ {
+		s := r.FloatString(digits)
+		if x, ok := new(big.Rat).SetString(s); ok && x.Cmp(r) == 0 {
+			return s
+		}
+	}
+	return ""
+}
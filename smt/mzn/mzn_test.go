@@ -0,0 +1,87 @@
+package mzn
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+// euclidFuncs はモデルに定義するユークリッド除算の関数
+const euclidFuncs = `function var int: emod(var int: x, var int: y) = (x mod y + abs(y)) mod y;
+function var int: ediv(var int: x, var int: y) = (x - emod(x, y)) div y;
+`
+
+func TestDivMod(t *testing.T) {
+	// Int の div と mod は負の被演算子でも DSL と同じ結果となる ediv と emod とする
+	tests := []struct {
+		name string
+		cond func(c *smt.Context, x, y, r *smt.Term) *smt.Term
+		want string
+	}{
+		{"div by a negative constant", func(c *smt.Context, x, y, r *smt.Term) *smt.Term { return y.Eq(x.Div(c.IntVal(-3))) }, "y = ediv(x, -3)"},
+		{"mod of a negation", func(c *smt.Context, x, y, r *smt.Term) *smt.Term { return y.Eq(x.Neg().Mod(c.IntVal(3))) }, "y = emod(-x, 3)"},
+		{"nested", func(c *smt.Context, x, y, r *smt.Term) *smt.Term {
+			return x.Div(y).Mul(c.IntVal(2)).Add(x.Mod(y)).Ge(c.IntVal(-10))
+		}, "ediv(x, y) * 2 + emod(x, y) >= -10"},
+		{"Num division", func(c *smt.Context, x, y, r *smt.Term) *smt.Term { return r.Div(c.NumVal("2")).Lt(r) }, "r / 2.0 < r"},
+	}
+	for _, tt := range tests {
+		c := smt.NewContext(nil)
+		x, y, r := c.IntVar("x"), c.IntVar("y"), c.NumVar("r")
+		c.Assert(tt.cond(c, x, y, r))
+		var b bytes.Buffer
+		if err := WriteMiniZinc(&b, c.Snapshot()); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		out := b.String()
+		if !strings.Contains(out, "constraint "+tt.want+";\n") {
+			t.Errorf("%s: want constraint %s in\n%s", tt.name, tt.want, out)
+		}
+		if euclid := strings.Contains(tt.want, "ediv") || strings.Contains(tt.want, "emod"); strings.Contains(out, euclidFuncs) != euclid {
+			t.Errorf("%s: definitions of ediv and emod: want %v in\n%s", tt.name, euclid, out)
+		}
+		c.Close()
+	}
+}
+
+func TestEuclidFuncs(t *testing.T) {
+	// euclidFuncs の式を、MiniZinc の div と mod と同じく 0 方向に切り捨てる Go の / と % で計算し、
+	// math/big の DivMod（ユークリッド除算）と比べる
+	abs := func(y int64) int64 {
+		if y < 0 {
+			return -y
+		}
+		return y
+	}
+	for x := int64(-20); x <= 20; x++ {
+		for y := int64(-6); y <= 6; y++ {
+			if y == 0 {
+				continue
+			}
+			emod := (x%y + abs(y)) % y
+			ediv := (x - emod) / y
+			q, m := new(big.Int).DivMod(big.NewInt(x), big.NewInt(y), new(big.Int))
+			if ediv != q.Int64() || emod != m.Int64() {
+				t.Errorf("ediv, emod(%d, %d) = %d, %d; want %s, %s", x, y, ediv, emod, q, m)
+			}
+		}
+	}
+}
+
+func TestKeywordNames(t *testing.T) {
+	// ediv と emod という名前の制約変数は関数と衝突しないように名前を変える
+	c := smt.NewContext(nil)
+	defer c.Close()
+	ediv := c.IntVar("ediv")
+	c.Assert(ediv.Mod(c.IntVal(2)).Eq(c.IntVal(1)))
+	var b bytes.Buffer
+	if err := WriteMiniZinc(&b, c.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	if out := b.String(); !strings.Contains(out, "constraint emod(v_ediv, 2) = 1;\n") {
+		t.Errorf("want the variable ediv renamed in\n%s", out)
+	}
+}
@@ -0,0 +1,61 @@
+package smt
+
+import "fmt"
+
+// 最適化の向き
+const (
+	SenseMin = "min"
+	SenseMax = "max"
+)
+
+// Objective は目的関数を表す構造体型
+type Objective struct {
+	Sense string // SenseMin または SenseMax
+	Term  *Term  // Int または Num の項
+}
+
+// Optimizer は目的関数をサポートするバックエンドが実装するインタフェース。
+// 実装しないバックエンドでは目的関数は問題の書き出しにだけ使われる。
+type Optimizer interface {
+	// Optimize は目的関数を設定する。以降の Check は最適な解を求める
+	Optimize(obj *Objective) error
+}
+
+// Minimize は項 t を最小化する目的関数を設定する関数
+func (c *Context) Minimize(t *Term) {
+	c.setObjective(SenseMin, t)
+}
+
+// Maximize は項 t を最大化する目的関数を設定する関数
+func (c *Context) Maximize(t *Term) {
+	c.setObjective(SenseMax, t)
+}
+
+// setObjective は Minimize と Maximize の本体。目的関数は一つだけで、後の設定で置き換える。
+func (c *Context) setObjective(sense string, t *Term) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name := "Minimize"
+	if sense == SenseMax {
+		name = "Maximize"
+	}
+	if t.err != nil {
+		c.setErr(fmt.Errorf("%s: %v", name, t.err))
+		return
+	}
+	if t.Sort == SortBool {
+		c.setErr(fmt.Errorf("%s: objective is Bool, not Int or Num", name))
+		return
+	}
+
+	c.objective = &Objective{Sense: sense, Term: t}
+	c.solved = false
+	if c.backend == nil {
+		return
+	}
+	if o, ok := c.backend.(Optimizer); ok {
+		c.setErr(o.Optimize(c.objective))
+	} else {
+		c.unoptimized = true
+	}
+}
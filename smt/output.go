@@ -0,0 +1,287 @@
+package smt
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Solve と SolveAll の出力形式
+const (
+	OutputText = "text" // name = value の行
+	OutputJSON = "json" // 解決可能性、制約変数の値と所要時間の JSON
+	OutputCSV  = "csv"  // 見出しの行と、解ごとに一行の CSV
+)
+
+// SetOutputFormat は Solve と SolveAll の出力形式を設定する関数。
+// format は OutputText, OutputJSON, OutputCSV のいずれか。
+func (c *Context) SetOutputFormat(format string) error {
+	switch format {
+	case OutputText, OutputJSON, OutputCSV:
+	default:
+		return fmt.Errorf("unknown output format %q (available: text, json, csv)", format)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.output = format
+	return nil
+}
+
+// solveStats は Solve と SolveAll の結果と所要時間を表す構造体型
+type solveStats struct {
+	status    Status // 最後の Check の結果
+	reason    string // status が StatusUnknown の場合の理由
+	err       error
+	solutions []*Result
+	check     time.Duration // Check の所要時間の合計
+	model     time.Duration // 値の取得の所要時間の合計
+}
+
+// group は Solve の引数の一つに対応する制約変数の並びを表す構造体型
+type group struct {
+	name  string
+	elems []string // 配列の要素の名前。配列でなければ name だけ
+	array bool
+}
+
+// groups は Solve の引数を制約変数の並びに分ける関数。呼び出し側でロックを取得していること。
+func (c *Context) groups(names []string) (gs []group) {
+	for _, name := range names {
+		if _, ok := c.vars[name]; ok {
+			gs = append(gs, group{name: name, elems: []string{name}})
+			continue
+		}
+		if elems := c.expand([]string{name}); len(elems) > 0 {
+			gs = append(gs, group{name: name, elems: elems, array: true})
+		}
+	}
+	return
+}
+
+// printSolutions は解を出力形式に従って w に書き出す関数。
+// all は SolveAll の出力であることを示す。呼び出し側でロックを取得していること。
+func (c *Context) printSolutions(w io.Writer, names []string, s *solveStats, all bool) {
+	switch c.output {
+	case OutputJSON:
+		c.printJSON(w, names, s, all)
+	case OutputCSV:
+		c.printCSV(w, names, s)
+	default:
+		c.printText(w, names, s, all)
+	}
+
+	// 盤面の図も書き出す
+	if c.svgPath != "" {
+		if err := c.writeSVG(names, s); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
+
+// printText は name = value の行で解を書き出す関数。
+// Display で設定した配列は表で書き出す。
+func (c *Context) printText(w io.Writer, names []string, s *solveStats, all bool) {
+	if len(s.solutions) == 0 {
+		fmt.Fprintln(w, s.outcome())
+		return
+	}
+	for i, r := range s.solutions {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		for _, g := range c.groups(names) {
+			if d, ok := c.displays[g.name]; ok && g.array {
+				values := make([]Value, len(g.elems))
+				for j, name := range g.elems {
+					values[j], _ = r.Value(name)
+				}
+				d.write(w, g.name, values)
+				continue
+			}
+			for _, name := range g.elems {
+				v, _ := r.Value(name)
+				fmt.Fprintf(w, "%s = %s\n", name, v.Format(c.numFormat, c.digits))
+			}
+		}
+	}
+	if all {
+		fmt.Fprintf(w, "\n%d solution(s)\n", len(s.solutions))
+		if s.status != StatusUnsat && s.err == nil {
+			// すべての解を列挙し終える前に判定できなくなった
+			fmt.Fprintf(w, "enumeration stopped: %s\n", s.outcome())
+		}
+	}
+}
+
+// outcome は解が見つからなかった場合の表示を返す関数。
+// 解決不能（unsat）は unsolvable、判定できなかった場合は unknown とその理由とする。
+func (s *solveStats) outcome() string {
+	switch {
+	case s.status == StatusUnsat:
+		return "unsolvable"
+	case s.reason != "":
+		return fmt.Sprintf("unknown (%s)", s.reason)
+	case s.err != nil:
+		return "unknown (error)"
+	}
+	return "unknown"
+}
+
+// printCSV は見出しの行と解ごとに一行の CSV で解を書き出す関数
+func (c *Context) printCSV(w io.Writer, names []string, s *solveStats) {
+	cw := csv.NewWriter(w)
+	header := c.expand(names)
+	cw.Write(header)
+	for _, r := range s.solutions {
+		row := make([]string, len(header))
+		for i, name := range header {
+			v, _ := r.Value(name)
+			row[i] = csvValue(v)
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+
+	// CSV に含められない判定できなかったことは標準エラー出力に表示する
+	if s.status == StatusUnknown && s.err == nil {
+		fmt.Fprintln(os.Stderr, s.outcome())
+	}
+}
+
+// csvValue は値を CSV の欄の文字列にする関数。Num は分数（無理数は小数の近似値）とする。
+func csvValue(v Value) string {
+	switch {
+	case v.Sort == SortBool:
+		return fmt.Sprint(v.Bool)
+	case v.Int != nil:
+		return v.Int.String()
+	case v.Rat != nil:
+		return v.Rat.RatString()
+	case v.Approx != "":
+		return strings.TrimSuffix(v.Approx, "?")
+	}
+	return v.Text
+}
+
+// jsonVar は JSON で出力する制約変数（または配列）とその値
+type jsonVar struct {
+	Name  string      `json:"name"`
+	Sort  string      `json:"sort"`
+	Value interface{} `json:"value"`
+}
+
+// jsonTime は JSON で出力する所要時間（ミリ秒）
+type jsonTime struct {
+	Check float64 `json:"check_ms"`
+	Model float64 `json:"model_ms"`
+}
+
+// jsonSolve は Solve の JSON の出力
+type jsonSolve struct {
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Variables []jsonVar `json:"variables"`
+	Time      jsonTime  `json:"time"`
+}
+
+// jsonSolveAll は SolveAll の JSON の出力
+type jsonSolveAll struct {
+	Status    string      `json:"status"`
+	Reason    string      `json:"reason,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Count     int         `json:"count"`
+	Solutions [][]jsonVar `json:"solutions"`
+	Time      jsonTime    `json:"time"`
+}
+
+// printJSON は解を JSON で書き出す関数。配列は JSON の配列とする。
+// 解決可能性は一つでも解があれば sat とする。
+// reason は最後の Check が unknown だった場合のその理由。
+func (c *Context) printJSON(w io.Writer, names []string, s *solveStats, all bool) {
+	status := s.status.String()
+	if len(s.solutions) > 0 {
+		status = StatusSat.String()
+	} else if s.status == StatusSat {
+		// 解決可能だが値を取得できなかった
+		status = StatusUnknown.String()
+	}
+	reason := ""
+	if s.status == StatusUnknown {
+		reason = s.reason
+	}
+	errText := ""
+	if s.err != nil {
+		errText = s.err.Error()
+	}
+	t := jsonTime{Check: milliseconds(s.check), Model: milliseconds(s.model)}
+
+	solutions := [][]jsonVar{}
+	for _, r := range s.solutions {
+		solutions = append(solutions, c.jsonVars(names, r))
+	}
+
+	var out interface{}
+	if all {
+		out = jsonSolveAll{Status: status, Reason: reason, Error: errText, Count: len(solutions), Solutions: solutions, Time: t}
+	} else {
+		vars := []jsonVar{}
+		if len(solutions) > 0 {
+			vars = solutions[0]
+		}
+		out = jsonSolve{Status: status, Reason: reason, Error: errText, Variables: vars, Time: t}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(out)
+}
+
+// jsonVars は Solve の引数ごとの制約変数の値を返す関数
+func (c *Context) jsonVars(names []string, r *Result) []jsonVar {
+	vars := []jsonVar{}
+	for _, g := range c.groups(names) {
+		first, _ := r.Value(g.elems[0])
+		if !g.array {
+			vars = append(vars, jsonVar{Name: g.name, Sort: first.Sort, Value: jsonValue(first)})
+			continue
+		}
+		values := make([]interface{}, len(g.elems))
+		for i, name := range g.elems {
+			v, _ := r.Value(name)
+			values[i] = jsonValue(v)
+		}
+		vars = append(vars, jsonVar{Name: g.name, Sort: first.Sort, Value: values})
+	}
+	return vars
+}
+
+// jsonRat は JSON で出力する有理数。無理数は近似値と Z3 の表記とする。
+type jsonRat struct {
+	Num    json.Number `json:"num,omitempty"`
+	Den    json.Number `json:"den,omitempty"`
+	Approx string      `json:"approx,omitempty"`
+	Text   string      `json:"text,omitempty"`
+}
+
+// jsonValue は値を JSON の値にする関数。
+// Int は数値、Bool は真偽値、Num は分子と分母のオブジェクトとする。
+func jsonValue(v Value) interface{} {
+	switch {
+	case v.Sort == SortBool:
+		return v.Bool
+	case v.Int != nil:
+		return json.Number(v.Int.String())
+	case v.Rat != nil:
+		return jsonRat{Num: json.Number(v.Rat.Num().String()), Den: json.Number(v.Rat.Denom().String())}
+	}
+	return jsonRat{Approx: strings.TrimSuffix(v.Approx, "?"), Text: v.Text}
+}
+
+// milliseconds は所要時間をミリ秒で表す関数
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,296 @@
+package smt
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Status は制約の解決可能性を表す型
+type Status int
+
+// 制約の解決可能性
+const (
+	StatusUnknown Status = iota // 判定できない
+	StatusSat                   // 解決可能
+	StatusUnsat                 // 解決不能
+)
+
+// String は解決可能性の文字列表現を返す関数
+func (s Status) String() string {
+	switch s {
+	case StatusSat:
+		return "sat"
+	case StatusUnsat:
+		return "unsat"
+	}
+	return "unknown"
+}
+
+// 制約変数のソート
+const (
+	SortInt  = "Int"
+	SortNum  = "Num"
+	SortBool = "Bool"
+)
+
+// 数値（Num）の表示形式
+const (
+	NumFormatZ3   = "z3"   // Z3 の表記のまま: (/ 8.0 3.0)
+	NumFormatFrac = "frac" // 分数: 8/3
+	NumFormatDec  = "dec"  // 小数: 2.6666666666?
+	NumFormatBoth = "both" // 分数と小数: 8/3 (2.6666666666?)
+)
+
+// Value は制約変数に割り当てられた値を表す構造体型
+type Value struct {
+	Sort   string   // SortInt, SortNum, SortBool のいずれか
+	Int    *big.Int // Sort が SortInt の場合の値
+	Rat    *big.Rat // Sort が SortNum で有理数の場合の値
+	Bool   bool     // Sort が SortBool の場合の値
+	Text   string   // Z3 の表記
+	Approx string   // 無理数（代数的数）の場合の小数による近似値。桁数は表示の際に切り詰める
+}
+
+// Format は値を表示形式に従って文字列化する関数
+func (v Value) Format(kind string, digits int) string {
+	if kind == NumFormatZ3 || v.Sort == SortBool {
+		return v.Text
+	}
+	if v.Int != nil {
+		return v.Int.String()
+	}
+
+	var frac, dec string
+	switch {
+	case v.Rat != nil:
+		// 有理数
+		frac = v.Rat.RatString()
+		dec = decimalString(v.Rat, digits)
+	case v.Approx != "":
+		// 非線形の問題で現れる無理数（代数的数）は分数では表せないので
+		// Z3 の root-obj 表記を厳密な値とする
+		frac = v.Text
+		dec = truncateDecimal(v.Approx, digits)
+	default:
+		return v.Text
+	}
+
+	switch kind {
+	case NumFormatFrac:
+		return frac
+	case NumFormatDec:
+		return dec
+	default: // NumFormatBoth
+		if frac == dec {
+			return frac
+		}
+		return fmt.Sprintf("%s (%s)", frac, dec)
+	}
+}
+
+// NewIntValue は整数の値を作成する関数
+func NewIntValue(n *big.Int) Value {
+	return Value{Sort: SortInt, Int: new(big.Int).Set(n), Text: intText(n)}
+}
+
+// NewNumValue は有理数の値を作成する関数
+func NewNumValue(r *big.Rat) Value {
+	return Value{Sort: SortNum, Rat: new(big.Rat).Set(r), Text: ratText(r)}
+}
+
+// NewBoolValue は真理値の値を作成する関数
+func NewBoolValue(b bool) Value {
+	return Value{Sort: SortBool, Bool: b, Text: fmt.Sprint(b)}
+}
+
+// term は値を定数の項にする関数。無理数は項にできないので false を返す。
+func (v Value) term() (*Term, bool) {
+	switch {
+	case v.Sort == SortBool:
+		return BoolConst(v.Bool), true
+	case v.Int != nil:
+		return IntConst(v.Int), true
+	case v.Rat != nil:
+		return NumConst(v.Rat), true
+	}
+	return nil, false
+}
+
+// intText は整数を Z3 の表記で表す関数: -5 は (- 5)
+func intText(n *big.Int) string {
+	if n.Sign() < 0 {
+		return "(- " + new(big.Int).Neg(n).String() + ")"
+	}
+	return n.String()
+}
+
+// ratText は有理数を Z3 の表記で表す関数: 3 は 3.0、-1/3 は (- (/ 1.0 3.0))
+func ratText(r *big.Rat) string {
+	abs := new(big.Rat).Abs(r)
+	s := abs.Num().String() + ".0"
+	if !abs.IsInt() {
+		s = "(/ " + s + " " + abs.Denom().String() + ".0)"
+	}
+	if r.Sign() < 0 {
+		return "(- " + s + ")"
+	}
+	return s
+}
+
+// truncateDecimal は "1.4142135623?" のような小数の近似値を小数点以下 digits 桁までに切り詰める関数
+func truncateDecimal(s string, digits int) string {
+	s = strings.TrimSuffix(s, "?")
+	i := strings.Index(s, ".")
+	if i < 0 || len(s)-i-1 <= digits {
+		return s + "?"
+	}
+	if digits == 0 {
+		return s[:i] + "?"
+	}
+	return s[:i+1+digits] + "?"
+}
+
+// decimalString は有理数を小数点以下 digits 桁までの小数で表す関数。
+// Z3 と同様に、切り捨てがある場合は末尾に "?" をつける。
+func decimalString(r *big.Rat, digits int) string {
+	sign := ""
+	if r.Sign() < 0 {
+		sign = "-"
+	}
+	abs := new(big.Rat).Abs(r)
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	num := new(big.Int).Mul(abs.Num(), scale)
+	q, m := new(big.Int).QuoRem(num, abs.Denom(), new(big.Int))
+
+	s := q.String()
+	if len(s) <= digits {
+		s = strings.Repeat("0", digits-len(s)+1) + s
+	}
+	intPart, fracPart := s[:len(s)-digits], strings.TrimRight(s[len(s)-digits:], "0")
+	if m.Sign() != 0 {
+		if digits == 0 {
+			return sign + intPart + "?"
+		}
+		fracPart = s[len(s)-digits:] + "?"
+	}
+	if fracPart == "" {
+		return sign + intPart
+	}
+	return sign + intPart + "." + fracPart
+}
+
+// Result は制約を満たす値の集まりを表す構造体型
+type Result struct {
+	names  []string // 宣言順の制約変数名
+	values map[string]Value
+}
+
+// Names は値が割り当てられた制約変数名を宣言順に返す関数
+func (r *Result) Names() []string {
+	return append([]string{}, r.names...)
+}
+
+// Each はすべての制約変数とその値について宣言順に f を呼び出す関数
+func (r *Result) Each(f func(name string, v Value)) {
+	for _, name := range r.names {
+		f(name, r.values[name])
+	}
+}
+
+// Value は制約変数の値を返す関数
+func (r *Result) Value(name string) (Value, bool) {
+	v, ok := r.values[name]
+	return v, ok
+}
+
+// lookup は指定されたソートの制約変数の値を返す関数
+func (r *Result) lookup(name, sort string) (Value, error) {
+	v, ok := r.values[name]
+	if !ok {
+		return v, fmt.Errorf("%s: no such variable", name)
+	}
+	if v.Sort != sort {
+		return v, fmt.Errorf("%s: sort is %s, not %s", name, v.Sort, sort)
+	}
+	return v, nil
+}
+
+// Int は整数型の制約変数の値を返す関数
+func (r *Result) Int(name string) (*big.Int, error) {
+	v, err := r.lookup(name, SortInt)
+	if err != nil {
+		return nil, err
+	}
+	if v.Int == nil {
+		return nil, fmt.Errorf("%s: not a numeral: %s", name, v.Text)
+	}
+	return new(big.Int).Set(v.Int), nil
+}
+
+// Num は数値型の制約変数の値を返す関数。
+// 無理数（代数的数）の場合はエラーを返す。
+func (r *Result) Num(name string) (*big.Rat, error) {
+	v, err := r.lookup(name, SortNum)
+	if err != nil {
+		return nil, err
+	}
+	if v.Rat == nil {
+		return nil, fmt.Errorf("%s: not a rational number: %s", name, v.Text)
+	}
+	return new(big.Rat).Set(v.Rat), nil
+}
+
+// Bool はブール型の制約変数の値を返す関数
+func (r *Result) Bool(name string) (bool, error) {
+	v, err := r.lookup(name, SortBool)
+	return v.Bool, err
+}
+
+// arrayLen は配列の制約変数 name[0], name[1], ... の要素数を返す関数
+func (r *Result) arrayLen(name string) (int, error) {
+	n := 0
+	for {
+		if _, ok := r.values[fmt.Sprintf("%s[%d]", name, n)]; !ok {
+			break
+		}
+		n++
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("%s: no such array", name)
+	}
+	return n, nil
+}
+
+// IntArray は整数型の配列の制約変数の値を返す関数
+func (r *Result) IntArray(name string) (vs []*big.Int, err error) {
+	n, err := r.arrayLen(name)
+	for i := 0; i < n && err == nil; i++ {
+		var v *big.Int
+		v, err = r.Int(fmt.Sprintf("%s[%d]", name, i))
+		vs = append(vs, v)
+	}
+	return
+}
+
+// NumArray は数値型の配列の制約変数の値を返す関数
+func (r *Result) NumArray(name string) (vs []*big.Rat, err error) {
+	n, err := r.arrayLen(name)
+	for i := 0; i < n && err == nil; i++ {
+		var v *big.Rat
+		v, err = r.Num(fmt.Sprintf("%s[%d]", name, i))
+		vs = append(vs, v)
+	}
+	return
+}
+
+// BoolArray はブール型の配列の制約変数の値を返す関数
+func (r *Result) BoolArray(name string) (vs []bool, err error) {
+	n, err := r.arrayLen(name)
+	for i := 0; i < n && err == nil; i++ {
+		var v bool
+		v, err = r.Bool(fmt.Sprintf("%s[%d]", name, i))
+		vs = append(vs, v)
+	}
+	return
+}
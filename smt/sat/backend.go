@@ -0,0 +1,628 @@
+// Package sat は CDCL による SAT ソルバーを内蔵した smt パッケージのバックエンド。
+// 範囲の限られた Int の算術と Distinct をビット列の回路に変換（bit-blasting）して
+// CNF の節とし、内蔵の SAT ソルバーで解決する。
+// インポートすると "sat" という名前でバックエンドが登録される。
+// また、Bool だけの問題を DIMACS CNF 形式で書き出す "dimacs" という書き出し形式も登録される。
+//
+// 整数型の制約変数の範囲は Assert(x >= lo && x < hi) のような制約から推定するので、
+// 範囲の分からない変数を含む制約は扱えない。Num（実数）はサポートしない。
+package sat
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+func init() {
+	smt.RegisterBackend("sat", func() (smt.Backend, error) {
+		return New(), nil
+	})
+}
+
+// variable は宣言された制約変数を表す構造体型
+type variable struct {
+	name string
+	sort string
+}
+
+// Backend は SAT ソルバーと、制約変数に対応するリテラルを保持する構造体型
+type Backend struct {
+	s *Solver
+	c *circuit
+
+	vars    []variable
+	pending []*smt.Term // まだ節に変換していない制約条件
+	bounds  map[string]*interval
+
+	ints  map[string]bits // 整数型の制約変数のビット列
+	bools map[string]int  // ブール型の制約変数のリテラル
+
+	solved  bool // 直前の Check の後に制約が追加されていないか
+	assumed bool // 直前の Check が仮定のもとでの CheckAssuming だったか
+	status  smt.Status
+}
+
+// New は SAT ソルバーのバックエンドを生成する関数
+func New() *Backend {
+	s := NewSolver()
+	return &Backend{
+		s:      s,
+		c:      newCircuit(s),
+		bounds: map[string]*interval{},
+		ints:   map[string]bits{},
+		bools:  map[string]int{},
+	}
+}
+
+// Interrupt は実行中の Check の探索を中断する関数。別のゴルーチンから呼び出してよい。
+func (b *Backend) Interrupt() {
+	b.s.Interrupt()
+}
+
+// Statistics は SAT ソルバーの統計情報を返す関数
+func (b *Backend) Statistics() []smt.Stat {
+	return []smt.Stat{
+		{Key: "sat.vars", Value: float64(b.s.NumVars())},
+		{Key: "sat.clauses", Value: float64(b.s.NumClauses())},
+		{Key: "sat.conflicts", Value: float64(b.s.Conflicts)},
+		{Key: "sat.decisions", Value: float64(b.s.Decisions)},
+		{Key: "sat.propagations", Value: float64(b.s.Propagations)},
+		{Key: "sat.restarts", Value: float64(b.s.Restarts)},
+	}
+}
+
+// Solver は内蔵の SAT ソルバーを返す関数。統計情報の取得に使う。
+func (b *Backend) Solver() *Solver {
+	return b.s
+}
+
+// DeclareVar は制約変数を宣言する関数
+func (b *Backend) DeclareVar(name, sort string) error {
+	if sort != smt.SortInt && sort != smt.SortBool {
+		return fmt.Errorf("sat: %s: sort %s is not supported; use the z3 backend", name, sort)
+	}
+	b.vars = append(b.vars, variable{name: name, sort: sort})
+	b.bounds[name] = &interval{}
+	b.solved = false
+	return nil
+}
+
+// Assert は制約条件を追加する関数。節への変換は Check の際に行う。
+func (b *Backend) Assert(cond *smt.Term) error {
+	if err := supported(cond); err != nil {
+		return err
+	}
+	b.pending = append(b.pending, cond)
+	b.solved = false
+	return nil
+}
+
+// supported は項がこのバックエンドで扱えるかどうかを調べる関数
+func supported(t *smt.Term) error {
+	switch {
+	case t.Sort == smt.SortNum:
+		return fmt.Errorf("sat: Num is not supported: %s", t)
+	case t.Op == smt.OpToInt || t.Op == smt.OpIsInt:
+		return fmt.Errorf("sat: operator %s is not supported", t.Op)
+	case t.Op == smt.OpPow:
+		if _, ok := constInt(t.Args[1]); !ok {
+			return fmt.Errorf("sat: exponent must be a constant: %s", t)
+		}
+	}
+	for _, arg := range t.Args {
+		if err := supported(arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check は制約が解決可能かどうかを調べる関数
+func (b *Backend) Check() (smt.Status, error) {
+	if b.solved && !b.assumed {
+		return b.status, nil
+	}
+	if err := b.flush(); err != nil {
+		return smt.StatusUnknown, err
+	}
+	b.assumed = false
+	return b.solve()
+}
+
+// CheckAssuming は lits の制約条件を一時的に仮定して、制約が解決可能かどうかを調べる関数。
+// 仮定はリテラルに変換して SAT ソルバーの最初の決定とするので、学習した節は次の Check でも使える。
+// 仮定の制約条件からは変数の範囲を推定しない。
+func (b *Backend) CheckAssuming(lits []*smt.Term) (smt.Status, error) {
+	if err := b.flush(); err != nil {
+		return smt.StatusUnknown, err
+	}
+	var assumptions []int
+	for _, t := range lits {
+		if err := supported(t); err != nil {
+			return smt.StatusUnknown, err
+		}
+		lit, err := b.boolLit(t)
+		if err != nil {
+			return smt.StatusUnknown, err
+		}
+		assumptions = append(assumptions, lit)
+	}
+	b.assumed = true
+	return b.solve(assumptions...)
+}
+
+// flush はまだ節に変換していない制約条件を節に変換して SAT ソルバーに追加する関数
+func (b *Backend) flush() error {
+	// 制約条件から変数の範囲を推定してから節に変換する
+	for _, cond := range b.pending {
+		b.inferBounds(cond)
+	}
+	for len(b.pending) > 0 {
+		lit, err := b.boolLit(b.pending[0])
+		if err != nil {
+			return err
+		}
+		b.s.AddClause(lit)
+		b.pending = b.pending[1:]
+	}
+	return nil
+}
+
+// solve は assumptions を仮定して SAT ソルバーで解決する関数
+func (b *Backend) solve(assumptions ...int) (smt.Status, error) {
+	b.s.stop.Store(false)
+	b.status = smt.StatusUnsat
+	if b.s.Solve(assumptions...) {
+		b.status = smt.StatusSat
+	} else if b.s.Interrupted() {
+		// 中断された場合は判定できない。次の Check で探索し直す
+		b.status = smt.StatusUnknown
+		return b.status, nil
+	}
+	b.solved = true
+	return b.status, nil
+}
+
+// Model は宣言されたすべての制約変数の値を返す関数
+func (b *Backend) Model() (map[string]smt.Value, error) {
+	if !b.solved || b.status != smt.StatusSat {
+		return nil, fmt.Errorf("sat: no model")
+	}
+	values := map[string]smt.Value{}
+	for _, v := range b.vars {
+		if v.sort == smt.SortBool {
+			lit, ok := b.bools[v.name]
+			values[v.name] = smt.NewBoolValue(ok && b.s.Value(lit))
+			continue
+		}
+		x, ok := b.ints[v.name]
+		if !ok {
+			// 制約に現れない変数は 0 に近い値とする
+			values[v.name] = smt.NewIntValue(b.bounds[v.name].closestToZero())
+			continue
+		}
+		values[v.name] = smt.NewIntValue(b.decode(x))
+	}
+	return values, nil
+}
+
+// decode はビット列の値を2の補数表現の整数として読み出す関数
+func (b *Backend) decode(x bits) *big.Int {
+	n := new(big.Int)
+	for i := len(x) - 1; i >= 0; i-- {
+		n.Lsh(n, 1)
+		if b.s.Value(x[i]) {
+			n.SetBit(n, 0, 1)
+		}
+	}
+	if b.s.Value(x[len(x)-1]) {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(x))))
+	}
+	return n
+}
+
+// Close は何もしない。Backend インタフェースを満たすための関数。
+func (b *Backend) Close() error {
+	return nil
+}
+
+// inferBounds は制約条件から変数の範囲を推定する関数
+func (b *Backend) inferBounds(t *smt.Term) {
+	for name, r := range boundsOf(t) {
+		b.bounds[name].tighten(r.lo, r.hi)
+	}
+}
+
+// boundsOf は x >= c のような比較とその論理積、論理和から変数の範囲を求める関数。
+// 論理和 x == 0 || x == 1 の範囲はそれぞれの範囲を含む最小の区間とする。
+func boundsOf(t *smt.Term) map[string]*interval {
+	m := map[string]*interval{}
+	switch t.Op {
+	case smt.OpAnd:
+		for _, arg := range t.Args {
+			for name, r := range boundsOf(arg) {
+				if m[name] == nil {
+					m[name] = &interval{}
+				}
+				m[name].tighten(r.lo, r.hi)
+			}
+		}
+	case smt.OpOr:
+		for i, arg := range t.Args {
+			sub := boundsOf(arg)
+			if i == 0 {
+				m = sub
+				continue
+			}
+			for name, r := range m {
+				s, ok := sub[name]
+				if !ok {
+					delete(m, name)
+					continue
+				}
+				r.widen(s)
+			}
+		}
+	case smt.OpEq, smt.OpLt, smt.OpLe, smt.OpGt, smt.OpGe:
+		if name, r, ok := compareBounds(t); ok {
+			m[name] = r
+		}
+	}
+	return m
+}
+
+// compareBounds は x op c または c op x の形の比較から変数 x の範囲を求める関数
+func compareBounds(t *smt.Term) (string, *interval, bool) {
+	op, x, y := t.Op, t.Args[0], t.Args[1]
+	if x.Op != smt.OpVar {
+		// c op x を x op' c に読み替える
+		x, y = y, x
+		switch op {
+		case smt.OpLt:
+			op = smt.OpGt
+		case smt.OpLe:
+			op = smt.OpGe
+		case smt.OpGt:
+			op = smt.OpLt
+		case smt.OpGe:
+			op = smt.OpLe
+		}
+	}
+	c, ok := constInt(y)
+	if x.Op != smt.OpVar || x.Sort != smt.SortInt || !ok {
+		return "", nil, false
+	}
+
+	one := big.NewInt(1)
+	r := &interval{}
+	switch op {
+	case smt.OpEq:
+		r.tighten(c, c)
+	case smt.OpLt:
+		r.tighten(nil, new(big.Int).Sub(c, one))
+	case smt.OpLe:
+		r.tighten(nil, c)
+	case smt.OpGt:
+		r.tighten(new(big.Int).Add(c, one), nil)
+	case smt.OpGe:
+		r.tighten(c, nil)
+	}
+	return x.Name, r, true
+}
+
+// constInt は定数だけからなる整数の項の値を求める関数
+func constInt(t *smt.Term) (*big.Int, bool) {
+	if t.Sort != smt.SortInt {
+		return nil, false
+	}
+	switch t.Op {
+	case smt.OpConst:
+		return new(big.Int).Set(t.Num.Num()), true
+	case smt.OpNeg:
+		v, ok := constInt(t.Args[0])
+		if !ok {
+			return nil, false
+		}
+		return v.Neg(v), true
+	case smt.OpAdd, smt.OpSub, smt.OpMul:
+		v, ok := constInt(t.Args[0])
+		if !ok {
+			return nil, false
+		}
+		for _, arg := range t.Args[1:] {
+			w, ok := constInt(arg)
+			if !ok {
+				return nil, false
+			}
+			switch t.Op {
+			case smt.OpAdd:
+				v.Add(v, w)
+			case smt.OpSub:
+				v.Sub(v, w)
+			default:
+				v.Mul(v, w)
+			}
+		}
+		return v, true
+	}
+	return nil, false
+}
+
+// boolLit は Bool の項をリテラルに変換する関数
+func (b *Backend) boolLit(t *smt.Term) (int, error) {
+	switch t.Op {
+	case smt.OpVar:
+		lit, ok := b.bools[t.Name]
+		if !ok {
+			lit = b.s.NewVar()
+			b.bools[t.Name] = lit
+		}
+		return lit, nil
+	case smt.OpConst:
+		return b.c.constant(t.Bool), nil
+	case smt.OpEq, smt.OpDistinct, smt.OpLt, smt.OpLe, smt.OpGt, smt.OpGe:
+		if t.Args[0].Sort != smt.SortBool {
+			return b.compare(t)
+		}
+	}
+
+	args := make([]int, len(t.Args))
+	for i, arg := range t.Args {
+		lit, err := b.boolLit(arg)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = lit
+	}
+
+	if lit, ok := b.c.gate(t.Op, args); ok {
+		return lit, nil
+	}
+	return 0, fmt.Errorf("sat: unsupported operator %s", t.Op)
+}
+
+// compare は Int の比較の項をリテラルに変換する関数
+func (b *Backend) compare(t *smt.Term) (int, error) {
+	args := make([]bits, len(t.Args))
+	for i, arg := range t.Args {
+		x, _, err := b.intBits(arg)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = x
+	}
+
+	x, y := args[0], args[len(args)-1]
+	switch t.Op {
+	case smt.OpEq:
+		return b.c.eq(x, y), nil
+	case smt.OpDistinct:
+		var lits []int
+		for i := range args {
+			for j := i + 1; j < len(args); j++ {
+				lits = append(lits, -b.c.eq(args[i], args[j]))
+			}
+		}
+		return b.c.andAll(lits), nil
+	case smt.OpLt:
+		return b.c.lt(x, y), nil
+	case smt.OpLe:
+		return b.c.le(x, y), nil
+	case smt.OpGt:
+		return b.c.lt(y, x), nil
+	}
+	return b.c.le(y, x), nil // smt.OpGe
+}
+
+// intBits は Int の項をビット列に変換する関数。値の範囲も返す。
+func (b *Backend) intBits(t *smt.Term) (bits, interval, error) {
+	switch t.Op {
+	case smt.OpVar:
+		return b.intVar(t.Name)
+	case smt.OpConst:
+		v := t.Num.Num()
+		r := interval{v, v}
+		return b.c.constBits(v, r.width()), r, nil
+	case smt.OpIte:
+		sel, err := b.boolLit(t.Args[0])
+		if err != nil {
+			return nil, interval{}, err
+		}
+		x, rx, err := b.intBits(t.Args[1])
+		if err != nil {
+			return nil, interval{}, err
+		}
+		y, ry, err := b.intBits(t.Args[2])
+		if err != nil {
+			return nil, interval{}, err
+		}
+		r := hull(rx.lo, rx.hi, ry.lo, ry.hi)
+		return b.c.ite(sel, x, y, r.width()), r, nil
+	case smt.OpPow:
+		// 指数が定数のべき乗は乗算の繰り返しとする
+		e, _ := constInt(t.Args[1])
+		base := t.Args[0]
+		p := smt.IntConst(big.NewInt(1))
+		for i := int64(0); i < e.Int64(); i++ {
+			p = p.Mul(base)
+		}
+		return b.intBits(p)
+	}
+
+	args := make([]bits, len(t.Args))
+	ranges := make([]interval, len(t.Args))
+	for i, arg := range t.Args {
+		x, r, err := b.intBits(arg)
+		if err != nil {
+			return nil, interval{}, err
+		}
+		args[i], ranges[i] = x, r
+	}
+	x, rx := args[0], ranges[0]
+
+	switch t.Op {
+	case smt.OpNeg:
+		r := rx.neg()
+		return b.c.sub(b.c.constBits(big.NewInt(0), 1), x, r.width()), r, nil
+	case smt.OpAdd, smt.OpSub, smt.OpMul:
+		for i := 1; i < len(args); i++ {
+			y, ry := args[i], ranges[i]
+			var r interval
+			switch t.Op {
+			case smt.OpAdd:
+				r = rx.add(ry)
+				x = b.c.add(x, y, -b.c.t, r.width())
+			case smt.OpSub:
+				r = rx.add(ry.neg())
+				x = b.c.sub(x, y, r.width())
+			default:
+				r = rx.mul(ry)
+				x = b.c.mul(x, y, r.width())
+			}
+			rx = r
+		}
+		return x, rx, nil
+	case smt.OpDiv, smt.OpMod:
+		return b.divMod(t.Op, x, rx, args[1], ranges[1])
+	}
+	return nil, interval{}, fmt.Errorf("sat: unsupported operator %s", t.Op)
+}
+
+// intVar は整数型の制約変数のビット列を返す関数。
+// 初めて現れた変数は推定した範囲に収まる幅のビット列を作成する。
+func (b *Backend) intVar(name string) (bits, interval, error) {
+	r := *b.bounds[name]
+	if r.lo == nil || r.hi == nil {
+		return nil, interval{}, fmt.Errorf("sat: cannot infer bounds of %s; add Assert(%s >= lo && %s < hi)", name, name, name)
+	}
+	if r.lo.Cmp(r.hi) > 0 {
+		// 範囲が空なので解決不能
+		b.s.AddClause()
+		r.hi = r.lo
+	}
+	x, ok := b.ints[name]
+	if !ok {
+		x = b.c.newBits(r.width())
+		b.ints[name] = x
+		b.s.AddClause(b.c.le(b.c.constBits(r.lo, r.width()), x))
+		b.s.AddClause(b.c.le(x, b.c.constBits(r.hi, r.width())))
+	}
+	return x, r, nil
+}
+
+// divMod は Z3 と同じく剰余が非負となる整数除算の商と剰余のビット列を求める関数。
+// 商 q と剰余 r を新しい変数とし、y != 0 ならば x == y*q + r かつ 0 <= r < |y| とする。
+func (b *Backend) divMod(op smt.Op, x bits, rx interval, y bits, ry interval) (bits, interval, error) {
+	one := big.NewInt(1)
+	m := new(big.Int).Add(maxAbs(rx), one)
+	rq := interval{new(big.Int).Neg(m), m}
+	rr := interval{big.NewInt(0), new(big.Int).Sub(maxAbs(ry), one)}
+	if rr.hi.Sign() < 0 {
+		rr.hi = big.NewInt(0)
+	}
+	q, r := b.c.newBits(rq.width()), b.c.newBits(rr.width())
+
+	// y*q + r を x と比較できる幅で求める
+	p := ry.mul(rq)
+	sum := p.add(rr)
+	w := hull(sum.lo, sum.hi, rx.lo, rx.hi).width()
+	yq := b.c.mul(y, q, w)
+	rhs := b.c.add(yq, r, -b.c.t, w)
+
+	zero := b.c.constBits(big.NewInt(0), 1)
+	absY := b.c.ite(b.c.lt(y, zero), b.c.sub(zero, y, len(y)+1), y, len(y)+1)
+	ok := b.c.andAll([]int{b.c.eq(x, rhs), b.c.le(zero, r), b.c.lt(r, absY)})
+	b.s.AddClause(b.c.eq(y, zero), ok)
+
+	if op == smt.OpDiv {
+		return q, rq, nil
+	}
+	return r, rr, nil
+}
+
+// interval は整数の区間を表す構造体型。nil の端点は無限を表す。
+type interval struct {
+	lo, hi *big.Int
+}
+
+// tighten は区間を [lo, hi] との共通部分に狭める関数
+func (r *interval) tighten(lo, hi *big.Int) {
+	if lo != nil && (r.lo == nil || lo.Cmp(r.lo) > 0) {
+		r.lo = lo
+	}
+	if hi != nil && (r.hi == nil || hi.Cmp(r.hi) < 0) {
+		r.hi = hi
+	}
+}
+
+// widen は区間を s を含むように広げる関数
+func (r *interval) widen(s *interval) {
+	if r.lo != nil && (s.lo == nil || s.lo.Cmp(r.lo) < 0) {
+		r.lo = s.lo
+	}
+	if r.hi != nil && (s.hi == nil || s.hi.Cmp(r.hi) > 0) {
+		r.hi = s.hi
+	}
+}
+
+// closestToZero は区間のうち 0 に最も近い値を返す関数
+func (r *interval) closestToZero() *big.Int {
+	switch {
+	case r.lo != nil && r.lo.Sign() > 0:
+		return r.lo
+	case r.hi != nil && r.hi.Sign() < 0:
+		return r.hi
+	}
+	return big.NewInt(0)
+}
+
+// width は区間の値を2の補数表現で表すのに必要なビット数を返す関数
+func (r interval) width() int {
+	return maxInt(bitsNeeded(r.lo), bitsNeeded(r.hi))
+}
+
+// bitsNeeded は整数を2の補数表現で表すのに必要なビット数を返す関数
+func bitsNeeded(v *big.Int) int {
+	if v.Sign() >= 0 {
+		return v.BitLen() + 1
+	}
+	return new(big.Int).Not(v).BitLen() + 1
+}
+
+func (r interval) neg() interval {
+	return interval{new(big.Int).Neg(r.hi), new(big.Int).Neg(r.lo)}
+}
+
+func (r interval) add(s interval) interval {
+	return interval{new(big.Int).Add(r.lo, s.lo), new(big.Int).Add(r.hi, s.hi)}
+}
+
+func (r interval) mul(s interval) interval {
+	m := func(x, y *big.Int) *big.Int { return new(big.Int).Mul(x, y) }
+	return hull(m(r.lo, s.lo), m(r.lo, s.hi), m(r.hi, s.lo), m(r.hi, s.hi))
+}
+
+// hull は値の集まりを含む最小の区間を返す関数
+func hull(vs ...*big.Int) interval {
+	r := interval{vs[0], vs[0]}
+	for _, v := range vs[1:] {
+		if v.Cmp(r.lo) < 0 {
+			r.lo = v
+		}
+		if v.Cmp(r.hi) > 0 {
+			r.hi = v
+		}
+	}
+	return r
+}
+
+// maxAbs は区間の値の絶対値の最大値を返す関数
+func maxAbs(r interval) *big.Int {
+	lo, hi := new(big.Int).Abs(r.lo), new(big.Int).Abs(r.hi)
+	if lo.Cmp(hi) > 0 {
+		return lo
+	}
+	return hi
+}
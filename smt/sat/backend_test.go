@@ -0,0 +1,159 @@
+package sat
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+func TestWidth(t *testing.T) {
+	// 変数のビット列は範囲に収まる最小の幅なので、演算の結果が範囲の端で桁あふれしないことを調べる
+	tests := []struct {
+		name   string
+		lo, hi int64
+		cond   func(x *smt.Term) *smt.Term
+		want   smt.Status
+		x      int64 // 解決可能な場合の x の値
+	}{
+		{"sum beyond the width", 0, 7, func(x *smt.Term) *smt.Term { return x.Add(x).Eq(intConst(14)) }, smt.StatusSat, 7},
+		{"increment beyond the width", 0, 7, func(x *smt.Term) *smt.Term { return x.Add(intConst(1)).Eq(intConst(8)) }, smt.StatusSat, 7},
+		{"square at the upper bound", 0, 7, func(x *smt.Term) *smt.Term { return x.Mul(x).Eq(intConst(49)) }, smt.StatusSat, 7},
+		{"square above the range", 0, 7, func(x *smt.Term) *smt.Term { return x.Mul(x).Gt(intConst(49)) }, smt.StatusUnsat, 0},
+		{"square at the lower bound", -8, 7, func(x *smt.Term) *smt.Term { return x.Mul(x).Eq(intConst(64)) }, smt.StatusSat, -8},
+		{"negation of the lower bound", -8, 7, func(x *smt.Term) *smt.Term { return x.Neg().Eq(intConst(8)) }, smt.StatusSat, -8},
+		{"decrement below the range", -8, 7, func(x *smt.Term) *smt.Term { return x.Sub(intConst(1)).Lt(intConst(-8)) }, smt.StatusSat, -8},
+		{"cube", -8, 7, func(x *smt.Term) *smt.Term { return x.Pow(intConst(3)).Eq(intConst(-512)) }, smt.StatusSat, -8},
+		{"outside the range", -8, 7, func(x *smt.Term) *smt.Term { return x.Eq(intConst(8)) }, smt.StatusUnsat, 0},
+		{"wide range", 0, 1 << 40, func(x *smt.Term) *smt.Term { return x.Mul(intConst(2)).Eq(intConst(1 << 41)) }, smt.StatusSat, 1 << 40},
+		{"empty range", 5, 2, func(x *smt.Term) *smt.Term { return x.Eq(x) }, smt.StatusUnsat, 0},
+	}
+	for _, tt := range tests {
+		c := smt.NewContext(New())
+		x := c.IntVar("x")
+		c.Assert(x.Ge(intConst(tt.lo)).And(x.Le(intConst(tt.hi))))
+		c.Assert(tt.cond(x))
+		st, err := c.Check()
+		if st != tt.want || err != nil {
+			t.Errorf("%s: Check() = %s, %v; want %s", tt.name, st, err, tt.want)
+		} else if st == smt.StatusSat {
+			r, err := c.Model()
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			} else if v, _ := r.Int("x"); v.Int64() != tt.x {
+				t.Errorf("%s: x = %s; want %d", tt.name, v, tt.x)
+			}
+		}
+		c.Close()
+	}
+}
+
+// intConst は整数の定数の項を返す関数
+func intConst(v int64) *smt.Term {
+	return smt.IntConst(big.NewInt(v))
+}
+
+func TestDivModCircuit(t *testing.T) {
+	// 除数も変数とした div と mod の回路を、範囲のすべての値について math/big の DivMod（ユークリッド除算）と比べる
+	for x := int64(-8); x <= 7; x++ {
+		for y := int64(-4); y <= 3; y++ {
+			if y == 0 {
+				continue
+			}
+			c := smt.NewContext(New())
+			xv, yv, q, m := c.IntVar("x"), c.IntVar("y"), c.IntVar("q"), c.IntVar("m")
+			c.Assert(xv.Ge(intConst(-8)).And(xv.Le(intConst(7)), yv.Ge(intConst(-4)), yv.Le(intConst(3))))
+			c.Assert(q.Ge(intConst(-9)).And(q.Le(intConst(9)), m.Ge(intConst(-9)), m.Le(intConst(9))))
+			c.Assert(xv.Eq(intConst(x)).And(yv.Eq(intConst(y))))
+			c.Assert(q.Eq(xv.Div(yv)).And(m.Eq(xv.Mod(yv))))
+			r, err := c.Model()
+			if err != nil {
+				t.Fatalf("%d div %d: %v", x, y, err)
+			}
+			wq, wm := new(big.Int).DivMod(big.NewInt(x), big.NewInt(y), new(big.Int))
+			gq, _ := r.Int("q")
+			gm, _ := r.Int("m")
+			if gq.Cmp(wq) != 0 || gm.Cmp(wm) != 0 {
+				t.Errorf("%d div %d, %d mod %d = %s, %s; want %s, %s", x, y, x, y, gq, gm, wq, wm)
+			}
+			c.Close()
+		}
+	}
+}
+
+func TestBoundsOf(t *testing.T) {
+	c := smt.NewContext(New())
+	defer c.Close()
+	x := c.IntVar("x")
+	tests := []struct {
+		name   string
+		cond   *smt.Term
+		lo, hi string // 空文字列は無限
+	}{
+		{"conjunction", x.Ge(intConst(2)).And(x.Lt(intConst(9))), "2", "8"},
+		{"constant on the left", intConst(3).Le(x), "3", ""},
+		{"strict upper bound", x.Lt(intConst(-1)), "", "-2"},
+		{"disjunction of values", x.Eq(intConst(0)).Or(x.Eq(intConst(5))), "0", "5"},
+		{"negative constant expression", x.Ge(intConst(4).Neg().Mul(intConst(2))), "-8", ""},
+	}
+	for _, tt := range tests {
+		r := boundsOf(tt.cond)["x"]
+		if r == nil {
+			t.Errorf("%s: no bounds for x", tt.name)
+			continue
+		}
+		if lo, hi := bound(r.lo), bound(r.hi); lo != tt.lo || hi != tt.hi {
+			t.Errorf("%s: bounds [%s, %s]; want [%s, %s]", tt.name, lo, hi, tt.lo, tt.hi)
+		}
+	}
+	// 変数と比較しない節がある論理和からは範囲を求めない
+	if r := boundsOf(x.Eq(intConst(0)).Or(x.Gt(x))); r["x"] != nil {
+		t.Errorf("bounds of x == 0 || x > x = %v; want none", r["x"])
+	}
+}
+
+// bound は区間の端点を文字列で返す関数。無限は空文字列とする
+func bound(v *big.Int) string {
+	if v == nil {
+		return ""
+	}
+	return v.String()
+}
+
+func TestUnbounded(t *testing.T) {
+	c := smt.NewContext(New())
+	defer c.Close()
+	x := c.IntVar("x")
+	c.Assert(x.Gt(intConst(0)))
+	_, err := c.Check()
+	if err == nil || !strings.Contains(err.Error(), "cannot infer bounds of x") {
+		t.Errorf("Check() error = %v; want a missing bounds error", err)
+	}
+}
+
+func TestCheckAssuming(t *testing.T) {
+	c := smt.NewContext(New())
+	defer c.Close()
+	x, y := c.IntVar("x"), c.IntVar("y")
+	c.Assert(x.Ge(intConst(0)).And(x.Le(intConst(7)), y.Ge(intConst(0)), y.Le(intConst(7))))
+	c.Assert(x.Mul(y).Eq(intConst(12)))
+
+	// 仮定のもとで解決不能でも、学習した節を残したまま仮定を外して解決できる
+	if st, err := c.CheckAssuming(x.Gt(y), y.Gt(intConst(3))); st != smt.StatusUnsat || err != nil {
+		t.Errorf("CheckAssuming(x > y, y > 3) = %s, %v; want unsat", st, err)
+	}
+	if st, err := c.CheckAssuming(x.Lt(y), y.Gt(intConst(5))); st != smt.StatusSat || err != nil {
+		t.Fatalf("CheckAssuming(x < y, y > 5) = %s, %v; want sat", st, err)
+	}
+	r, err := c.Model()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gx, _ := r.Int("x"); gx.Int64() != 2 {
+		t.Errorf("x = %s under the assumptions; want 2", gx)
+	}
+	if st, err := c.Check(); st != smt.StatusSat || err != nil {
+		t.Errorf("Check() = %s, %v after CheckAssuming; want sat", st, err)
+	}
+}
@@ -0,0 +1,267 @@
+package sat
+
+import (
+	"math/big"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+// clauseSink は回路から変数と節を受け取るインタフェース。
+// Solver と DIMACS の書き出しに使う CNF が実装する。
+type clauseSink interface {
+	NewVar() int
+	AddClause(lits ...int) bool
+}
+
+// circuit は論理回路を Tseitin 変換で節に変換しながら組み立てる構造体型。
+// 論理ゲートの出力はリテラルで表し、定数は真のリテラル t とその否定で表す。
+type circuit struct {
+	s clauseSink
+	t int // 常に真となるリテラル
+}
+
+// newCircuit は s に節を追加する回路を生成する関数
+func newCircuit(s clauseSink) *circuit {
+	t := s.NewVar()
+	s.AddClause(t)
+	return &circuit{s: s, t: t}
+}
+
+// constant は真理値の定数のリテラルを返す関数
+func (c *circuit) constant(b bool) int {
+	if b {
+		return c.t
+	}
+	return -c.t
+}
+
+// and は a かつ b のリテラルを返す関数
+func (c *circuit) and(a, b int) int {
+	switch {
+	case a == -c.t || b == -c.t || a == -b:
+		return -c.t
+	case a == c.t || a == b:
+		return b
+	case b == c.t:
+		return a
+	}
+	g := c.s.NewVar()
+	c.s.AddClause(-g, a)
+	c.s.AddClause(-g, b)
+	c.s.AddClause(g, -a, -b)
+	return g
+}
+
+// or は a または b のリテラルを返す関数
+func (c *circuit) or(a, b int) int {
+	return -c.and(-a, -b)
+}
+
+// xor は a と b の排他的論理和のリテラルを返す関数
+func (c *circuit) xor(a, b int) int {
+	switch {
+	case a == -c.t:
+		return b
+	case b == -c.t:
+		return a
+	case a == c.t:
+		return -b
+	case b == c.t:
+		return -a
+	case a == b:
+		return -c.t
+	case a == -b:
+		return c.t
+	}
+	g := c.s.NewVar()
+	c.s.AddClause(-g, a, b)
+	c.s.AddClause(-g, -a, -b)
+	c.s.AddClause(g, -a, b)
+	c.s.AddClause(g, a, -b)
+	return g
+}
+
+// mux は sel が真なら a、偽なら b となるリテラルを返す関数
+func (c *circuit) mux(sel, a, b int) int {
+	switch {
+	case sel == c.t || a == b:
+		return a
+	case sel == -c.t:
+		return b
+	}
+	g := c.s.NewVar()
+	c.s.AddClause(-sel, -a, g)
+	c.s.AddClause(-sel, a, -g)
+	c.s.AddClause(sel, -b, g)
+	c.s.AddClause(sel, b, -g)
+	return g
+}
+
+// andAll はすべてのリテラルの論理積を返す関数
+func (c *circuit) andAll(lits []int) int {
+	r := c.t
+	for _, l := range lits {
+		r = c.and(r, l)
+	}
+	return r
+}
+
+// orAll はすべてのリテラルの論理和を返す関数
+func (c *circuit) orAll(lits []int) int {
+	r := -c.t
+	for _, l := range lits {
+		r = c.or(r, l)
+	}
+	return r
+}
+
+// gate は Bool の演算子 op を引数のリテラル args に適用したリテラルを返す関数。
+// op が Bool の演算子でない場合は false を返す。
+func (c *circuit) gate(op smt.Op, args []int) (int, bool) {
+	switch op {
+	case smt.OpNot:
+		return -args[0], true
+	case smt.OpAnd:
+		return c.andAll(args), true
+	case smt.OpOr:
+		return c.orAll(args), true
+	case smt.OpXor:
+		return c.xor(args[0], args[1]), true
+	case smt.OpImplies:
+		return c.or(-args[0], args[1]), true
+	case smt.OpEq, smt.OpIff:
+		return -c.xor(args[0], args[1]), true
+	case smt.OpDistinct:
+		var lits []int
+		for i := range args {
+			for j := i + 1; j < len(args); j++ {
+				lits = append(lits, c.xor(args[i], args[j]))
+			}
+		}
+		return c.andAll(lits), true
+	case smt.OpIte:
+		return c.mux(args[0], args[1], args[2]), true
+	}
+	return 0, false
+}
+
+// bits は2の補数表現の符号付き整数のビット列（下位ビットから）を表す型
+type bits []int
+
+// constBits は整数 v を幅 w のビット列で表す関数
+func (c *circuit) constBits(v *big.Int, w int) bits {
+	// 2^w を法とした値のビットが2の補数表現となる
+	m := new(big.Int).Mod(v, new(big.Int).Lsh(big.NewInt(1), uint(w)))
+	x := make(bits, w)
+	for i := range x {
+		x[i] = c.constant(m.Bit(i) == 1)
+	}
+	return x
+}
+
+// newBits は幅 w の新しい変数のビット列を作成する関数
+func (c *circuit) newBits(w int) bits {
+	x := make(bits, w)
+	for i := range x {
+		x[i] = c.s.NewVar()
+	}
+	return x
+}
+
+// extend はビット列を符号拡張して幅 w にする関数
+func extend(x bits, w int) bits {
+	if len(x) >= w {
+		return x[:w]
+	}
+	y := append(bits{}, x...)
+	for len(y) < w {
+		y = append(y, x[len(x)-1])
+	}
+	return y
+}
+
+// add は x + y + carry を幅 w で求める関数（桁あふれは切り捨てる）
+func (c *circuit) add(x, y bits, carry int, w int) bits {
+	x, y = extend(x, w), extend(y, w)
+	z := make(bits, w)
+	for i := 0; i < w; i++ {
+		t := c.xor(x[i], y[i])
+		z[i] = c.xor(t, carry)
+		carry = c.or(c.and(x[i], y[i]), c.and(t, carry))
+	}
+	return z
+}
+
+// not は各ビットを反転したビット列を返す関数
+func not(x bits) bits {
+	y := make(bits, len(x))
+	for i := range x {
+		y[i] = -x[i]
+	}
+	return y
+}
+
+// sub は x - y を幅 w で求める関数
+func (c *circuit) sub(x, y bits, w int) bits {
+	return c.add(x, not(extend(y, w)), c.t, w)
+}
+
+// mul は x * y を幅 w で求める関数。結果が幅 w に収まる場合は符号付きの積となる。
+func (c *circuit) mul(x, y bits, w int) bits {
+	x, y = extend(x, w), extend(y, w)
+	z := c.constBits(big.NewInt(0), w)
+	for i := 0; i < w; i++ {
+		// y を i ビット左にずらし、x[i] との論理積をとった部分積
+		p := make(bits, w)
+		for j := range p {
+			if j < i {
+				p[j] = -c.t
+			} else {
+				p[j] = c.and(y[j-i], x[i])
+			}
+		}
+		z = c.add(z, p, -c.t, w)
+	}
+	return z
+}
+
+// ite は sel が真なら x、偽なら y となるビット列を幅 w で求める関数
+func (c *circuit) ite(sel int, x, y bits, w int) bits {
+	x, y = extend(x, w), extend(y, w)
+	z := make(bits, w)
+	for i := range z {
+		z[i] = c.mux(sel, x[i], y[i])
+	}
+	return z
+}
+
+// eq は x == y のリテラルを返す関数
+func (c *circuit) eq(x, y bits) int {
+	w := maxInt(len(x), len(y))
+	x, y = extend(x, w), extend(y, w)
+	lits := make([]int, w)
+	for i := range lits {
+		lits[i] = -c.xor(x[i], y[i])
+	}
+	return c.andAll(lits)
+}
+
+// lt は符号付きの比較 x < y のリテラルを返す関数
+func (c *circuit) lt(x, y bits) int {
+	// 桁あふれしないように 1 ビット広げて x - y の符号を調べる
+	w := maxInt(len(x), len(y)) + 1
+	d := c.sub(x, y, w)
+	return d[w-1]
+}
+
+// le は符号付きの比較 x <= y のリテラルを返す関数
+func (c *circuit) le(x, y bits) int {
+	return -c.lt(y, x)
+}
+
+func maxInt(x, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
@@ -0,0 +1,253 @@
+package sat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+func init() {
+	smt.RegisterExporter("dimacs", WriteDIMACS)
+}
+
+// CNF は DIMACS CNF 形式の節の集合を表す構造体型。
+// 変数は 1 から NumVars までの整数で、リテラルは Solver と同じく正負の整数で表す。
+type CNF struct {
+	NumVars  int
+	Clauses  [][]int
+	Comments []string // コメント行（先頭の c を除く）
+}
+
+// NewVar は変数を一つ追加する関数
+func (f *CNF) NewVar() int {
+	f.NumVars++
+	return f.NumVars
+}
+
+// AddClause は節を追加する関数。常に true を返す。
+func (f *CNF) AddClause(lits ...int) bool {
+	f.Clauses = append(f.Clauses, append([]int{}, lits...))
+	return true
+}
+
+// ReadDIMACS は DIMACS CNF 形式の節の集合を読み込む関数。
+// 節は複数の行にまたがってもよい。SATLIB の形式の末尾の % 以降は無視する。
+func ReadDIMACS(r io.Reader) (*CNF, error) {
+	f := &CNF{}
+	header := false
+	var clause []int
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		switch {
+		case text == "":
+			continue
+		case text[0] == 'c':
+			f.Comments = append(f.Comments, strings.TrimSpace(text[1:]))
+			continue
+		case text[0] == '%':
+			return f, finish(f, header, clause)
+		case text[0] == 'p':
+			fields := strings.Fields(text)
+			if header || len(fields) != 4 || fields[1] != "cnf" {
+				return nil, fmt.Errorf("dimacs: line %d: bad problem line: %s", line, text)
+			}
+			n, err := strconv.Atoi(fields[2])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("dimacs: line %d: bad number of variables: %s", line, fields[2])
+			}
+			f.NumVars = n
+			header = true
+			continue
+		}
+
+		if !header {
+			return nil, fmt.Errorf("dimacs: line %d: clause before the problem line", line)
+		}
+		for _, field := range strings.Fields(text) {
+			lit, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("dimacs: line %d: bad literal: %s", line, field)
+			}
+			if lit == 0 {
+				f.Clauses = append(f.Clauses, clause)
+				clause = nil
+				continue
+			}
+			if lit > f.NumVars || -lit > f.NumVars {
+				return nil, fmt.Errorf("dimacs: line %d: variable %d exceeds %d", line, lit, f.NumVars)
+			}
+			clause = append(clause, lit)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return f, finish(f, header, clause)
+}
+
+// finish は読み込みの終わりを検査する関数。最後の節は 0 で終わらなくてもよい。
+func finish(f *CNF, header bool, clause []int) error {
+	if !header {
+		return fmt.Errorf("dimacs: missing problem line")
+	}
+	if len(clause) > 0 {
+		f.Clauses = append(f.Clauses, clause)
+	}
+	return nil
+}
+
+// Load は節の集合を Context の問題とする関数。
+// 変数 i を DSL の BoolArrayVar と同じ name[i-1] という名前の制約変数とし、
+// 節ごとに制約条件を追加する。制約変数の配列を返す。
+func (f *CNF) Load(c *smt.Context, name string) []*smt.Term {
+	vars := c.BoolArrayVar(name, f.NumVars)
+	for _, clause := range f.Clauses {
+		if len(clause) == 0 {
+			c.Assert(c.False())
+			continue
+		}
+		lits := make([]*smt.Term, len(clause))
+		for i, l := range clause {
+			if l > 0 {
+				lits[i] = vars[l-1]
+			} else {
+				lits[i] = vars[-l-1].Not()
+			}
+		}
+		c.Assert(lits[0].Or(lits[1:]...))
+	}
+	return vars
+}
+
+// WriteDIMACS は Bool の制約変数だけを使う問題を DIMACS CNF 形式で書き出す関数。
+// 制約条件は Tseitin 変換で節にする。制約変数と DIMACS の変数の対応はコメントに出力する。
+// DIMACS には複数の問題を続けて書けないので、書き出せるのは最初の Solve だけとする。
+func WriteDIMACS(w io.Writer, p *smt.Problem) error {
+	if p.Seq > 0 {
+		return fmt.Errorf("dimacs: only the first Solve can be exported")
+	}
+
+	f := &CNF{}
+	e := &encoder{lits: map[string]int{}}
+	for _, v := range p.Vars {
+		if v.Sort != smt.SortBool {
+			return fmt.Errorf("dimacs: %s: sort %s is not supported; only Bool variables can be exported", v.Name, v.Sort)
+		}
+		e.lits[v.Name] = f.NewVar()
+	}
+	e.c = newCircuit(f)
+	for _, a := range p.Asserts {
+		if err := e.assert(a); err != nil {
+			return err
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "c DIMACS CNF exported from the DSL")
+	fmt.Fprintln(bw, "c")
+	fmt.Fprintln(bw, "c variables:")
+	for i, v := range p.Vars {
+		fmt.Fprintf(bw, "c   %d %s\n", i+1, v.Name)
+	}
+	fmt.Fprintf(bw, "c   %d true\n", e.c.t)
+	switch {
+	case f.NumVars == e.c.t+1:
+		fmt.Fprintf(bw, "c   %d auxiliary (Tseitin)\n", f.NumVars)
+	case f.NumVars > e.c.t+1:
+		fmt.Fprintf(bw, "c   %d-%d auxiliary (Tseitin)\n", e.c.t+1, f.NumVars)
+	}
+	if len(p.Solve) > 0 {
+		fmt.Fprintf(bw, "c solve: %s\n", strings.Join(p.Solve, " "))
+	}
+	fmt.Fprintf(bw, "p cnf %d %d\n", f.NumVars, len(f.Clauses))
+	for _, clause := range f.Clauses {
+		for _, l := range clause {
+			fmt.Fprintf(bw, "%d ", l)
+		}
+		fmt.Fprintln(bw, "0")
+	}
+	return bw.Flush()
+}
+
+// encoder は Bool の制約条件を CNF の節に変換する構造体型
+type encoder struct {
+	c    *circuit
+	lits map[string]int // 制約変数のリテラル
+}
+
+// assert は制約条件を節として追加する関数。
+// 最上位の論理積は節に分け、論理和と含意はそのまま一つの節とする。
+func (e *encoder) assert(t *smt.Term) error {
+	switch t.Op {
+	case smt.OpAnd:
+		for _, arg := range t.Args {
+			if err := e.assert(arg); err != nil {
+				return err
+			}
+		}
+		return nil
+	case smt.OpOr:
+		var clause []int
+		for _, arg := range t.Args {
+			lit, err := e.lit(arg)
+			if err != nil {
+				return err
+			}
+			clause = append(clause, lit)
+		}
+		e.c.s.AddClause(clause...)
+		return nil
+	case smt.OpImplies:
+		a, err := e.lit(t.Args[0])
+		if err != nil {
+			return err
+		}
+		b, err := e.lit(t.Args[1])
+		if err != nil {
+			return err
+		}
+		e.c.s.AddClause(-a, b)
+		return nil
+	}
+	lit, err := e.lit(t)
+	if err != nil {
+		return err
+	}
+	e.c.s.AddClause(lit)
+	return nil
+}
+
+// lit は Bool の項をリテラルに変換する関数
+func (e *encoder) lit(t *smt.Term) (int, error) {
+	switch {
+	case t.Sort != smt.SortBool:
+		return 0, fmt.Errorf("dimacs: %s is not a Bool formula", t)
+	case t.Op == smt.OpVar:
+		return e.lits[t.Name], nil
+	case t.Op == smt.OpConst:
+		return e.c.constant(t.Bool), nil
+	}
+
+	args := make([]int, len(t.Args))
+	for i, arg := range t.Args {
+		if arg.Sort != smt.SortBool {
+			return 0, fmt.Errorf("dimacs: %s is not a Bool formula", t)
+		}
+		lit, err := e.lit(arg)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = lit
+	}
+	if lit, ok := e.c.gate(t.Op, args); ok {
+		return lit, nil
+	}
+	return 0, fmt.Errorf("dimacs: unsupported operator %s", t.Op)
+}
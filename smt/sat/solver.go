@@ -0,0 +1,450 @@
+package sat
+
+import "sync/atomic"
+
+// Solver は CDCL (Conflict-Driven Clause Learning) による SAT ソルバーを表す構造体型。
+// 変数は 1 から始まる整数で、リテラルは DIMACS と同じく正負の整数で表す
+// （3 は変数 3 が真、-3 は変数 3 が偽）。
+//
+// 監視リテラル（two watched literals）による単位伝播、
+// first UIP による節の学習と非時系列バックトラック、
+// VSIDS による変数選択、位相の保存、Luby 列による再始動を行う。
+type Solver struct {
+	clauses [][]int // 内部表現のリテラルの節
+	watches [][]int // 内部表現のリテラルごとの、そのリテラルを監視する節の添字
+
+	assigns  []int8 // 変数ごとの割り当て: 0 は未割り当て、1 は真、-1 は偽
+	level    []int  // 変数が割り当てられた決定レベル
+	reason   []int  // 変数の割り当ての理由となった節の添字。決定変数は -1
+	trail    []int  // 割り当てられた順の内部表現のリテラル
+	trailLim []int  // 決定レベルごとの trail の開始位置
+	qhead    int    // 単位伝播が済んだ trail の位置
+
+	activity []float64
+	varInc   float64
+	phase    []bool // 位相の保存: 最後に割り当てられた値
+	seen     []bool
+
+	model []bool // 直前の Solve で見つけた解
+	ok    bool   // 節の集合が矛盾していないか
+
+	stop        atomic.Bool // Interrupt で中断を求められたか
+	interrupted bool        // 直前の Solve が中断されたか
+
+	// 統計情報
+	Conflicts    int
+	Decisions    int
+	Propagations int
+	Restarts     int
+}
+
+// NewSolver は新しい SAT ソルバーを生成する関数
+func NewSolver() *Solver {
+	s := &Solver{varInc: 1, ok: true}
+	// 変数 0 は使わない
+	s.grow()
+	return s
+}
+
+// grow は変数を一つ追加する関数
+func (s *Solver) grow() {
+	s.assigns = append(s.assigns, 0)
+	s.level = append(s.level, 0)
+	s.reason = append(s.reason, -1)
+	s.activity = append(s.activity, 0)
+	s.phase = append(s.phase, false)
+	s.seen = append(s.seen, false)
+	s.watches = append(s.watches, nil, nil)
+}
+
+// NumVars は変数の数を返す関数
+func (s *Solver) NumVars() int {
+	return len(s.assigns) - 1
+}
+
+// NumClauses は学習した節を含む節の数を返す関数
+func (s *Solver) NumClauses() int {
+	return len(s.clauses)
+}
+
+// NewVar は新しい変数を作成する関数
+func (s *Solver) NewVar() int {
+	s.grow()
+	return s.NumVars()
+}
+
+// 内部表現のリテラル: 変数 v が真なら 2v、偽なら 2v+1
+func toLit(l int) int {
+	if l < 0 {
+		return -2*l + 1
+	}
+	return 2 * l
+}
+
+func litVar(p int) int {
+	return p >> 1
+}
+
+// value は内部表現のリテラルの値を返す関数: 0 は未割り当て、1 は真、-1 は偽
+func (s *Solver) value(p int) int8 {
+	v := s.assigns[litVar(p)]
+	if p&1 == 1 {
+		return -v
+	}
+	return v
+}
+
+func (s *Solver) decisionLevel() int {
+	return len(s.trailLim)
+}
+
+// AddClause は節（リテラルの論理和）を追加する関数。
+// 節の集合が矛盾することが分かった場合は false を返す。
+func (s *Solver) AddClause(lits ...int) bool {
+	if !s.ok {
+		return false
+	}
+	s.cancelUntil(0)
+
+	// 重複の除去、トートロジーと決定レベル0で偽のリテラルの処理
+	var c []int
+	seen := map[int]bool{}
+	for _, l := range lits {
+		p := toLit(l)
+		for litVar(p) > s.NumVars() {
+			s.grow()
+		}
+		switch {
+		case seen[p] || s.value(p) == -1:
+			continue
+		case seen[p^1] || s.value(p) == 1:
+			return true
+		}
+		seen[p] = true
+		c = append(c, p)
+	}
+
+	switch len(c) {
+	case 0:
+		s.ok = false
+	case 1:
+		s.enqueue(c[0], -1)
+		s.ok = s.propagate() < 0
+	default:
+		s.attach(c)
+	}
+	return s.ok
+}
+
+// attach は節を登録し、先頭の二つのリテラルを監視する関数
+func (s *Solver) attach(c []int) int {
+	ci := len(s.clauses)
+	s.clauses = append(s.clauses, c)
+	s.watches[c[0]] = append(s.watches[c[0]], ci)
+	s.watches[c[1]] = append(s.watches[c[1]], ci)
+	return ci
+}
+
+// enqueue は内部表現のリテラル p を真に割り当てる関数
+func (s *Solver) enqueue(p, from int) {
+	v := litVar(p)
+	if p&1 == 1 {
+		s.assigns[v] = -1
+	} else {
+		s.assigns[v] = 1
+	}
+	s.level[v] = s.decisionLevel()
+	s.reason[v] = from
+	s.trail = append(s.trail, p)
+}
+
+// propagate は単位伝播を行う関数。矛盾した場合はその節の添字を、しなければ -1 を返す。
+func (s *Solver) propagate() int {
+	for s.qhead < len(s.trail) {
+		p := s.trail[s.qhead]
+		s.qhead++
+		s.Propagations++
+
+		// p が真になったので ¬p を監視する節を調べる
+		falseLit := p ^ 1
+		ws := s.watches[falseLit]
+		i, j := 0, 0
+		for i < len(ws) {
+			ci := ws[i]
+			c := s.clauses[ci]
+			if c[0] == falseLit {
+				c[0], c[1] = c[1], c[0]
+			}
+			i++
+
+			// もう一方の監視リテラルが真なら節は充足されている
+			if s.value(c[0]) == 1 {
+				ws[j] = ci
+				j++
+				continue
+			}
+
+			// 偽でないリテラルを新しい監視リテラルにする
+			found := false
+			for k := 2; k < len(c); k++ {
+				if s.value(c[k]) != -1 {
+					c[1], c[k] = c[k], c[1]
+					s.watches[c[1]] = append(s.watches[c[1]], ci)
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			}
+
+			// 単位節または矛盾
+			ws[j] = ci
+			j++
+			if s.value(c[0]) == -1 {
+				for i < len(ws) {
+					ws[j] = ws[i]
+					i++
+					j++
+				}
+				s.watches[falseLit] = ws[:j]
+				s.qhead = len(s.trail)
+				return ci
+			}
+			s.enqueue(c[0], ci)
+		}
+		s.watches[falseLit] = ws[:j]
+	}
+	return -1
+}
+
+// analyze は矛盾した節から first UIP の節を学習し、バックトラックする決定レベルを返す関数
+func (s *Solver) analyze(confl int) ([]int, int) {
+	learnt := []int{-1}
+	pathC := 0
+	p := -1
+	idx := len(s.trail) - 1
+
+	for {
+		c := s.clauses[confl]
+		start := 0
+		if p != -1 {
+			// 理由の節の先頭は p 自身
+			start = 1
+		}
+		for _, q := range c[start:] {
+			v := litVar(q)
+			if s.seen[v] || s.level[v] == 0 {
+				continue
+			}
+			s.seen[v] = true
+			s.bump(v)
+			if s.level[v] >= s.decisionLevel() {
+				pathC++
+			} else {
+				learnt = append(learnt, q)
+			}
+		}
+
+		// 現在の決定レベルで最後に割り当てられた印のついたリテラル
+		for !s.seen[litVar(s.trail[idx])] {
+			idx--
+		}
+		p = s.trail[idx]
+		idx--
+		confl = s.reason[litVar(p)]
+		s.seen[litVar(p)] = false
+		pathC--
+		if pathC == 0 {
+			break
+		}
+	}
+	learnt[0] = p ^ 1
+
+	// バックトラックする決定レベルは2番目に大きい決定レベル
+	bt := 0
+	for i := 1; i < len(learnt); i++ {
+		s.seen[litVar(learnt[i])] = false
+		if lv := s.level[litVar(learnt[i])]; lv > bt {
+			bt = lv
+			learnt[1], learnt[i] = learnt[i], learnt[1]
+		}
+	}
+	return learnt, bt
+}
+
+// bump は変数の活性度を上げる関数
+func (s *Solver) bump(v int) {
+	s.activity[v] += s.varInc
+	if s.activity[v] > 1e100 {
+		for i := range s.activity {
+			s.activity[i] *= 1e-100
+		}
+		s.varInc *= 1e-100
+	}
+}
+
+// cancelUntil は決定レベル lv までの割り当てを取り消す関数
+func (s *Solver) cancelUntil(lv int) {
+	if s.decisionLevel() <= lv {
+		return
+	}
+	for i := len(s.trail) - 1; i >= s.trailLim[lv]; i-- {
+		v := litVar(s.trail[i])
+		s.phase[v] = s.assigns[v] == 1
+		s.assigns[v] = 0
+		s.reason[v] = -1
+	}
+	s.trail = s.trail[:s.trailLim[lv]]
+	s.trailLim = s.trailLim[:lv]
+	s.qhead = len(s.trail)
+}
+
+// pickBranch は活性度が最大の未割り当ての変数を選ぶ関数。
+// すべて割り当て済みの場合は 0 を返す。
+func (s *Solver) pickBranch() int {
+	best := 0
+	for v := 1; v < len(s.assigns); v++ {
+		if s.assigns[v] == 0 && (best == 0 || s.activity[v] > s.activity[best]) {
+			best = v
+		}
+	}
+	return best
+}
+
+// luby は Luby 列の i 番目（0 から）の値を返す関数: 1 1 2 1 1 2 4 1 1 2 ...
+func luby(i int) int {
+	size, seq := 1, 0
+	for size < i+1 {
+		seq++
+		size = 2*size + 1
+	}
+	for size-1 != i {
+		size = (size - 1) >> 1
+		seq--
+		i = i % size
+	}
+	return 1 << uint(seq)
+}
+
+// restartBase は再始動までの衝突回数の単位
+const restartBase = 100
+
+// Solve は節の集合を充足する割り当てを探す関数。充足可能なら true を返す。
+// 充足可能な場合の割り当ては Value で取得する。
+// assumptions のリテラルは、この Solve の間だけ真と仮定する（最初の決定として割り当てる）。
+// 仮定と矛盾して false を返した場合も、節の集合は次の Solve で使える。
+func (s *Solver) Solve(assumptions ...int) bool {
+	s.model = nil
+	s.interrupted = false
+	if !s.ok {
+		return false
+	}
+	s.cancelUntil(0)
+	if s.propagate() >= 0 {
+		s.ok = false
+		return false
+	}
+
+	restarts := 0
+	limit := restartBase * luby(restarts)
+	conflicts := 0
+	for {
+		if s.stop.Swap(false) {
+			s.cancelUntil(0)
+			s.interrupted = true
+			return false
+		}
+		confl := s.propagate()
+		if confl >= 0 {
+			// 矛盾から節を学習してバックトラックする
+			s.Conflicts++
+			conflicts++
+			if s.decisionLevel() == 0 {
+				s.ok = false
+				return false
+			}
+			learnt, bt := s.analyze(confl)
+			s.cancelUntil(bt)
+			if len(learnt) == 1 {
+				s.enqueue(learnt[0], -1)
+			} else {
+				s.enqueue(learnt[0], s.attach(learnt))
+			}
+			s.varInc /= 0.95
+			continue
+		}
+
+		if conflicts >= limit {
+			// 再始動
+			s.Restarts++
+			restarts++
+			conflicts = 0
+			limit = restartBase * luby(restarts)
+			s.cancelUntil(0)
+			continue
+		}
+
+		if lv := s.decisionLevel(); lv < len(assumptions) {
+			// 仮定のリテラルを順に決定する
+			p := toLit(assumptions[lv])
+			for litVar(p) > s.NumVars() {
+				s.grow()
+			}
+			switch s.value(p) {
+			case -1:
+				// 仮定が節の集合と矛盾する
+				s.cancelUntil(0)
+				return false
+			case 1:
+				// 既に真なので空の決定レベルとする
+				s.trailLim = append(s.trailLim, len(s.trail))
+			default:
+				s.trailLim = append(s.trailLim, len(s.trail))
+				s.enqueue(p, -1)
+			}
+			continue
+		}
+
+		v := s.pickBranch()
+		if v == 0 {
+			// すべての変数が矛盾なく割り当てられた
+			s.model = make([]bool, len(s.assigns))
+			for i := range s.assigns {
+				s.model[i] = s.assigns[i] == 1
+			}
+			s.cancelUntil(0)
+			return true
+		}
+		s.Decisions++
+		s.trailLim = append(s.trailLim, len(s.trail))
+		p := toLit(v)
+		if !s.phase[v] {
+			p ^= 1
+		}
+		s.enqueue(p, -1)
+	}
+}
+
+// Interrupt は実行中の Solve を中断する関数。別のゴルーチンから呼び出してよい。
+// 中断された Solve は false を返し、Interrupted が true を返す。
+func (s *Solver) Interrupt() {
+	s.stop.Store(true)
+}
+
+// Interrupted は直前の Solve が Interrupt で中断されたかどうかを返す関数
+func (s *Solver) Interrupted() bool {
+	return s.interrupted
+}
+
+// Value は直前の Solve で見つけた割り当てでのリテラルの値を返す関数
+func (s *Solver) Value(l int) bool {
+	v := l
+	if v < 0 {
+		v = -v
+	}
+	if v >= len(s.model) {
+		return false
+	}
+	return s.model[v] == (l > 0)
+}
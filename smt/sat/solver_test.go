@@ -0,0 +1,249 @@
+package sat
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		clauses [][]int
+		want    bool
+	}{
+		{"empty", nil, true},
+		{"unit", [][]int{{1}, {-1, 2}}, true},
+		{"contradiction", [][]int{{1}, {-1}}, false},
+		{"tautology", [][]int{{1, -1}}, true},
+		{"duplicate literals", [][]int{{1, 1, -2}, {2, 2}}, true},
+		{"all combinations", [][]int{{1, 2}, {1, -2}, {-1, 2}, {-1, -2}}, false},
+	}
+	for _, tt := range tests {
+		s := NewSolver()
+		for _, c := range tt.clauses {
+			s.AddClause(c...)
+		}
+		if got := s.Solve(); got != tt.want {
+			t.Errorf("%s: Solve() = %v; want %v", tt.name, got, tt.want)
+			continue
+		}
+		if tt.want && !satisfies(s, tt.clauses) {
+			t.Errorf("%s: the assignment does not satisfy the clauses", tt.name)
+		}
+	}
+}
+
+// pigeonhole は n+1 羽の鳩を n 個の巣に入れる（充足不能な）節の集合を返す関数。
+// 変数 i*n+j+1 は鳩 i が巣 j に入ることを表す。
+func pigeonhole(n int) [][]int {
+	var clauses [][]int
+	for i := 0; i <= n; i++ {
+		var c []int
+		for j := 0; j < n; j++ {
+			c = append(c, i*n+j+1)
+		}
+		clauses = append(clauses, c)
+	}
+	for j := 0; j < n; j++ {
+		for i := 0; i <= n; i++ {
+			for k := i + 1; k <= n; k++ {
+				clauses = append(clauses, []int{-(i*n + j + 1), -(k*n + j + 1)})
+			}
+		}
+	}
+	return clauses
+}
+
+func TestLearning(t *testing.T) {
+	// 鳩の巣原理は単位伝播だけでは矛盾が分からないので、衝突からの節の学習が必要になる
+	s := NewSolver()
+	clauses := pigeonhole(5)
+	for _, c := range clauses {
+		s.AddClause(c...)
+	}
+	n := s.NumClauses()
+	if s.Solve() {
+		t.Fatalf("Solve() = true for the pigeonhole problem")
+	}
+	if s.Conflicts == 0 || s.Decisions == 0 {
+		t.Errorf("conflicts = %d, decisions = %d; want both positive", s.Conflicts, s.Decisions)
+	}
+	if s.NumClauses() <= n {
+		t.Errorf("NumClauses() = %d after Solve; want learnt clauses added to %d", s.NumClauses(), n)
+	}
+	// 一度充足不能と分かった節の集合は、節を追加しても充足不能のまま
+	if s.AddClause(1) || s.Solve() {
+		t.Errorf("the solver is satisfiable again after adding a clause")
+	}
+}
+
+func TestLuby(t *testing.T) {
+	want := []int{1, 1, 2, 1, 1, 2, 4, 1, 1, 2, 1, 1, 2, 4, 8, 1}
+	for i, w := range want {
+		if got := luby(i); got != w {
+			t.Errorf("luby(%d) = %d; want %d", i, got, w)
+		}
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	// 解を禁止する節を追加しながらすべての解を列挙し、その数を全探索の数と比べる。
+	// 前の Solve で学習した節は、節を追加した後も正しくなければならない。
+	const n = 8
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 50; i++ {
+		clauses := random3SAT(r, n, 20)
+		s := NewSolver()
+		for _, c := range clauses {
+			s.AddClause(c...)
+		}
+		found := 0
+		for s.Solve() {
+			if !satisfies(s, clauses) {
+				t.Fatalf("the assignment does not satisfy %v", clauses)
+			}
+			found++
+			block := make([]int, n)
+			for v := 1; v <= n; v++ {
+				block[v-1] = v
+				if s.Value(v) {
+					block[v-1] = -v
+				}
+			}
+			s.AddClause(block...)
+		}
+		if want := countModels(n, clauses); found != want {
+			t.Fatalf("found %d solutions; want %d for %v", found, want, clauses)
+		}
+	}
+}
+
+func TestSolveRandom(t *testing.T) {
+	// 乱数で生成した 3-SAT の問題の結果を、すべての割り当てを調べた結果と比べる
+	const n = 10
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		clauses := random3SAT(r, n, 30+r.Intn(30))
+		s := NewSolver()
+		for _, c := range clauses {
+			s.AddClause(c...)
+		}
+		want := countModels(n, clauses) > 0
+		got := s.Solve()
+		if got != want {
+			t.Fatalf("Solve() = %v; want %v for %v", got, want, clauses)
+		}
+		if got && !satisfies(s, clauses) {
+			t.Fatalf("the assignment does not satisfy %v", clauses)
+		}
+	}
+}
+
+// random3SAT は変数 1 から n の m 個の節からなる 3-SAT の問題を乱数で生成する関数
+func random3SAT(r *rand.Rand, n, m int) [][]int {
+	clauses := make([][]int, m)
+	for j := range clauses {
+		clauses[j] = make([]int, 3)
+		for k := range clauses[j] {
+			clauses[j][k] = randomLit(r, n)
+		}
+	}
+	return clauses
+}
+
+// randomLit は変数 1 から n のリテラルを乱数で選ぶ関数
+func randomLit(r *rand.Rand, n int) int {
+	l := r.Intn(n) + 1
+	if r.Intn(2) == 0 {
+		return -l
+	}
+	return l
+}
+
+// countModels は変数 1 から n のすべての割り当てを調べて、節の集合を充足する割り当ての数を求める関数
+func countModels(n int, clauses [][]int) int {
+	count := 0
+	for m := 0; m < 1<<n; m++ {
+		ok := true
+		for _, c := range clauses {
+			sat := false
+			for _, l := range c {
+				v := l
+				if v < 0 {
+					v = -v
+				}
+				if (m>>(v-1)&1 == 1) == (l > 0) {
+					sat = true
+					break
+				}
+			}
+			if !sat {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			count++
+		}
+	}
+	return count
+}
+
+// satisfies は直前の Solve で見つけた割り当てが節の集合を充足するかどうかを調べる関数
+func satisfies(s *Solver, clauses [][]int) bool {
+	for _, c := range clauses {
+		sat := false
+		for _, l := range c {
+			sat = sat || s.Value(l)
+		}
+		if !sat {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSolveAssumptions(t *testing.T) {
+	// x1 => x2, x2 => x3
+	s := NewSolver()
+	s.AddClause(-1, 2)
+	s.AddClause(-2, 3)
+	if s.Solve(1, -3) {
+		t.Errorf("Solve(1, -3) = true; want false")
+	}
+	if !s.Solve(1) || !s.Value(2) || !s.Value(3) {
+		t.Errorf("Solve(1) does not assign true to 2 and 3")
+	}
+	// 仮定と矛盾しても節の集合は使える
+	if !s.Solve(-3) || s.Value(1) {
+		t.Errorf("Solve(-3) does not assign false to 1")
+	}
+	if !s.Solve() {
+		t.Errorf("Solve() = false after assumptions; want true")
+	}
+}
+
+func TestSolveRandomAssumptions(t *testing.T) {
+	// 一つのソルバーで仮定を変えながら解決した結果を、仮定を単位節とした全探索の結果と比べる
+	const n = 10
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 100; i++ {
+		clauses := random3SAT(r, n, 30+r.Intn(20))
+		s := NewSolver()
+		for _, c := range clauses {
+			s.AddClause(c...)
+		}
+		for j := 0; j < 5; j++ {
+			assumptions := []int{randomLit(r, n), randomLit(r, n)}
+			all := append([][]int{{assumptions[0]}, {assumptions[1]}}, clauses...)
+			want := countModels(n, all) > 0
+			got := s.Solve(assumptions...)
+			if got != want {
+				t.Fatalf("Solve(%v) = %v; want %v for %v", assumptions, got, want, clauses)
+			}
+			if got && !satisfies(s, all) {
+				t.Fatalf("the assignment does not satisfy %v under %v", clauses, assumptions)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package smt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func init() {
+	RegisterExporter("smt2", WriteSMTLIB)
+}
+
+// WriteSMTLIB は問題を SMT-LIB2 のスクリプトとして書き出す関数。
+// 制約変数の宣言、制約条件、(check-sat) と Solve の変数の (get-value ...) を出力する。
+// 2番目以降の Solve では (reset) で始めて、それだけで完結するスクリプトとする。
+// 目的関数は Z3 の拡張の (minimize ...) または (maximize ...) で出力する。
+// SetOption と UseLogic は (set-option ...) と (set-logic ...)、
+// UseTactic は Z3 の拡張の (check-sat-using ...) で出力する。
+func WriteSMTLIB(w io.Writer, p *Problem) error {
+	bw := bufio.NewWriter(w)
+	if p.Seq > 0 {
+		fmt.Fprintln(bw, "(reset)")
+	}
+	fmt.Fprintln(bw, "(set-option :produce-models true)")
+	for _, o := range p.Options {
+		fmt.Fprintln(bw, OptionCommand(o))
+	}
+	if p.Logic != "" {
+		fmt.Fprintf(bw, "(set-logic %s)\n", p.Logic)
+	}
+	for _, v := range p.Vars {
+		fmt.Fprintf(bw, "(declare-fun %s () %s)\n", Symbol(v.Name), smtSort(v.Sort))
+	}
+	for _, a := range p.Asserts {
+		fmt.Fprintf(bw, "(assert %s)\n", a)
+	}
+	if o := p.Objective; o != nil {
+		fmt.Fprintf(bw, "(%simize %s)\n", o.Sense, o.Term)
+	}
+	fmt.Fprintln(bw, CheckSatCommand(p.Tactics))
+	if len(p.Solve) > 0 {
+		var syms []string
+		for _, name := range p.Solve {
+			syms = append(syms, Symbol(name))
+		}
+		fmt.Fprintf(bw, "(get-value (%s))\n", strings.Join(syms, " "))
+	}
+	return bw.Flush()
+}
+
+// OptionCommand はソルバーのオプションを設定する (set-option :name value) を返す関数
+func OptionCommand(o Option) string {
+	return fmt.Sprintf("(set-option :%s %s)", strings.TrimPrefix(o.Name, ":"), o.Value)
+}
+
+// CheckSatCommand は (check-sat) を返す関数。tactics を指定した場合は、
+// タクティクを順に適用する (check-sat-using (then t1 t2 ...)) を返す。
+func CheckSatCommand(tactics []string) string {
+	switch len(tactics) {
+	case 0:
+		return "(check-sat)"
+	case 1:
+		return fmt.Sprintf("(check-sat-using %s)", tactics[0])
+	}
+	return fmt.Sprintf("(check-sat-using (then %s))", strings.Join(tactics, " "))
+}
+
+// smtSort は制約変数のソートを SMT-LIB2 のソート名に変換する関数
+func smtSort(sort string) string {
+	if sort == SortNum {
+		return "Real"
+	}
+	return sort
+}
@@ -0,0 +1,506 @@
+// Package smtlib は SMT-LIB2 を扱う smt パッケージの補助パッケージ。
+// 標準入出力で SMT-LIB2 を話すソルバーの実行ファイル（z3 -in など）を
+// サブプロセスとして起動するバックエンドを "smtlib" という名前で登録する。
+package smtlib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+// Command はバックエンドが起動するソルバーのコマンドライン
+var Command = "z3 -in"
+
+func init() {
+	smt.RegisterBackend("smtlib", func() (smt.Backend, error) {
+		return New(Command)
+	})
+}
+
+// Backend はソルバーのサブプロセスと宣言された制約変数を保持する構造体型
+type Backend struct {
+	args   []string // ソルバーのコマンドライン
+	z3     bool     // ソルバーが z3 で、^ などの拡張を使える
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *Reader
+	stderr lockedBuffer
+
+	// killed は Interrupt でソルバーのプロセスを終了させたことを示す。
+	// mu は Interrupt から cmd と killed を保護する
+	mu     sync.Mutex
+	killed bool
+
+	// 送った宣言や制約条件などのコマンド。ソルバーを起動し直すときに送り直す
+	script []string
+
+	names   []string
+	sorts   map[string]string
+	timeout time.Duration // ソルバーに設定した時間制限
+	tactics []string      // (check-sat-using ...) で適用するタクティク
+	proxies int           // CheckAssuming で宣言した仮定のための制約変数の数
+}
+
+// lockedBuffer はソルバーの標準エラー出力を蓄積するバッファ。
+// 書き込みは exec パッケージのゴルーチンが行うので、読み書きを排他する。
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write はバッファに書き込む関数
+func (lb *lockedBuffer) Write(p []byte) (int, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.buf.Write(p)
+}
+
+// String はバッファの内容を返す関数
+func (lb *lockedBuffer) String() string {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.buf.String()
+}
+
+// Reset はバッファを空にする関数
+func (lb *lockedBuffer) Reset() {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.buf.Reset()
+}
+
+// New はコマンドライン command のソルバーを起動するバックエンドを生成する関数
+func New(command string) (*Backend, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("smtlib: empty solver command")
+	}
+
+	name := strings.TrimSuffix(filepath.Base(args[0]), ".exe")
+	b := &Backend{args: args, z3: name == "z3", sorts: map[string]string{}}
+	if err := b.start(); err != nil {
+		if b.cmd != nil {
+			// 起動したが応答が正しくないソルバーは終了させる
+			b.cmd.Process.Kill()
+			b.cmd.Wait()
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// start はソルバーを起動し、:print-success と :produce-models を設定して、
+// それまでに送った宣言や制約条件などのコマンドを送り直す関数
+func (b *Backend) start() error {
+	cmd := exec.Command(b.args[0], b.args[1:]...)
+	b.stderr.Reset()
+	cmd.Stderr = &b.stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.cmd, b.killed = cmd, false
+	b.mu.Unlock()
+	b.stdin, b.stdout = stdin, NewReader(stdout)
+
+	// :print-success を最初に設定し、以後のコマンドはすべて応答を確かめる
+	for _, c := range append([]string{"(set-option :print-success true)", "(set-option :produce-models true)"}, b.script...) {
+		if err := b.exec(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restart は Interrupt で終了させたソルバーを起動し直す関数
+func (b *Backend) restart() error {
+	b.mu.Lock()
+	killed := b.killed
+	b.mu.Unlock()
+	if !killed {
+		return nil
+	}
+	b.stdin.Close()
+	b.cmd.Wait()
+	return b.start()
+}
+
+// command は宣言や制約条件などの応答のないコマンドを送り、ソルバーを起動し直すときのために記録する関数
+func (b *Backend) command(cmd string) error {
+	if err := b.restart(); err != nil {
+		return err
+	}
+	if err := b.exec(cmd); err != nil {
+		return err
+	}
+	b.script = append(b.script, cmd)
+	return nil
+}
+
+// exec は応答のないコマンドを送り、:print-success による success の応答を確かめる関数
+func (b *Backend) exec(cmd string) error {
+	if err := b.send(cmd); err != nil {
+		return err
+	}
+	e, err := b.receive()
+	if err != nil {
+		return err
+	}
+	if e.Atom != "success" {
+		return fmt.Errorf("smtlib: unexpected reply to %s: %s", cmd, e)
+	}
+	return nil
+}
+
+// query は (check-sat) などの問い合わせのコマンドを送り、その応答を返す関数
+func (b *Backend) query(cmd string) (*Sexp, error) {
+	if err := b.restart(); err != nil {
+		return nil, err
+	}
+	if err := b.send(cmd); err != nil {
+		return nil, err
+	}
+	return b.receive()
+}
+
+// send はソルバーにコマンドを送る関数
+func (b *Backend) send(cmd string) error {
+	if _, err := io.WriteString(b.stdin, cmd+"\n"); err != nil {
+		return b.failed(err)
+	}
+	return nil
+}
+
+// receive はソルバーの応答を一つ読み込む関数。(error "...") はエラーとする。
+func (b *Backend) receive() (*Sexp, error) {
+	e, err := b.stdout.Read()
+	if err != nil {
+		return nil, b.failed(err)
+	}
+	if e.Head() == "error" {
+		return nil, fmt.Errorf("smtlib: %s", e)
+	}
+	return e, nil
+}
+
+// failed はソルバーとの通信のエラーに標準エラー出力の内容を添える関数
+func (b *Backend) failed(err error) error {
+	if msg := strings.TrimSpace(b.stderr.String()); msg != "" {
+		return fmt.Errorf("smtlib: %v: %s", err, msg)
+	}
+	return fmt.Errorf("smtlib: %v", err)
+}
+
+// sortName は制約変数のソートを SMT-LIB2 のソート名に変換する関数
+func sortName(sort string) string {
+	if sort == smt.SortNum {
+		return "Real"
+	}
+	return sort
+}
+
+// DeclareVar は制約変数を宣言する関数
+func (b *Backend) DeclareVar(name, sort string) error {
+	b.names = append(b.names, name)
+	b.sorts[name] = sort
+	return b.command(fmt.Sprintf("(declare-fun %s () %s)", smt.Symbol(name), sortName(sort)))
+}
+
+// Assert は制約条件を追加する関数
+func (b *Backend) Assert(cond *smt.Term) error {
+	t, err := b.term(cond)
+	if err != nil {
+		return err
+	}
+	return b.command(fmt.Sprintf("(assert %s)", t))
+}
+
+// maxExpand は乗算に展開するべき乗の指数の上限
+const maxExpand = 64
+
+// term は項を SMT-LIB2 で送れるように書き換える関数。
+// べき乗 ^ は z3 の拡張なので、指数が 0 以上 maxExpand 以下の定数のべき乗は乗算に展開し、
+// それ以外のべき乗はソルバーが z3 でなければエラーとする。
+func (b *Backend) term(t *smt.Term) (*smt.Term, error) {
+	if len(t.Args) == 0 {
+		return t, nil
+	}
+	args := make([]*smt.Term, len(t.Args))
+	for i, arg := range t.Args {
+		a, err := b.term(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = a
+	}
+	u := *t
+	u.Args = args
+	if t.Op != smt.OpPow {
+		return &u, nil
+	}
+	e, ok := exponent(args[1])
+	switch {
+	case ok && e == 0:
+		if t.Sort == smt.SortInt {
+			return smt.IntConst(big.NewInt(1)), nil
+		}
+		return smt.NumConst(big.NewRat(1, 1)), nil
+	case ok && e == 1:
+		return args[0], nil
+	case ok:
+		factors := make([]*smt.Term, e-1)
+		for i := range factors {
+			factors[i] = args[0]
+		}
+		return args[0].Mul(factors...), nil
+	case b.z3:
+		return &u, nil
+	}
+	return nil, fmt.Errorf("smtlib: %s is supported only by z3 (^ with a constant exponent from 0 to %d is expanded)", t, maxExpand)
+}
+
+// exponent は項が 0 以上 maxExpand 以下の整数の定数であればその値を返す関数
+func exponent(t *smt.Term) (int64, bool) {
+	if t.Op == smt.OpToReal {
+		t = t.Args[0]
+	}
+	if t.Op != smt.OpConst || !t.Num.IsInt() || t.Num.Sign() < 0 || t.Num.Num().Cmp(big.NewInt(maxExpand)) > 0 {
+		return 0, false
+	}
+	return t.Num.Num().Int64(), true
+}
+
+// Optimize は目的関数を設定する関数。
+// ソルバーが (minimize ...) と (maximize ...) をサポートしている必要がある（z3 など）。
+func (b *Backend) Optimize(obj *smt.Objective) error {
+	t, err := b.term(obj.Term)
+	if err != nil {
+		return err
+	}
+	return b.command(fmt.Sprintf("(%simize %s)", obj.Sense, t))
+}
+
+// SetOption はソルバーのオプションを (set-option :name value) で設定する関数
+func (b *Backend) SetOption(name, value string) error {
+	return b.command(smt.OptionCommand(smt.Option{Name: name, Value: value}))
+}
+
+// UseTactic は Check で (check-sat-using ...) によりタクティクを適用するように設定する関数。
+// (check-sat-using ...) は z3 の拡張である。
+func (b *Backend) UseTactic(names ...string) error {
+	b.tactics = append([]string{}, names...)
+	return nil
+}
+
+// UseLogic はロジックを (set-logic ...) で設定する関数。制約変数を宣言する前に呼び出すこと。
+func (b *Backend) UseLogic(logic string) error {
+	if len(b.names) > 0 {
+		return errors.New("smtlib: the logic must be set before declaring variables")
+	}
+	return b.command(fmt.Sprintf("(set-logic %s)", logic))
+}
+
+// Check は制約が解決可能かどうかを調べる関数
+func (b *Backend) Check() (smt.Status, error) {
+	return b.checkSat(smt.CheckSatCommand(b.tactics))
+}
+
+// CheckAssuming は lits の制約条件を一時的に仮定して、(check-sat-assuming ...) で
+// 制約が解決可能かどうかを調べる関数。SMT-LIB2 では仮定はブール型の定数かその否定に限られるので、
+// それ以外の仮定は新しいブール型の定数 p と制約条件 (=> p lit) に置き換えて p を仮定する。
+// UseTactic のタクティクは適用しない。
+func (b *Backend) CheckAssuming(lits []*smt.Term) (smt.Status, error) {
+	var assumptions []string
+	for _, t := range lits {
+		if t.Op == smt.OpVar || t.Op == smt.OpNot && t.Args[0].Op == smt.OpVar {
+			assumptions = append(assumptions, t.String())
+			continue
+		}
+		t, err := b.term(t)
+		if err != nil {
+			return smt.StatusUnknown, err
+		}
+		b.proxies++
+		p := smt.Symbol(fmt.Sprintf("assume!%d", b.proxies))
+		if err := b.command(fmt.Sprintf("(declare-fun %s () Bool)", p)); err != nil {
+			return smt.StatusUnknown, err
+		}
+		if err := b.command(fmt.Sprintf("(assert (=> %s %s))", p, t)); err != nil {
+			return smt.StatusUnknown, err
+		}
+		assumptions = append(assumptions, p)
+	}
+	return b.checkSat(fmt.Sprintf("(check-sat-assuming (%s))", strings.Join(assumptions, " ")))
+}
+
+// checkSat は cmd（check-sat など）を送り、応答を判定の結果に変換する関数。
+// Interrupt で中断した場合は StatusUnknown を返す。
+func (b *Backend) checkSat(cmd string) (smt.Status, error) {
+	e, err := b.query(cmd)
+	if err != nil {
+		b.mu.Lock()
+		killed := b.killed
+		b.mu.Unlock()
+		if killed {
+			return smt.StatusUnknown, nil
+		}
+		return smt.StatusUnknown, err
+	}
+	switch e.Atom {
+	case "sat":
+		return smt.StatusSat, nil
+	case "unsat":
+		return smt.StatusUnsat, nil
+	case "unknown":
+		return smt.StatusUnknown, nil
+	}
+	return smt.StatusUnknown, fmt.Errorf("smtlib: unexpected reply to check-sat: %s", e)
+}
+
+// SetTimeout は Check の時間制限を (set-option :timeout ミリ秒) で設定する関数。
+// :timeout は z3 のオプションなので、時間制限を使わない限り送らない。
+func (b *Backend) SetTimeout(d time.Duration) error {
+	if d == b.timeout {
+		return nil
+	}
+	b.timeout = d
+	ms := d.Milliseconds()
+	if d == 0 {
+		ms = 4294967295 // z3 の既定値: 時間制限なし
+	}
+	return b.command(fmt.Sprintf("(set-option :timeout %d)", ms))
+}
+
+// ReasonUnknown は直前の Check が判定できなかった理由を (get-info :reason-unknown) で取得する関数。
+// 取得できない場合は空文字列を返す。
+func (b *Backend) ReasonUnknown() string {
+	// 応答は (:reason-unknown "timeout") または (:reason-unknown incomplete)
+	e, err := b.query("(get-info :reason-unknown)")
+	if err != nil || len(e.List) != 2 || e.Head() != ":reason-unknown" {
+		return ""
+	}
+	return strings.Trim(e.List[1].Atom, `"`)
+}
+
+// Model は (get-model) の応答から宣言されたすべての制約変数の値を返す関数。
+// モデルに現れない変数は既定値（0、0.0、false）とする。
+func (b *Backend) Model() (map[string]smt.Value, error) {
+	e, err := b.query("(get-model)")
+	if err != nil {
+		return nil, err
+	}
+
+	// 応答は (model (define-fun x () Int 13) ...) または ((define-fun x () Int 13) ...)
+	values := map[string]smt.Value{}
+	for _, def := range e.List {
+		if def.Head() != "define-fun" || len(def.List) != 5 || len(def.List[2].List) != 0 {
+			continue
+		}
+		name := def.List[1].Atom
+		sort, ok := b.sorts[name]
+		if !ok {
+			continue
+		}
+		values[name] = ParseValue(sort, def.List[4])
+	}
+	for _, name := range b.names {
+		if _, ok := values[name]; !ok {
+			values[name] = zeroValue(b.sorts[name])
+		}
+	}
+	return values, nil
+}
+
+// zeroValue はソートの既定値を返す関数
+func zeroValue(sort string) smt.Value {
+	switch sort {
+	case smt.SortInt:
+		return smt.NewIntValue(new(big.Int))
+	case smt.SortNum:
+		return smt.NewNumValue(new(big.Rat))
+	}
+	return smt.NewBoolValue(false)
+}
+
+// ParseValue は SMT-LIB2 の値の S 式を smt.Value に変換する関数。
+// 有理数で表せない値（root-obj など）は Text だけを設定する。
+func ParseValue(sort string, e *Sexp) smt.Value {
+	if sort == smt.SortBool {
+		return smt.NewBoolValue(e.Atom == "true")
+	}
+	r, ok := parseRat(e)
+	switch {
+	case !ok:
+		return smt.Value{Sort: sort, Text: e.String()}
+	case sort == smt.SortInt && r.IsInt():
+		return smt.NewIntValue(r.Num())
+	}
+	return smt.NewNumValue(r)
+}
+
+// parseRat は 13、1.5、(- 3)、(/ 1.0 3.0) のような数値の S 式を有理数に変換する関数
+func parseRat(e *Sexp) (*big.Rat, bool) {
+	if !e.IsList() {
+		return new(big.Rat).SetString(e.Atom)
+	}
+	args := make([]*big.Rat, len(e.List)-1)
+	for i, x := range e.List[1:] {
+		r, ok := parseRat(x)
+		if !ok {
+			return nil, false
+		}
+		args[i] = r
+	}
+	switch {
+	case e.Head() == "-" && len(args) == 1:
+		return args[0].Neg(args[0]), true
+	case e.Head() == "/" && len(args) == 2 && args[1].Sign() != 0:
+		return args[0].Quo(args[0], args[1]), true
+	}
+	return nil, false
+}
+
+// Interrupt は実行中の Check を中断する関数。別のゴルーチンから呼び出してよい。
+// SMT-LIB2 には実行中のコマンドを中断する方法がないので、ソルバーのプロセスを終了させる。
+// 次にコマンドを送るときにソルバーを起動し直し、それまでの宣言と制約条件を送り直す。
+func (b *Backend) Interrupt() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.killed && b.cmd.Process.Kill() == nil {
+		b.killed = true
+	}
+}
+
+// Close はソルバーを終了させる関数
+func (b *Backend) Close() error {
+	b.mu.Lock()
+	killed := b.killed
+	b.mu.Unlock()
+	if killed {
+		// Interrupt で終了させたプロセスの終了状態は問わない
+		b.stdin.Close()
+		b.cmd.Wait()
+		return nil
+	}
+	b.send("(exit)")
+	b.stdin.Close()
+	return b.cmd.Wait()
+}
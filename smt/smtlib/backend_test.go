@@ -0,0 +1,163 @@
+package smtlib
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+// 環境変数 SMTLIB_FAKE_LOG が設定されている場合、テストの実行ファイルは偽のソルバーとして動作し、
+// 受け取ったコマンドをそのファイルに記録する
+func TestMain(m *testing.M) {
+	if log := os.Getenv("SMTLIB_FAKE_LOG"); log != "" {
+		fakeSolver(log)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeSolver は :print-success に従って応答する偽のソルバー。
+// 値が unsupported のオプションには unsupported と応答し、hang を含む check-sat-assuming には応答しない。
+func fakeSolver(log string) {
+	f, err := os.OpenFile(log, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		os.Exit(1)
+	}
+	defer f.Close()
+	rd := NewReader(os.Stdin)
+	for {
+		e, err := rd.Read()
+		if err != nil {
+			return
+		}
+		fmt.Fprintln(f, e)
+		switch e.Head() {
+		case "exit":
+			return
+		case "check-sat", "check-sat-assuming":
+			if strings.Contains(e.String(), "hang") {
+				time.Sleep(time.Hour)
+			}
+			fmt.Println("sat")
+		case "get-model":
+			fmt.Println("()")
+		case "set-option":
+			if e.List[len(e.List)-1].Atom == "unsupported" {
+				fmt.Println("unsupported")
+				continue
+			}
+			fmt.Println("success")
+		default:
+			fmt.Println("success")
+		}
+	}
+}
+
+// newFake は偽のソルバーを起動するバックエンドと、コマンドを記録するファイルの名前を返す関数
+func newFake(t *testing.T) (*Backend, string) {
+	log := t.TempDir() + "/log"
+	t.Setenv("SMTLIB_FAKE_LOG", log)
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, log
+}
+
+// commands は偽のソルバーが受け取ったコマンドを返す関数
+func commands(t *testing.T, log string) []string {
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestReplies(t *testing.T) {
+	b, _ := newFake(t)
+	defer b.Close()
+	if err := b.SetOption("smt.random_seed", "7"); err != nil {
+		t.Errorf("SetOption: %v", err)
+	}
+	err := b.SetOption("produce-proofs", "unsupported")
+	if err == nil || !strings.Contains(err.Error(), "unexpected reply to (set-option :produce-proofs unsupported): unsupported") {
+		t.Errorf("SetOption with an unsupported reply: error = %v", err)
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	b, log := newFake(t)
+	c := smt.NewContext(b)
+	defer c.Close()
+	x, hang := c.IntVar("x"), c.BoolVar("hang")
+	c.Assert(x.Gt(c.IntVal(0)))
+	c.SetTimeout(100)
+	if st, err := c.CheckAssuming(hang); st != smt.StatusUnknown || err != nil || c.ReasonUnknown() != "timeout" {
+		t.Fatalf("CheckAssuming(hang) = %s, %v (%s); want unknown (timeout)", st, err, c.ReasonUnknown())
+	}
+	// 中断で終了させたソルバーを起動し直し、宣言と制約条件を送り直す
+	if st, err := c.Check(); st != smt.StatusSat || err != nil {
+		t.Fatalf("Check() after the interrupt = %s, %v; want sat", st, err)
+	}
+	n := 0
+	for _, cmd := range commands(t, log) {
+		if cmd == "(assert (> x 0))" {
+			n++
+		}
+	}
+	if n != 2 {
+		t.Errorf("the assertion was sent %d times; want 2 (replayed after the interrupt)", n)
+	}
+}
+
+func TestPow(t *testing.T) {
+	b, log := newFake(t)
+	c := smt.NewContext(b)
+	defer c.Close()
+	x, y := c.IntVar("x"), c.IntVar("y")
+	tests := []struct {
+		cond *smt.Term
+		want string // 送る制約条件。空文字列はエラー
+	}{
+		{x.Pow(intConst(3)).Eq(intConst(8)), "(assert (= (* x x x) 8))"},
+		{x.Pow(intConst(1)).Eq(intConst(2)), "(assert (= x 2))"},
+		{x.Pow(intConst(0)).Eq(intConst(1)), "(assert (= 1 1))"},
+		{x.Add(x.Pow(intConst(2))).Gt(intConst(0)), "(assert (> (+ x (* x x)) 0))"},
+		{x.Pow(y).Eq(intConst(9)), ""},
+		{x.Pow(intConst(-1)).Eq(intConst(1)), ""},
+		{x.Pow(intConst(65)).Eq(intConst(0)), ""},
+	}
+	for _, tt := range tests {
+		err := b.Assert(tt.cond)
+		cmds := commands(t, log)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("Assert(%s) sent %s; want an error", tt.cond, cmds[len(cmds)-1])
+		case tt.want != "" && err != nil:
+			t.Errorf("Assert(%s): %v", tt.cond, err)
+		case tt.want != "" && cmds[len(cmds)-1] != tt.want:
+			t.Errorf("Assert(%s) sent %s; want %s", tt.cond, cmds[len(cmds)-1], tt.want)
+		}
+	}
+	// z3 には ^ をそのまま送る
+	b.z3 = true
+	if err := b.Assert(x.Pow(y).Eq(intConst(9))); err != nil {
+		t.Errorf("Assert to z3: %v", err)
+	} else if cmds := commands(t, log); cmds[len(cmds)-1] != "(assert (= (^ x y) 9))" {
+		t.Errorf("Assert to z3 sent %s", cmds[len(cmds)-1])
+	}
+}
+
+// intConst は整数の定数の項を返す関数
+func intConst(v int64) *smt.Term {
+	return smt.IntConst(big.NewInt(v))
+}
@@ -0,0 +1,399 @@
+package smtlib
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+// Statement は SMT-LIB2 のスクリプトのコマンドを表す構造体型
+type Statement struct {
+	Name  string    // assert, check-sat, get-value, get-model
+	Term  *smt.Term // assert の制約条件
+	Names []string  // get-value の制約変数名
+	Line  int       // コマンドの行番号
+}
+
+// Script は読み込んだ SMT-LIB2 のスクリプトを表す構造体型。
+// 制約変数の宣言は読み込みの際に Context に対して行う。
+type Script struct {
+	Vars       []*smt.Term // 宣言順の制約変数
+	Statements []Statement
+}
+
+// Parse は QF_LIA, QF_LRA, QF_NIA の範囲の SMT-LIB2 のスクリプトを読み込む関数。
+// 扱うコマンドは declare-const, declare-fun（引数なし）, assert, check-sat,
+// get-value, get-model で、set-logic, set-option, set-info, exit は読み飛ばす。
+func Parse(c *smt.Context, r io.Reader) (*Script, error) {
+	p := &parser{c: c, vars: map[string]*smt.Term{}, s: &Script{}}
+	rd := NewReader(r)
+	for {
+		e, err := rd.Read()
+		if err == io.EOF {
+			return p.s, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := p.command(e, rd.Line()); err != nil {
+			return nil, fmt.Errorf("line %d: %v", rd.Line(), err)
+		}
+	}
+}
+
+// parser は SMT-LIB2 のスクリプトの読み込みの状態を保持する構造体型
+type parser struct {
+	c    *smt.Context
+	vars map[string]*smt.Term
+	s    *Script
+}
+
+// command はコマンドを一つ処理する関数
+func (p *parser) command(e *Sexp, line int) error {
+	args := e.List
+	if len(args) > 0 {
+		args = args[1:]
+	}
+	switch e.Head() {
+	case "set-logic", "set-option", "set-info", "exit":
+		return nil
+	case "declare-const":
+		if len(args) != 2 {
+			return fmt.Errorf("malformed declare-const: %s", e)
+		}
+		return p.declare(args[0], args[1])
+	case "declare-fun":
+		if len(args) != 3 || !args[1].IsList() || len(args[1].List) != 0 {
+			return fmt.Errorf("only declare-fun of arity 0 is supported: %s", e)
+		}
+		return p.declare(args[0], args[2])
+	case "assert":
+		if len(args) != 1 {
+			return fmt.Errorf("malformed assert: %s", e)
+		}
+		t, err := p.term(args[0], nil)
+		if err != nil {
+			return err
+		}
+		if t.Sort != smt.SortBool {
+			return fmt.Errorf("assert: %s is %s, not Bool", args[0], t.Sort)
+		}
+		p.s.Statements = append(p.s.Statements, Statement{Name: "assert", Term: t, Line: line})
+	case "check-sat", "get-model":
+		p.s.Statements = append(p.s.Statements, Statement{Name: e.Head(), Line: line})
+	case "get-value":
+		if len(args) != 1 || !args[0].IsList() {
+			return fmt.Errorf("malformed get-value: %s", e)
+		}
+		var names []string
+		for _, x := range args[0].List {
+			if _, ok := p.vars[x.Atom]; x.IsList() || !ok {
+				return fmt.Errorf("get-value: only declared constants are supported: %s", x)
+			}
+			names = append(names, x.Atom)
+		}
+		p.s.Statements = append(p.s.Statements, Statement{Name: "get-value", Names: names, Line: line})
+	default:
+		return fmt.Errorf("unsupported command: %s", e.Head())
+	}
+	return nil
+}
+
+// declare は制約変数を宣言する関数
+func (p *parser) declare(name, sort *Sexp) error {
+	if name.IsList() {
+		return fmt.Errorf("invalid name: %s", name)
+	}
+	if _, ok := p.vars[name.Atom]; ok {
+		return fmt.Errorf("%s redeclared", name.Atom)
+	}
+	var v *smt.Term
+	switch sort.Atom {
+	case "Int":
+		v = p.c.IntVar(name.Atom)
+	case "Real":
+		v = p.c.NumVar(name.Atom)
+	case "Bool":
+		v = p.c.BoolVar(name.Atom)
+	default:
+		return fmt.Errorf("unsupported sort: %s", sort)
+	}
+	p.vars[name.Atom] = v
+	p.s.Vars = append(p.s.Vars, v)
+	return nil
+}
+
+// term は S 式を項に変換する関数。env は let で束縛された名前。
+func (p *parser) term(e *Sexp, env map[string]*smt.Term) (*smt.Term, error) {
+	if !e.IsList() {
+		return p.atom(e.Atom, env)
+	}
+	if len(e.List) == 0 {
+		return nil, fmt.Errorf("empty term")
+	}
+
+	switch e.Head() {
+	case "let":
+		return p.let(e, env)
+	case "!":
+		// 注釈 (! t :named n) は t とする
+		if len(e.List) < 2 {
+			return nil, fmt.Errorf("malformed annotation: %s", e)
+		}
+		return p.term(e.List[1], env)
+	}
+
+	var args []*smt.Term
+	for _, x := range e.List[1:] {
+		t, err := p.term(x, env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, t)
+	}
+	t, err := apply(e.Head(), args)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, e)
+	}
+	if t.Err() != nil {
+		return nil, fmt.Errorf("%v: %s", t.Err(), e)
+	}
+	return t, nil
+}
+
+// atom はアトムを項に変換する関数
+func (p *parser) atom(a string, env map[string]*smt.Term) (*smt.Term, error) {
+	if t, ok := env[a]; ok {
+		return t, nil
+	}
+	if t, ok := p.vars[a]; ok {
+		return t, nil
+	}
+	switch {
+	case a == "true":
+		return smt.BoolConst(true), nil
+	case a == "false":
+		return smt.BoolConst(false), nil
+	case isNumeral(a):
+		n, _ := new(big.Int).SetString(a, 10)
+		return smt.IntConst(n), nil
+	case isDecimal(a):
+		r, _ := new(big.Rat).SetString(a)
+		return smt.NumConst(r), nil
+	}
+	return nil, fmt.Errorf("unknown symbol: %s", a)
+}
+
+// isNumeral は 0 または 0 で始まらない数字の列かどうかを調べる関数
+func isNumeral(a string) bool {
+	if a == "" || a[0] == '0' && a != "0" {
+		return false
+	}
+	return strings.Trim(a, "0123456789") == ""
+}
+
+// isDecimal は 1.5 のような小数かどうかを調べる関数
+func isDecimal(a string) bool {
+	i := strings.IndexByte(a, '.')
+	return i > 0 && isNumeral(a[:i]) && i+1 < len(a) && strings.Trim(a[i+1:], "0123456789") == ""
+}
+
+// let は (let ((x t) ...) body) を変換する関数。束縛は並列に行う。
+func (p *parser) let(e *Sexp, env map[string]*smt.Term) (*smt.Term, error) {
+	if len(e.List) != 3 || !e.List[1].IsList() {
+		return nil, fmt.Errorf("malformed let: %s", e)
+	}
+	inner := map[string]*smt.Term{}
+	for k, v := range env {
+		inner[k] = v
+	}
+	for _, b := range e.List[1].List {
+		if len(b.List) != 2 || b.List[0].IsList() {
+			return nil, fmt.Errorf("malformed let binding: %s", b)
+		}
+		t, err := p.term(b.List[1], env)
+		if err != nil {
+			return nil, err
+		}
+		inner[b.List[0].Atom] = t
+	}
+	return p.term(e.List[2], inner)
+}
+
+// apply は SMT-LIB2 の関数を項に適用する関数
+func apply(f string, args []*smt.Term) (*smt.Term, error) {
+	arity := func(n int) error {
+		if len(args) != n {
+			return fmt.Errorf("%s expects %d arguments", f, n)
+		}
+		return nil
+	}
+	atLeast := func(n int) error {
+		if len(args) < n {
+			return fmt.Errorf("%s expects at least %d arguments", f, n)
+		}
+		return nil
+	}
+
+	switch f {
+	case "+", "*", "and", "or", "distinct":
+		if err := atLeast(1); err != nil {
+			return nil, err
+		}
+		x, rest := args[0], args[1:]
+		switch f {
+		case "+":
+			return x.Add(rest...), nil
+		case "*":
+			return x.Mul(rest...), nil
+		case "and":
+			return x.And(rest...), nil
+		case "or":
+			return x.Or(rest...), nil
+		}
+		return x.Distinct(rest...), nil
+	case "-":
+		if err := atLeast(1); err != nil {
+			return nil, err
+		}
+		if len(args) == 1 {
+			return args[0].Neg(), nil
+		}
+		return args[0].Sub(args[1:]...), nil
+	case "/":
+		// 実数の除算なので整数は実数に変換する
+		if err := atLeast(2); err != nil {
+			return nil, err
+		}
+		x := toReal(args[0])
+		for _, y := range args[1:] {
+			x = x.Div(toReal(y))
+		}
+		return x, nil
+	case "div", "mod":
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		if args[0].Sort != smt.SortInt || args[1].Sort != smt.SortInt {
+			return nil, fmt.Errorf("%s expects Int arguments", f)
+		}
+		if f == "div" {
+			return args[0].Div(args[1]), nil
+		}
+		return args[0].Mod(args[1]), nil
+	case "abs":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		zero := smt.IntConst(new(big.Int))
+		return args[0].Lt(zero).Ite(args[0].Neg(), args[0]), nil
+	case "=", "<", "<=", ">", ">=":
+		// 連鎖した比較 (< a b c) は (and (< a b) (< b c)) とする
+		if err := atLeast(2); err != nil {
+			return nil, err
+		}
+		var ts []*smt.Term
+		for i := 0; i+1 < len(args); i++ {
+			x, y := args[i], args[i+1]
+			switch f {
+			case "=":
+				ts = append(ts, x.Eq(y))
+			case "<":
+				ts = append(ts, x.Lt(y))
+			case "<=":
+				ts = append(ts, x.Le(y))
+			case ">":
+				ts = append(ts, x.Gt(y))
+			default:
+				ts = append(ts, x.Ge(y))
+			}
+		}
+		if len(ts) == 1 {
+			return ts[0], nil
+		}
+		return ts[0].And(ts[1:]...), nil
+	case "not":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		return args[0].Not(), nil
+	case "xor":
+		if err := atLeast(2); err != nil {
+			return nil, err
+		}
+		x := args[0]
+		for _, y := range args[1:] {
+			x = x.Xor(y)
+		}
+		return x, nil
+	case "=>":
+		// 右結合: (=> a b c) は (=> a (=> b c))
+		if err := atLeast(2); err != nil {
+			return nil, err
+		}
+		x := args[len(args)-1]
+		for i := len(args) - 2; i >= 0; i-- {
+			x = args[i].Implies(x)
+		}
+		return x, nil
+	case "ite":
+		if err := arity(3); err != nil {
+			return nil, err
+		}
+		return args[0].Ite(args[1], args[2]), nil
+	case "to_real", "to_int", "is_int":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		switch f {
+		case "to_real":
+			return args[0].ToReal(), nil
+		case "to_int":
+			return args[0].ToInt(), nil
+		}
+		return args[0].IsInt(), nil
+	}
+	return nil, fmt.Errorf("unsupported function: %s", f)
+}
+
+// toReal は整数の項を実数に変換する関数。整数の定数は実数の定数とする。
+func toReal(t *smt.Term) *smt.Term {
+	switch {
+	case t.Sort != smt.SortInt:
+		return t
+	case t.Op == smt.OpConst:
+		return smt.NumConst(t.Num)
+	}
+	return t.ToReal()
+}
+
+// Run はスクリプトのコマンドを順に実行する関数。
+// check-sat の結果は sat, unsat, unknown のいずれかを、get-value と get-model の結果は
+// Solve と同じく name = value の形式で標準出力に表示する。
+func (s *Script) Run(c *smt.Context) error {
+	for _, cmd := range s.Statements {
+		switch cmd.Name {
+		case "assert":
+			c.Assert(cmd.Term)
+		case "check-sat":
+			st, err := c.Check()
+			if err != nil {
+				return fmt.Errorf("line %d: %v", cmd.Line, err)
+			}
+			fmt.Fprintln(os.Stdout, st)
+		case "get-value":
+			c.Solve(cmd.Names...)
+		case "get-model":
+			var names []string
+			for _, v := range s.Vars {
+				names = append(names, v.Name)
+			}
+			c.Solve(names...)
+		}
+	}
+	return nil
+}
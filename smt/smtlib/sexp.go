@@ -0,0 +1,161 @@
+package smtlib
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Sexp は SMT-LIB2 の S 式を表す構造体型。
+// List が nil の場合はアトム（シンボル、数値、文字列）で、Atom にその文字列が入る。
+// |x[0]| のように囲まれたシンボルは囲みを外した名前となる。
+type Sexp struct {
+	Atom string
+	List []*Sexp
+}
+
+// IsList は S 式がリストかどうかを調べる関数
+func (e *Sexp) IsList() bool {
+	return e.List != nil
+}
+
+// Head はリストの先頭のアトムを返す関数
+func (e *Sexp) Head() string {
+	if len(e.List) == 0 || e.List[0].IsList() {
+		return ""
+	}
+	return e.List[0].Atom
+}
+
+// String は S 式の文字列表現を返す関数
+func (e *Sexp) String() string {
+	if !e.IsList() {
+		return e.Atom
+	}
+	var ss []string
+	for _, x := range e.List {
+		ss = append(ss, x.String())
+	}
+	return "(" + strings.Join(ss, " ") + ")"
+}
+
+// Reader は入力から S 式を一つずつ読み込む構造体型
+type Reader struct {
+	r    *bufio.Reader
+	line int
+}
+
+// NewReader は r から S 式を読み込む Reader を生成する関数
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r), line: 1}
+}
+
+// Line は現在の行番号を返す関数
+func (rd *Reader) Line() int {
+	return rd.line
+}
+
+// Read は S 式を一つ読み込む関数。入力の終わりでは io.EOF を返す。
+func (rd *Reader) Read() (*Sexp, error) {
+	tok, err := rd.token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case "(":
+		e := &Sexp{List: []*Sexp{}}
+		for {
+			x, err := rd.Read()
+			if err == errClose {
+				return e, nil
+			}
+			if err == io.EOF {
+				return nil, fmt.Errorf("line %d: unexpected end of input", rd.line)
+			}
+			if err != nil {
+				return nil, err
+			}
+			e.List = append(e.List, x)
+		}
+	case ")":
+		return nil, errClose
+	}
+	return &Sexp{Atom: tok}, nil
+}
+
+// errClose は閉じ括弧を読んだことを表す内部のエラー
+var errClose = fmt.Errorf("unexpected )")
+
+// token は字句を一つ読み込む関数
+func (rd *Reader) token() (string, error) {
+	// 空白と注釈を読み飛ばす
+	var c byte
+	for {
+		b, err := rd.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case b == '\n':
+			rd.line++
+		case b == ';':
+			for b != '\n' {
+				if b, err = rd.r.ReadByte(); err != nil {
+					return "", err
+				}
+			}
+			rd.line++
+		case b == ' ' || b == '\t' || b == '\r':
+		default:
+			c = b
+		}
+		if c != 0 {
+			break
+		}
+	}
+
+	switch c {
+	case '(', ')':
+		return string(c), nil
+	case '|', '"':
+		// |...| のシンボルと "..." の文字列
+		var sb strings.Builder
+		if c == '"' {
+			sb.WriteByte(c)
+		}
+		for {
+			b, err := rd.r.ReadByte()
+			if err != nil {
+				return "", fmt.Errorf("line %d: unterminated %c", rd.line, c)
+			}
+			if b == '\n' {
+				rd.line++
+			}
+			if b == c {
+				if c == '"' {
+					// "" は " のエスケープ
+					if next, err := rd.r.Peek(1); err == nil && next[0] == '"' {
+						rd.r.ReadByte()
+						sb.WriteByte(b)
+						continue
+					}
+					sb.WriteByte(b)
+				}
+				return sb.String(), nil
+			}
+			sb.WriteByte(b)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteByte(c)
+	for {
+		next, err := rd.r.Peek(1)
+		if err != nil || strings.IndexByte(" \t\r\n();|\"", next[0]) >= 0 {
+			return sb.String(), nil
+		}
+		rd.r.ReadByte()
+		sb.WriteByte(next[0])
+	}
+}
@@ -0,0 +1,70 @@
+package smt
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Stat は統計情報の一項目を表す構造体型
+type Stat struct {
+	Key   string
+	Value float64
+}
+
+// String は統計情報の項目を "key: value" の形式で返す関数
+func (s Stat) String() string {
+	return fmt.Sprintf("%s: %s", s.Key, strconv.FormatFloat(s.Value, 'f', -1, 64))
+}
+
+// Statistician は統計情報（衝突や決定の回数など）を返せるバックエンドが実装するインタフェース。
+// Context の項目（vars など）と区別できるように、キーにはバックエンドの名前を前置する（sat.vars など）。
+type Statistician interface {
+	Statistics() []Stat
+}
+
+// Statistics は宣言した制約変数と制約条件の数、項をバックエンドの表現に変換した時間、
+// これまでの Check の回数と所要時間（時間はミリ秒）に、バックエンドの統計情報を加えて返す関数
+func (c *Context) Statistics() []Stat {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.statistics()
+}
+
+// Stats は Statistics の統計情報を一行に一項目ずつ標準エラー出力に表示する関数。
+// 制約の書き方（Distinct と != の組み合わせなど）を比べるのに使う。
+func (c *Context) Stats() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.printStatistics()
+}
+
+// SetPrintStats は Close の際に統計情報を標準エラー出力に表示するかどうかを設定する関数
+func (c *Context) SetPrintStats(on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.printStats = on
+}
+
+// printStatistics は統計情報を標準エラー出力に表示する関数。呼び出し側でロックを取得していること。
+func (c *Context) printStatistics() {
+	for _, s := range c.statistics() {
+		fmt.Fprintln(os.Stderr, s)
+	}
+}
+
+// statistics は Statistics の本体。呼び出し側でロックを取得していること。
+func (c *Context) statistics() []Stat {
+	stats := []Stat{
+		{Key: "vars", Value: float64(len(c.vars))},
+		{Key: "asserts", Value: float64(len(c.asserts))},
+		{Key: "convert_ms", Value: milliseconds(c.convertTime)},
+		{Key: "checks", Value: float64(c.checks)},
+		{Key: "check_ms", Value: milliseconds(c.checkTime)},
+		{Key: "model_ms", Value: milliseconds(c.modelTime)},
+	}
+	if s, ok := c.backend.(Statistician); ok {
+		stats = append(stats, s.Statistics()...)
+	}
+	return stats
+}
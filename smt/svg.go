@@ -0,0 +1,195 @@
+package smt
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"os"
+	"strings"
+)
+
+// SVG の図の寸法と色
+const (
+	svgCell     = 40 // マスの一辺
+	svgMargin   = 20
+	svgTitle    = 24 // 配列の名前の欄の高さ
+	svgGiven    = "#e0e0e0"
+	svgLight    = "#f0d9b5" // 盤面の明るいマス
+	svgDark     = "#b58863" // 盤面の暗いマス
+	svgSolved   = "#1a5fb4" // 解いた値の文字の色
+	svgPiece    = "#202020"
+	svgFontSize = 22
+)
+
+// SetSVG は Solve で配列の解を盤面の図にして SVG ファイル path に書き出すように設定する関数。
+// Solve のたびにファイルを書き直す。path が空文字列の場合は書き出さない。
+func (c *Context) SetSVG(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.svgPath = path
+}
+
+// writeSVG は解の配列を盤面の図にして SVG ファイルに書き出す関数。
+// 配列でない制約変数は name = value の文字列で書き出す。呼び出し側でロックを取得していること。
+func (c *Context) writeSVG(names []string, s *solveStats) error {
+	given := c.givenCells()
+	var b strings.Builder
+	y, width := svgMargin, 2*svgMargin
+
+	if len(s.solutions) == 0 {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="%d">unsolvable</text>`+"\n", svgMargin, y+svgFontSize, svgFontSize)
+		y += svgTitle + svgMargin
+		width += 8 * svgFontSize
+	}
+	for _, r := range s.solutions {
+		for _, g := range c.groups(names) {
+			if !g.array {
+				v, _ := r.Value(g.name)
+				text := fmt.Sprintf("%s = %s", g.name, v.Format(c.numFormat, c.digits))
+				fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="16">%s</text>`+"\n", svgMargin, y+16, html.EscapeString(text))
+				y += svgTitle
+				continue
+			}
+
+			values := make([]Value, len(g.elems))
+			for i, name := range g.elems {
+				values[i], _ = r.Value(name)
+			}
+			d, ok := c.displays[g.name]
+			if !ok {
+				d = &display{cols: squareCols(len(values))}
+			}
+			w, h := d.svgBoard(&b, g, values, given, svgMargin, y)
+			if w+2*svgMargin > width {
+				width = w + 2*svgMargin
+			}
+			y += h + svgMargin
+		}
+	}
+
+	f, err := os.Create(c.svgPath)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(f, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif">`+"\n", width, y)
+	fmt.Fprintf(f, `<rect width="%d" height="%d" fill="white"/>`+"\n", width, y)
+	fmt.Fprint(f, b.String())
+	fmt.Fprintln(f, "</svg>")
+	return f.Close()
+}
+
+// squareCols は要素数 n が平方数ならその平方根を、そうでなければ n を返す関数
+func squareCols(n int) int {
+	k := int(math.Sqrt(float64(n)))
+	for ; k*k < n; k++ {
+	}
+	if k*k == n {
+		return k
+	}
+	return n
+}
+
+// givenCells は x[i] == 定数 の形の制約条件で値が与えられている制約変数の名前を返す関数。
+// 呼び出し側でロックを取得していること。
+func (c *Context) givenCells() map[string]bool {
+	given := map[string]bool{}
+	var visit func(t *Term)
+	visit = func(t *Term) {
+		switch {
+		case t.Op == OpAnd:
+			for _, arg := range t.Args {
+				visit(arg)
+			}
+		case t.Op == OpEq && len(t.Args) == 2:
+			a, b := t.Args[0], t.Args[1]
+			if a.Op == OpConst {
+				a, b = b, a
+			}
+			if a.Op == OpVar && b.Op == OpConst {
+				given[a.Name] = true
+			}
+		}
+	}
+	for _, a := range c.asserts {
+		visit(a)
+	}
+	return given
+}
+
+// svgBoard は配列の値を (x, y) を左上とする盤面として書き出し、その幅と高さを返す関数。
+// Bool の配列と positions の配列は駒を置いた盤面とし、その他は値を文字で書き込む。
+// 与えられたマスは背景を灰色にし、解いたマスの値は色を変える。
+func (d *display) svgBoard(b *strings.Builder, g group, values []Value, given map[string]bool, x, y int) (int, int) {
+	cols := d.cols
+	if cols == 0 {
+		cols = len(values)
+	}
+	rows := (len(values) + cols - 1) / cols
+	board := d.positions || (len(values) > 0 && values[0].Sort == SortBool)
+	if d.positions {
+		rows = len(values)
+	}
+
+	fmt.Fprintf(b, `<text x="%d" y="%d" font-size="16">%s</text>`+"\n", x, y+16, html.EscapeString(g.name))
+	y += svgTitle
+
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			cx, cy := x+j*svgCell, y+i*svgCell
+			var v Value
+			var name string
+			if !d.positions {
+				if k := i*cols + j; k < len(values) {
+					v, name = values[k], g.elems[k]
+				} else {
+					continue
+				}
+			}
+
+			fill := "white"
+			switch {
+			case board && (i+j)%2 == 0:
+				fill = svgLight
+			case board:
+				fill = svgDark
+			case given[name]:
+				fill = svgGiven
+			}
+			fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="#808080"/>`+"\n", cx, cy, svgCell, svgCell, fill)
+
+			occupied := false
+			switch {
+			case d.positions:
+				p := values[i]
+				occupied = p.Int != nil && p.Int.IsInt64() && p.Int.Int64() == int64(j)
+			case v.Sort == SortBool:
+				occupied = v.Bool
+			default:
+				color, weight := svgSolved, "normal"
+				if given[name] {
+					color, weight = "black", "bold"
+				}
+				fmt.Fprintf(b, `<text x="%d" y="%d" font-size="%d" font-weight="%s" fill="%s" text-anchor="middle">%s</text>`+"\n",
+					cx+svgCell/2, cy+svgCell/2+svgFontSize*3/8, svgFontSize, weight, color, html.EscapeString(d.glyph(csvValue(v))))
+				continue
+			}
+			if occupied {
+				if glyph, ok := d.glyphs["true"]; ok {
+					fmt.Fprintf(b, `<text x="%d" y="%d" font-size="%d" font-weight="bold" fill="%s" text-anchor="middle">%s</text>`+"\n",
+						cx+svgCell/2, cy+svgCell/2+svgFontSize*3/8, svgFontSize, svgPiece, html.EscapeString(glyph))
+				} else {
+					fmt.Fprintf(b, `<circle cx="%d" cy="%d" r="%d" fill="%s"/>`+"\n", cx+svgCell/2, cy+svgCell/2, svgCell*3/10, svgPiece)
+				}
+			}
+		}
+	}
+
+	// box の区切りは太い線で描く
+	for i := 0; d.boxRows > 0 && i <= rows; i += d.boxRows {
+		fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black" stroke-width="3"/>`+"\n", x, y+i*svgCell, x+cols*svgCell, y+i*svgCell)
+	}
+	for j := 0; d.boxCols > 0 && j <= cols; j += d.boxCols {
+		fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black" stroke-width="3"/>`+"\n", x+j*svgCell, y, x+j*svgCell, y+rows*svgCell)
+	}
+	return cols * svgCell, svgTitle + rows*svgCell
+}
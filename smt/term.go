@@ -0,0 +1,364 @@
+package smt
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Op は項の演算子を表す型。値は SMT-LIB2 の表記に合わせている。
+type Op string
+
+// 項の演算子
+const (
+	OpVar      Op = "var"   // 制約変数
+	OpConst    Op = "const" // 定数
+	OpAdd      Op = "+"
+	OpSub      Op = "-"
+	OpMul      Op = "*"
+	OpDiv      Op = "/" // Int どうしの場合は div
+	OpMod      Op = "mod"
+	OpPow      Op = "^"
+	OpNeg      Op = "neg"
+	OpEq       Op = "="
+	OpDistinct Op = "distinct"
+	OpLt       Op = "<"
+	OpLe       Op = "<="
+	OpGt       Op = ">"
+	OpGe       Op = ">="
+	OpNot      Op = "not"
+	OpAnd      Op = "and"
+	OpOr       Op = "or"
+	OpXor      Op = "xor"
+	OpImplies  Op = "=>"
+	OpIff      Op = "iff"
+	OpIte      Op = "ite"
+	OpToReal   Op = "to_real"
+	OpToInt    Op = "to_int"
+	OpIsInt    Op = "is_int"
+)
+
+// Term は制約条件の式（項）を表す構造体型。
+// DSL から変換されたコードは x.Add(y).Eq(z) のようにメソッドを連ねて項を組み立てる。
+// 項はソルバーに依存せず、Assert されたときにバックエンドがソルバーの表現に変換する。
+type Term struct {
+	Op   Op
+	Sort string   // SortInt, SortNum, SortBool のいずれか
+	Args []*Term  // 被演算子
+	Name string   // Op が OpVar の場合の変数名
+	Num  *big.Rat // Op が OpConst で Sort が SortInt, SortNum の場合の値
+	Bool bool     // Op が OpConst で Sort が SortBool の場合の値
+
+	err   error  // 項の組み立てで検出したエラー
+	label string // Show で表示する名前
+}
+
+// Err は項の組み立てで検出したエラーを返す関数
+func (t *Term) Err() error {
+	return t.err
+}
+
+// varTerm は制約変数の項を作成する関数
+func varTerm(name, sort string) *Term {
+	return &Term{Op: OpVar, Sort: sort, Name: name}
+}
+
+// IntConst は整数の定数の項を作成する関数
+func IntConst(v *big.Int) *Term {
+	return &Term{Op: OpConst, Sort: SortInt, Num: new(big.Rat).SetInt(v)}
+}
+
+// NumConst は数値の定数の項を作成する関数
+func NumConst(v *big.Rat) *Term {
+	return &Term{Op: OpConst, Sort: SortNum, Num: new(big.Rat).Set(v)}
+}
+
+// BoolConst は真理値の定数の項を作成する関数
+func BoolConst(v bool) *Term {
+	return &Term{Op: OpConst, Sort: SortBool, Bool: v}
+}
+
+// apply は演算子の項を作成する関数。被演算子のソートを検査し、
+// Int と Num が混在する場合は Int の被演算子を Num に昇格させる。
+func apply(op Op, args ...*Term) *Term {
+	t := &Term{Op: op, Args: args}
+	for _, arg := range args {
+		if arg.err != nil {
+			t.err = arg.err
+			return t
+		}
+	}
+
+	switch op {
+	case OpAdd, OpSub, OpMul, OpDiv, OpPow:
+		t.Sort = t.promote(args)
+	case OpNeg:
+		t.Sort = t.expect(args, SortInt, SortNum)
+	case OpMod:
+		t.Sort = t.expect(args, SortInt)
+	case OpLt, OpLe, OpGt, OpGe:
+		t.promote(args)
+		t.Sort = SortBool
+	case OpEq, OpDistinct:
+		if args[0].Sort == SortBool {
+			t.expect(args, SortBool)
+		} else {
+			t.promote(args)
+		}
+		t.Sort = SortBool
+	case OpNot, OpAnd, OpOr, OpXor, OpImplies, OpIff:
+		t.Sort = t.expect(args, SortBool)
+	case OpIte:
+		t.expect(args[:1], SortBool)
+		if args[1].Sort == SortBool {
+			t.Sort = t.expect(args[1:], SortBool)
+		} else {
+			t.Sort = t.promote(args[1:])
+		}
+	case OpToReal:
+		t.expect(args, SortInt)
+		t.Sort = SortNum
+	case OpToInt:
+		t.expect(args, SortNum)
+		t.Sort = SortInt
+	case OpIsInt:
+		t.expect(args, SortNum)
+		t.Sort = SortBool
+	}
+	return t
+}
+
+// expect は被演算子がすべて同じソートで、許可されたソートかどうかを検査する関数
+func (t *Term) expect(args []*Term, allowed ...string) string {
+	sort := args[0].Sort
+	for _, arg := range args {
+		ok := false
+		for _, a := range allowed {
+			if arg.Sort == a {
+				ok = true
+			}
+		}
+		if !ok || arg.Sort != sort {
+			t.err = fmt.Errorf("invalid operation: operator %s not defined on %s", t.Op, arg.Sort)
+			return ""
+		}
+	}
+	return sort
+}
+
+// promote は数値の被演算子のうち Int を Num に昇格させ、演算結果のソートを返す関数
+func (t *Term) promote(args []*Term) string {
+	if t.expect(args, SortInt, SortNum) != "" {
+		return args[0].Sort
+	}
+	if t.err != nil && !t.mixedNumeric(args) {
+		return ""
+	}
+	t.err = nil
+	for i, arg := range args {
+		if arg.Sort == SortInt {
+			args[i] = apply(OpToReal, arg)
+		}
+	}
+	return SortNum
+}
+
+// mixedNumeric は被演算子がすべて Int または Num かどうかを調べる関数
+func (t *Term) mixedNumeric(args []*Term) bool {
+	for _, arg := range args {
+		if arg.Sort != SortInt && arg.Sort != SortNum {
+			return false
+		}
+	}
+	return true
+}
+
+// Add は和 t + args... の項を作成する関数
+func (t *Term) Add(args ...*Term) *Term {
+	return apply(OpAdd, append([]*Term{t}, args...)...)
+}
+
+// Sub は差 t - args... の項を作成する関数
+func (t *Term) Sub(args ...*Term) *Term {
+	return apply(OpSub, append([]*Term{t}, args...)...)
+}
+
+// Mul は積 t * args... の項を作成する関数
+func (t *Term) Mul(args ...*Term) *Term {
+	return apply(OpMul, append([]*Term{t}, args...)...)
+}
+
+// Div は商 t / a の項を作成する関数。Int どうしの場合は整数除算となる。
+func (t *Term) Div(a *Term) *Term {
+	return apply(OpDiv, t, a)
+}
+
+// Mod は剰余 t mod a の項を作成する関数
+func (t *Term) Mod(a *Term) *Term {
+	return apply(OpMod, t, a)
+}
+
+// Pow はべき乗 t ^ a の項を作成する関数
+func (t *Term) Pow(a *Term) *Term {
+	return apply(OpPow, t, a)
+}
+
+// Neg は符号反転 -t の項を作成する関数
+func (t *Term) Neg() *Term {
+	return apply(OpNeg, t)
+}
+
+// Eq は等式 t == a の項を作成する関数
+func (t *Term) Eq(a *Term) *Term {
+	return apply(OpEq, t, a)
+}
+
+// Distinct は t と args... が互いに異なることを表す項を作成する関数
+func (t *Term) Distinct(args ...*Term) *Term {
+	return apply(OpDistinct, append([]*Term{t}, args...)...)
+}
+
+// Lt は t < a の項を作成する関数
+func (t *Term) Lt(a *Term) *Term {
+	return apply(OpLt, t, a)
+}
+
+// Le は t <= a の項を作成する関数
+func (t *Term) Le(a *Term) *Term {
+	return apply(OpLe, t, a)
+}
+
+// Gt は t > a の項を作成する関数
+func (t *Term) Gt(a *Term) *Term {
+	return apply(OpGt, t, a)
+}
+
+// Ge は t >= a の項を作成する関数
+func (t *Term) Ge(a *Term) *Term {
+	return apply(OpGe, t, a)
+}
+
+// Not は否定 !t の項を作成する関数
+func (t *Term) Not() *Term {
+	return apply(OpNot, t)
+}
+
+// And は論理積 t && args... の項を作成する関数
+func (t *Term) And(args ...*Term) *Term {
+	return apply(OpAnd, append([]*Term{t}, args...)...)
+}
+
+// Or は論理和 t || args... の項を作成する関数
+func (t *Term) Or(args ...*Term) *Term {
+	return apply(OpOr, append([]*Term{t}, args...)...)
+}
+
+// Xor は排他的論理和 t ^ a の項を作成する関数
+func (t *Term) Xor(a *Term) *Term {
+	return apply(OpXor, t, a)
+}
+
+// Implies は含意 t ならば a の項を作成する関数
+func (t *Term) Implies(a *Term) *Term {
+	return apply(OpImplies, t, a)
+}
+
+// Iff は同値 t と a が等しいことを表す項を作成する関数
+func (t *Term) Iff(a *Term) *Term {
+	return apply(OpIff, t, a)
+}
+
+// Ite は条件 t が真なら a、偽なら b となる項を作成する関数
+func (t *Term) Ite(a, b *Term) *Term {
+	return apply(OpIte, t, a, b)
+}
+
+// ToReal は Int を Num に変換する項を作成する関数
+func (t *Term) ToReal() *Term {
+	return apply(OpToReal, t)
+}
+
+// ToInt は Num を Int に変換する（切り捨て）項を作成する関数
+func (t *Term) ToInt() *Term {
+	return apply(OpToInt, t)
+}
+
+// IsInt は Num が整数値かどうかを表す項を作成する関数
+func (t *Term) IsInt() *Term {
+	return apply(OpIsInt, t)
+}
+
+// HasIntSort は項のソートが Int かどうかを調べる関数
+func (t *Term) HasIntSort() bool {
+	return t.Sort == SortInt
+}
+
+// HasRealSort は項のソートが Num かどうかを調べる関数
+func (t *Term) HasRealSort() bool {
+	return t.Sort == SortNum
+}
+
+// String は項の SMT-LIB2 形式の文字列表現を返す関数
+func (t *Term) String() string {
+	var b strings.Builder
+	t.write(&b)
+	return b.String()
+}
+
+// write は項の SMT-LIB2 形式の文字列表現を書き出す関数
+func (t *Term) write(b *strings.Builder) {
+	switch t.Op {
+	case OpVar:
+		b.WriteString(Symbol(t.Name))
+		return
+	case OpConst:
+		b.WriteString(constString(t))
+		return
+	}
+
+	op := string(t.Op)
+	switch {
+	case t.Op == OpNeg:
+		op = "-"
+	case t.Op == OpIff:
+		op = "="
+	case t.Op == OpDiv && t.Sort == SortInt:
+		op = "div"
+	}
+	b.WriteString("(" + op)
+	for _, arg := range t.Args {
+		b.WriteString(" ")
+		arg.write(b)
+	}
+	b.WriteString(")")
+}
+
+// constString は定数の項を SMT-LIB2 形式で表す関数
+func constString(t *Term) string {
+	switch t.Sort {
+	case SortBool:
+		if t.Bool {
+			return "true"
+		}
+		return "false"
+	case SortInt:
+		return intText(t.Num.Num())
+	}
+	return ratText(t.Num)
+}
+
+// Symbol は変数名を SMT-LIB2 のシンボルとして表す関数。
+// x[0] のように記号を含む名前は |x[0]| のように囲む。
+func Symbol(name string) string {
+	if name == "" {
+		return "||"
+	}
+	for i, c := range name {
+		simple := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || strings.ContainsRune("~!@$%^&*_-+=<>.?/", c) ||
+			i > 0 && c >= '0' && c <= '9'
+		if !simple {
+			return "|" + name + "|"
+		}
+	}
+	return name
+}
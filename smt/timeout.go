@@ -0,0 +1,192 @@
+package smt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Interrupter は実行中の Check を中断できるバックエンドが実装するインタフェース。
+// Interrupt は Check を実行しているのとは別のゴルーチンから呼び出される。
+// 中断された Check は StatusUnknown を返す。
+type Interrupter interface {
+	Interrupt()
+}
+
+// TimeoutSetter は Check の時間制限をサポートするバックエンドが実装するインタフェース。
+// d が 0 の場合は時間制限を解除する。
+type TimeoutSetter interface {
+	SetTimeout(d time.Duration) error
+}
+
+// UnknownReasoner は直前の Check が StatusUnknown を返した理由
+// （"timeout"、"incomplete" など）を返せるバックエンドが実装するインタフェース
+type UnknownReasoner interface {
+	ReasonUnknown() string
+}
+
+// SetTimeout は Solve と SolveAll の時間制限をミリ秒で設定する関数。
+// 時間制限は Solve ごとに適用され、SolveAll ではすべての解の列挙に適用される。
+// 時間内に判定できなかった場合は unknown と表示する。ms が 0 以下の場合は時間制限を解除する。
+func (c *Context) SetTimeout(ms int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timeout = 0
+	if ms > 0 {
+		c.timeout = time.Duration(ms) * time.Millisecond
+	}
+}
+
+// ReasonUnknown は直前の Check が StatusUnknown を返した理由を返す関数。
+// 理由が分からない場合は空文字列を返す。
+func (c *Context) ReasonUnknown() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reason
+}
+
+// CheckContext は制約が解決可能かどうかを ctx が終了するまでに調べる関数。
+// ctx の期限はバックエンドの時間制限として設定し、ctx がキャンセルされると
+// バックエンドの実行中の Check を中断する。この場合は StatusUnknown を返し、
+// ReasonUnknown がその理由を返す。SetTimeout の時間制限は適用しない。
+// Interrupt を呼び出した場合も中断する。
+func (c *Context) CheckContext(ctx context.Context) (Status, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(c.base, cancel)()
+	return c.checkContext(ctx)
+}
+
+// Interrupt は実行中の Check を中断し、以後の Solve と SolveAll を何も表示せずに終了させる関数。
+// Ctrl-C のシグナルハンドラのように、Solve を実行しているのとは別のゴルーチンから呼び出す。
+// 中断した後は Statistics で統計情報を取得し、Close で資源を解放すること。
+func (c *Context) Interrupt() {
+	// stop は NewContext で設定した後は変更しないので、ロックを取得せずに呼び出せる
+	c.stop()
+}
+
+// OnInterrupt は Interrupt で中断された Solve と SolveAll が、ロックを解放した後に呼び出す関数を設定する関数。
+// 中断したときに統計情報を表示してプログラムを終了する場合などに使う。
+func (c *Context) OnInterrupt(f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onInterrupt = f
+}
+
+// interrupted は Interrupt が呼び出されたかどうかを返す関数
+func (c *Context) interrupted() bool {
+	return c.base.Err() != nil
+}
+
+// notifyInterrupt は Interrupt で中断されていれば OnInterrupt で設定した関数を呼び出す関数。
+// 呼び出し側でロックを取得していないこと。
+func (c *Context) notifyInterrupt() {
+	if !c.interrupted() {
+		return
+	}
+	c.mu.Lock()
+	f := c.onInterrupt
+	c.mu.Unlock()
+	if f != nil {
+		f()
+	}
+}
+
+// withTimeout は SetTimeout の時間制限を期限とし、Interrupt でキャンセルされるコンテクストを返す関数。
+// 呼び出し側でロックを取得していること。
+func (c *Context) withTimeout() (context.Context, context.CancelFunc) {
+	if c.timeout > 0 {
+		return context.WithTimeout(c.base, c.timeout)
+	}
+	return context.WithCancel(c.base)
+}
+
+// checkContext は CheckContext の本体。lits が空でなければ CheckAssuming の仮定とする。
+// 呼び出し側でロックを取得していること。
+func (c *Context) checkContext(ctx context.Context, lits ...*Term) (Status, error) {
+	c.reason = ""
+	c.solved = false
+	c.last = nil
+	c.lastStatus = StatusUnknown
+	c.found = false
+	if c.err != nil {
+		return StatusUnknown, c.err
+	}
+	if c.backend == nil {
+		return StatusUnknown, errors.New("no backend to solve the problem")
+	}
+	if err := ctx.Err(); err != nil {
+		c.reason = contextReason(err)
+		return StatusUnknown, nil
+	}
+	if err := c.selectLogic(); err != nil {
+		return StatusUnknown, err
+	}
+
+	// 期限をバックエンドの時間制限とする
+	if ts, ok := c.backend.(TimeoutSetter); ok {
+		var d time.Duration
+		if deadline, ok := ctx.Deadline(); ok {
+			if d = time.Until(deadline); d < time.Millisecond {
+				d = time.Millisecond
+			}
+		}
+		if err := ts.SetTimeout(d); err != nil {
+			return StatusUnknown, fmt.Errorf("SetTimeout: %v", err)
+		}
+	}
+
+	// キャンセルされたら実行中の Check を中断する。
+	// Check から戻った後に中断しないよう、監視を終えるのを待つ。
+	if in, ok := c.backend.(Interrupter); ok && ctx.Done() != nil {
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			select {
+			case <-ctx.Done():
+				in.Interrupt()
+			case <-stop:
+			}
+		}()
+		defer func() {
+			close(stop)
+			<-done
+		}()
+	}
+
+	start := time.Now()
+	var st Status
+	var err error
+	if len(lits) > 0 {
+		st, err = c.backend.(Assumer).CheckAssuming(lits)
+	} else {
+		st, err = c.backend.Check()
+	}
+	c.checks++
+	c.checkTime += time.Since(start)
+	c.solved = err == nil && st == StatusSat
+	if err == nil {
+		c.lastStatus = st
+	}
+	if err == nil && st == StatusUnknown {
+		// 期限切れやキャンセルによる中断は、バックエンドの理由よりも優先する
+		if ctx.Err() != nil {
+			c.reason = contextReason(ctx.Err())
+		} else if r, ok := c.backend.(UnknownReasoner); ok {
+			c.reason = r.ReasonUnknown()
+		}
+	}
+	return st, err
+}
+
+// contextReason はコンテクストの終了の理由を Z3 と同じ表記で返す関数
+func contextReason(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	return "canceled"
+}
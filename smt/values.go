@@ -0,0 +1,151 @@
+package smt
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Sat は直前の Check（Solve、SolveAll、Model、CheckAssuming を含む）が解決可能だったかどうかを返す関数。
+// 直前が SolveAll の場合は解を一つ以上見つけたかどうかを返す。
+// DSL では if Sat() { ... } のように解の有無で処理を分けるのに使う。
+func (c *Context) Sat() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastStatus == StatusSat || c.found
+}
+
+// Unsat は直前の Check が解決不能だったかどうかを返す関数。
+// 直前が SolveAll の場合は解が一つもなかったかどうかを返す。
+// 判定できなかった場合とまだ Check していない場合は、Sat と Unsat のどちらも false を返す。
+func (c *Context) Unsat() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastStatus == StatusUnsat && !c.found
+}
+
+// IntValue は直前の解のもとでの整数の項の値を返す関数。
+// 値を求められない場合はエラーを標準エラー出力に表示して 0 を返す。
+func (c *Context) IntValue(t *Term) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.intValue("IntValue", t)
+}
+
+// BoolValue は直前の解のもとでのブール型の項の値を返す関数。
+// 値を求められない場合はエラーを標準エラー出力に表示して false を返す。
+func (c *Context) BoolValue(t *Term) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.boolValue("BoolValue", t)
+}
+
+// NumValue は直前の解のもとでの数値（または整数）の項の値を float64 で返す関数。
+// 無理数の場合は近似値を返す。値を求められない場合はエラーを標準エラー出力に表示して 0 を返す。
+func (c *Context) NumValue(t *Term) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.numValue("NumValue", t)
+}
+
+// IntArrayValue は直前の解のもとでの整数の項の配列の値を返す関数
+func (c *Context) IntArrayValue(ts []*Term) []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := make([]int, len(ts))
+	for i, t := range ts {
+		r[i] = c.intValue("IntArrayValue", t)
+	}
+	return r
+}
+
+// BoolArrayValue は直前の解のもとでのブール型の項の配列の値を返す関数
+func (c *Context) BoolArrayValue(ts []*Term) []bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := make([]bool, len(ts))
+	for i, t := range ts {
+		r[i] = c.boolValue("BoolArrayValue", t)
+	}
+	return r
+}
+
+// NumArrayValue は直前の解のもとでの数値の項の配列の値を float64 で返す関数
+func (c *Context) NumArrayValue(ts []*Term) []float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := make([]float64, len(ts))
+	for i, t := range ts {
+		r[i] = c.numValue("NumArrayValue", t)
+	}
+	return r
+}
+
+// typedValue は項の値を求め、ソートが sorts のいずれかであることを確かめる関数。
+// 失敗した場合はエラーを標準エラー出力に表示して false を返す。呼び出し側でロックを取得していること。
+func (c *Context) typedValue(fn string, t *Term, sorts ...string) (Value, bool) {
+	if t.err == nil && !contains(sorts, t.Sort) {
+		fmt.Fprintf(os.Stderr, "%s: %s is %s, not %s\n", fn, t, t.Sort, strings.Join(sorts, " or "))
+		return Value{}, false
+	}
+	v, err := c.eval(t)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %v\n", fn, t, err)
+		return Value{}, false
+	}
+	return v, true
+}
+
+// intValue は IntValue の本体
+func (c *Context) intValue(fn string, t *Term) int {
+	v, ok := c.typedValue(fn, t, SortInt)
+	if !ok {
+		return 0
+	}
+	if v.Int == nil || !v.Int.IsInt64() || int64(int(v.Int.Int64())) != v.Int.Int64() {
+		fmt.Fprintf(os.Stderr, "%s: %s: value %s does not fit in int\n", fn, t, v.Text)
+		return 0
+	}
+	return int(v.Int.Int64())
+}
+
+// boolValue は BoolValue の本体
+func (c *Context) boolValue(fn string, t *Term) bool {
+	v, _ := c.typedValue(fn, t, SortBool)
+	return v.Bool
+}
+
+// numValue は NumValue の本体
+func (c *Context) numValue(fn string, t *Term) float64 {
+	v, ok := c.typedValue(fn, t, SortNum, SortInt)
+	if !ok {
+		return 0
+	}
+	switch {
+	case v.Int != nil:
+		f, _ := new(big.Float).SetInt(v.Int).Float64()
+		return f
+	case v.Rat != nil:
+		f, _ := v.Rat.Float64()
+		return f
+	case v.Approx != "":
+		f, err := strconv.ParseFloat(strings.TrimSuffix(v.Approx, "?"), 64)
+		if err == nil {
+			return f
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s: cannot convert %s to a number\n", fn, t, v.Text)
+	return 0
+}
+
+// contains は文字列のスライスが s を含むかどうかを調べる関数
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package smt_test
+
+import (
+	"testing"
+
+	"github.com/bunji2/practiceofdsl/smt"
+	"github.com/bunji2/practiceofdsl/smt/fd"
+)
+
+func TestSatUnsat(t *testing.T) {
+	tests := []struct {
+		name       string
+		hi         int // x の上限。0 未満なら解がない
+		solve      func(c *smt.Context)
+		sat, unsat bool
+	}{
+		{"before Check", 2, func(c *smt.Context) {}, false, false},
+		{"Solve", 2, func(c *smt.Context) { c.Solve("x") }, true, false},
+		{"Solve without solutions", -1, func(c *smt.Context) { c.Solve("x") }, false, true},
+		// SolveAll の最後の Check は解決不能だが、解を見つけたので Sat とする
+		{"SolveAll", 2, func(c *smt.Context) { c.SolveAll("x") }, true, false},
+		{"SolveAll without solutions", -1, func(c *smt.Context) { c.SolveAll("x") }, false, true},
+		{"Check after SolveAll", 2, func(c *smt.Context) {
+			c.SolveAll("x")
+			c.CheckAssuming(c.IntVar("x").Gt(c.IntVal(2)))
+		}, false, true},
+	}
+	for _, tt := range tests {
+		c := smt.NewContext(fd.New())
+		x := c.IntVar("x")
+		c.Assert(x.Ge(c.IntVal(0)).And(x.Le(c.IntVal(tt.hi))))
+		tt.solve(c)
+		if sat, unsat := c.Sat(), c.Unsat(); sat != tt.sat || unsat != tt.unsat {
+			t.Errorf("%s: Sat(), Unsat() = %v, %v; want %v, %v", tt.name, sat, unsat, tt.sat, tt.unsat)
+		}
+		c.Close()
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !cgo
+
+package z3
+
+import (
+	"errors"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+// cgo が使えない環境では Z3 をリンクできないので、
+// バックエンドを開こうとしたときにエラーを返す。
+func init() {
+	smt.RegisterBackend("z3", func() (smt.Backend, error) {
+		return nil, errors.New("z3 backend requires cgo; use another backend such as -backend fd")
+	})
+}
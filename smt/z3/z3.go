@@ -0,0 +1,500 @@
+//go:build cgo
+
+// Package z3 は Z3 を使う smt パッケージのバックエンド。
+// インポートすると "z3" という名前でバックエンドが登録される。
+package z3
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	gz3 "github.com/mitchellh/go-z3"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+// approxDigits は無理数（代数的数）の近似値を求める小数点以下の桁数。
+// 表示の際に -digits で指定された桁数に切り詰める。
+const approxDigits = 50
+
+func init() {
+	smt.RegisterBackend("z3", func() (smt.Backend, error) {
+		return New(), nil
+	})
+}
+
+// Backend は Z3 のコンテクストとソルバーを保持する構造体型
+type Backend struct {
+	ctx    *gz3.Context
+	solver *gz3.Solver // 最初に使うときに作成する
+	vars   map[string]*gz3.AST
+	sorts  map[string]string
+	names  []string
+
+	// 追加された制約条件。ソルバーを作成し直すときに追加し直す
+	asserted []*gz3.AST
+	proxies  int // CheckAssuming で作成した仮定のための制約変数の数
+
+	// temp は Bool だけの問題のソルバーが扱えない仮定のために、直前の CheckAssuming で作成した一時的なソルバー。
+	// 次の Check まで保持し、Model などはこのソルバーから取得する。timeout は Check の時間制限（ミリ秒）
+	temp    *gz3.Solver
+	timeout uint
+
+	// 直前に Model で取得したモデル。Eval で使い、次の Check まで保持する
+	model *gz3.Model
+
+	// ソルバーを作成するときに使うタクティクとロジック。
+	// detected は SelectLogic で渡された、検出したロジック
+	tactics  []string
+	logic    string
+	detected string
+}
+
+// logics は Z3 がソルバーを作成できる SMT-LIB のロジック
+var logics = map[string]bool{
+	"ALL": true, "QF_UF": true, "QF_AX": true, "QF_BV": true, "QF_FD": true, "QF_DT": true, "QF_S": true,
+	"QF_IDL": true, "QF_RDL": true, "QF_LIA": true, "QF_LRA": true, "QF_LIRA": true,
+	"QF_NIA": true, "QF_NRA": true, "QF_NIRA": true, "QF_UFLIA": true, "QF_ALIA": true, "QF_AUFLIA": true,
+	"LIA": true, "LRA": true, "NIA": true, "NRA": true, "UFLIA": true, "AUFLIA": true, "AUFLIRA": true, "AUFNIRA": true,
+	"HORN": true,
+}
+
+// New は Z3 のバックエンドを生成する関数
+func New() *Backend {
+	// コンテクストの作成
+	config := gz3.NewConfig()
+	ctx := gz3.NewContext(config)
+	config.Close()
+	return &Backend{
+		ctx:   ctx,
+		vars:  map[string]*gz3.AST{},
+		sorts: map[string]string{},
+	}
+}
+
+// solverLogics は検出したロジックのうち、Z3 では別のロジックのソルバーを使うもの。
+// Bool だけの問題は SAT ソルバーを使う QF_FD で解く。
+var solverLogics = map[string]string{
+	"QF_UF": "QF_FD",
+}
+
+// sol はソルバーを返す関数。最初に呼び出したときに、UseTactic と UseLogic の設定、
+// またはどちらもなければ検出したロジックに従ってソルバーを作成し、制約条件を追加する。
+func (b *Backend) sol() *gz3.Solver {
+	if b.solver == nil {
+		switch {
+		case len(b.tactics) > 0:
+			b.solver = b.ctx.NewSolverFromTactics(b.tactics...)
+		case b.logic != "":
+			b.solver = b.ctx.NewSolverForLogic(b.logic)
+		case b.detected != "":
+			logic := b.detected
+			if l, ok := solverLogics[logic]; ok {
+				logic = l
+			}
+			b.solver = b.ctx.NewSolverForLogic(logic)
+		default:
+			b.solver = b.ctx.NewSolver()
+		}
+		// Ctrl-C は Z3 ではなく Context.Interrupt で中断する
+		b.solver.SetBoolParam("ctrl_c", false)
+		for _, a := range b.asserted {
+			b.solver.Assert(a)
+		}
+	}
+	return b.solver
+}
+
+// configurable はソルバーを作成する前かどうかを調べる関数
+func (b *Backend) configurable() error {
+	if b.solver != nil {
+		return errors.New("z3: must be called before the first Solve")
+	}
+	return nil
+}
+
+// SelectLogic は検出したロジック用のソルバーを使うように設定する関数。
+// ロジックが変わった場合は、次に使うときにソルバーを作成し直す。
+func (b *Backend) SelectLogic(logic string) error {
+	if len(b.tactics) > 0 || b.logic != "" || logic == b.detected {
+		return nil
+	}
+	if _, ok := solverLogics[logic]; !ok && !logics[logic] {
+		return fmt.Errorf("z3: unknown logic %s", logic)
+	}
+	b.detected = logic
+	if b.solver != nil {
+		b.solver.Close()
+		b.solver = nil
+	}
+	return nil
+}
+
+// SetOption は Z3 のグローバルパラメータ（"smt.random_seed" など）を設定する関数。
+// グローバルパラメータは同じプロセスのすべてのコンテクストで共有される。
+func (b *Backend) SetOption(name, value string) error {
+	if err := b.configurable(); err != nil {
+		return err
+	}
+	if !gz3.SetGlobalParam(name, value) {
+		return fmt.Errorf("z3: unknown option %s", name)
+	}
+	return nil
+}
+
+// UseTactic は names のタクティクを順に適用するソルバーを使うように設定する関数
+func (b *Backend) UseTactic(names ...string) error {
+	if err := b.configurable(); err != nil {
+		return err
+	}
+	known := map[string]bool{}
+	for _, name := range b.ctx.TacticNames() {
+		known[name] = true
+	}
+	for _, name := range names {
+		if !known[name] {
+			return fmt.Errorf("z3: unknown tactic %s", name)
+		}
+	}
+	b.tactics = append([]string{}, names...)
+	return nil
+}
+
+// UseLogic はロジック用のソルバーを使うように設定する関数
+func (b *Backend) UseLogic(logic string) error {
+	if err := b.configurable(); err != nil {
+		return err
+	}
+	if !logics[logic] {
+		return fmt.Errorf("z3: unknown logic %s", logic)
+	}
+	b.logic = logic
+	return nil
+}
+
+// DeclareVar は制約変数を宣言する関数
+func (b *Backend) DeclareVar(name, sort string) error {
+	var s *gz3.Sort
+	switch sort {
+	case smt.SortInt:
+		s = b.ctx.IntSort()
+	case smt.SortNum:
+		s = b.ctx.RealSort()
+	case smt.SortBool:
+		s = b.ctx.BoolSort()
+	default:
+		return fmt.Errorf("z3: unknown sort %s", sort)
+	}
+	b.vars[name] = b.ctx.Const(b.ctx.Symbol(name), s)
+	b.sorts[name] = sort
+	b.names = append(b.names, name)
+	return nil
+}
+
+// Assert は制約条件を追加する関数
+func (b *Backend) Assert(cond *smt.Term) error {
+	a, err := b.ast(cond)
+	if err != nil {
+		return err
+	}
+	b.assert(a)
+	return nil
+}
+
+// assert は Z3 の制約条件を追加する関数
+func (b *Backend) assert(a *gz3.AST) {
+	b.asserted = append(b.asserted, a)
+	if b.solver != nil {
+		b.solver.Assert(a)
+	}
+}
+
+// ast は項を Z3 の ASTノードに変換する関数
+func (b *Backend) ast(t *smt.Term) (*gz3.AST, error) {
+	switch t.Op {
+	case smt.OpVar:
+		a, ok := b.vars[t.Name]
+		if !ok {
+			return nil, fmt.Errorf("z3: undeclared variable %s", t.Name)
+		}
+		return a, nil
+	case smt.OpConst:
+		switch t.Sort {
+		case smt.SortBool:
+			if t.Bool {
+				return b.ctx.True(), nil
+			}
+			return b.ctx.False(), nil
+		case smt.SortInt:
+			return b.ctx.Num(t.Num.Num().String(), b.ctx.IntSort()), nil
+		}
+		return b.ctx.Num(t.Num.RatString(), b.ctx.RealSort()), nil
+	}
+
+	args := make([]*gz3.AST, len(t.Args))
+	for i, arg := range t.Args {
+		a, err := b.ast(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = a
+	}
+	x, rest := args[0], args[1:]
+
+	switch t.Op {
+	case smt.OpAdd:
+		return x.Add(rest...), nil
+	case smt.OpSub:
+		return x.Sub(rest...), nil
+	case smt.OpMul:
+		return x.Mul(rest...), nil
+	case smt.OpDiv:
+		return x.Div(rest[0]), nil
+	case smt.OpMod:
+		return x.Mod(rest[0]), nil
+	case smt.OpPow:
+		return x.Pow(rest[0]), nil
+	case smt.OpNeg:
+		return x.Neg(), nil
+	case smt.OpEq:
+		return x.Eq(rest[0]), nil
+	case smt.OpDistinct:
+		return x.Distinct(rest...), nil
+	case smt.OpLt:
+		return x.Lt(rest[0]), nil
+	case smt.OpLe:
+		return x.Le(rest[0]), nil
+	case smt.OpGt:
+		return x.Gt(rest[0]), nil
+	case smt.OpGe:
+		return x.Ge(rest[0]), nil
+	case smt.OpNot:
+		return x.Not(), nil
+	case smt.OpAnd:
+		return x.And(rest...), nil
+	case smt.OpOr:
+		return x.Or(rest...), nil
+	case smt.OpXor:
+		return x.Xor(rest[0]), nil
+	case smt.OpImplies:
+		return x.Implies(rest[0]), nil
+	case smt.OpIff:
+		return x.Iff(rest[0]), nil
+	case smt.OpIte:
+		return x.Ite(rest[0], rest[1]), nil
+	case smt.OpToReal:
+		return x.ToReal(), nil
+	case smt.OpToInt:
+		return x.ToInt(), nil
+	case smt.OpIsInt:
+		return x.IsInt(), nil
+	}
+	return nil, fmt.Errorf("z3: unsupported operator %s", t.Op)
+}
+
+// Check は制約が解決可能かどうかを調べる関数
+func (b *Backend) Check() (smt.Status, error) {
+	b.closeModel()
+	b.closeTemp()
+	return toStatus(b.sol().Check()), nil
+}
+
+// toStatus は Z3 の判定の結果を smt.Status に変換する関数
+func toStatus(r gz3.LBool) smt.Status {
+	switch r {
+	case gz3.True:
+		return smt.StatusSat
+	case gz3.False:
+		return smt.StatusUnsat
+	}
+	return smt.StatusUnknown
+}
+
+// CheckAssuming は lits の制約条件を一時的に仮定して、制約が解決可能かどうかを調べる関数。
+// ブール型の制約変数とその否定以外の仮定は、新しいブール型の定数 p と制約条件 p => lit に置き換えて p を仮定する。
+// Bool だけの問題に使う QF_FD のソルバーは整数や数値を扱えないので、そのような仮定は
+// ソルバーを作成し直さずに、一時的なソルバーで調べる。
+func (b *Backend) CheckAssuming(lits []*smt.Term) (smt.Status, error) {
+	b.closeModel()
+	b.closeTemp()
+	if len(b.tactics) == 0 && b.logic == "" && b.detected == "QF_UF" && smt.DetectLogic(lits) != "QF_UF" {
+		return b.checkTemp(lits)
+	}
+	var assumptions []*gz3.AST
+	for _, t := range lits {
+		a, err := b.ast(t)
+		if err != nil {
+			return smt.StatusUnknown, err
+		}
+		if !isLiteral(t) {
+			b.proxies++
+			p := b.ctx.Const(b.ctx.Symbol(fmt.Sprintf("assume!%d", b.proxies)), b.ctx.BoolSort())
+			b.assert(p.Implies(a))
+			a = p
+		}
+		assumptions = append(assumptions, a)
+	}
+	return toStatus(b.sol().CheckAssumptions(assumptions...)), nil
+}
+
+// checkTemp は追加された制約条件と lits の制約条件を、一時的に作成した汎用のソルバーで調べる関数
+func (b *Backend) checkTemp(lits []*smt.Term) (smt.Status, error) {
+	var conds []*gz3.AST
+	for _, t := range lits {
+		a, err := b.ast(t)
+		if err != nil {
+			return smt.StatusUnknown, err
+		}
+		conds = append(conds, a)
+	}
+	b.temp = b.ctx.NewSolver()
+	b.temp.SetBoolParam("ctrl_c", false)
+	b.temp.SetTimeout(b.timeout)
+	for _, a := range append(b.asserted, conds...) {
+		b.temp.Assert(a)
+	}
+	return toStatus(b.temp.Check()), nil
+}
+
+// current は直前の Check に使ったソルバーを返す関数。まだ Check していなければ nil を返す
+func (b *Backend) current() *gz3.Solver {
+	if b.temp != nil {
+		return b.temp
+	}
+	return b.solver
+}
+
+// closeTemp は CheckAssuming で作成した一時的なソルバーを解放する関数
+func (b *Backend) closeTemp() {
+	if b.temp != nil {
+		b.temp.Close()
+		b.temp = nil
+	}
+}
+
+// isLiteral は項がブール型の制約変数かその否定かどうかを調べる関数
+func isLiteral(t *smt.Term) bool {
+	if t.Op == smt.OpNot {
+		t = t.Args[0]
+	}
+	return t.Op == smt.OpVar
+}
+
+// Interrupt は実行中の Check を中断する関数。別のゴルーチンから呼び出してよい。
+func (b *Backend) Interrupt() {
+	b.ctx.Interrupt()
+}
+
+// SetTimeout は Check の時間制限を設定する関数。d が 0 の場合は時間制限を解除する。
+func (b *Backend) SetTimeout(d time.Duration) error {
+	b.timeout = uint(d.Milliseconds())
+	b.sol().SetTimeout(b.timeout)
+	return nil
+}
+
+// ReasonUnknown は直前の Check が判定できなかった理由を返す関数。
+// まだ Check していない場合は、ソルバーを作成せずに空文字列を返す。
+func (b *Backend) ReasonUnknown() string {
+	s := b.current()
+	if s == nil {
+		return ""
+	}
+	return s.ReasonUnknown()
+}
+
+// Statistics は Z3 の統計情報（conflicts、decisions、memory など）を返す関数。
+// まだ Check していない場合は、ソルバーを作成せずに空の統計情報を返す。
+func (b *Backend) Statistics() []smt.Stat {
+	solver := b.current()
+	if solver == nil {
+		return nil
+	}
+	var stats []smt.Stat
+	for _, s := range solver.Statistics() {
+		stats = append(stats, smt.Stat{Key: "z3." + s.Key, Value: s.Value})
+	}
+	return stats
+}
+
+// Model は宣言されたすべての制約変数の値を返す関数。
+// 取得したモデルは Eval のために次の Check まで保持する。
+func (b *Backend) Model() (map[string]smt.Value, error) {
+	b.closeModel()
+	s := b.current()
+	if s == nil {
+		return nil, errors.New("z3: no model")
+	}
+	m := s.Model()
+	b.model = m
+
+	values := map[string]smt.Value{}
+	for _, name := range b.names {
+		// 制約に現れない変数も既定値で補完して評価する
+		values[name] = toValue(b.sorts[name], m.Eval(b.vars[name]))
+	}
+	return values, nil
+}
+
+// Eval は直前に Model で取得したモデルのもとで項を評価する関数。
+// モデルに現れない制約変数は既定値で補完する。
+func (b *Backend) Eval(t *smt.Term) (smt.Value, error) {
+	if b.model == nil {
+		return smt.Value{}, errors.New("z3: no model")
+	}
+	a, err := b.ast(t)
+	if err != nil {
+		return smt.Value{}, err
+	}
+	v := b.model.Eval(a)
+	if v == nil {
+		return smt.Value{}, fmt.Errorf("z3: cannot evaluate %s", t)
+	}
+	return toValue(t.Sort, v), nil
+}
+
+// closeModel は保持しているモデルを解放する関数
+func (b *Backend) closeModel() {
+	if b.model != nil {
+		b.model.Close()
+		b.model = nil
+	}
+}
+
+// toValue は Z3 の値を smt.Value に変換する関数
+func toValue(sort string, a *gz3.AST) (v smt.Value) {
+	v.Sort = sort
+	if a == nil {
+		return
+	}
+	v.Text = a.String()
+	switch {
+	case sort == smt.SortBool:
+		v.Bool = v.Text == "true"
+	case a.IsNumeral():
+		if sort == smt.SortInt {
+			v.Int, _ = new(big.Int).SetString(a.NumeralString(), 10)
+		} else {
+			v.Rat, _ = new(big.Rat).SetString(a.NumeralString())
+		}
+	case a.IsAlgebraicNumber():
+		v.Approx = a.DecimalString(approxDigits)
+	}
+	return
+}
+
+// Close はソルバーとコンテクストをクローズする関数
+func (b *Backend) Close() error {
+	b.closeModel()
+	b.closeTemp()
+	if b.solver != nil {
+		b.solver.Close()
+		b.solver = nil
+	}
+	if b.ctx != nil {
+		b.ctx.Close()
+		b.ctx = nil
+	}
+	return nil
+}
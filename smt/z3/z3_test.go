@@ -0,0 +1,75 @@
+//go:build cgo
+
+package z3
+
+import (
+	"testing"
+
+	gz3 "github.com/mitchellh/go-z3"
+
+	"github.com/bunji2/practiceofdsl/smt"
+)
+
+func TestAssumptionLogic(t *testing.T) {
+	// Bool だけの問題は QF_FD のソルバーのまま、整数の仮定は一時的なソルバーで調べる
+	b := New()
+	c := smt.NewContext(b)
+	defer c.Close()
+	x, p, q := c.IntVar("x"), c.BoolVar("p"), c.BoolVar("q")
+	c.Assert(p.Or(q))
+	c.Assert(p.Not())
+	tests := []struct {
+		lits []*smt.Term
+		want smt.Status
+	}{
+		{[]*smt.Term{x.Gt(c.IntVal(3)), q}, smt.StatusSat},
+		{[]*smt.Term{x.Gt(c.IntVal(3)).And(x.Lt(c.IntVal(2)))}, smt.StatusUnsat},
+		{[]*smt.Term{p}, smt.StatusUnsat},
+		{nil, smt.StatusSat},
+	}
+	var solver *gz3.Solver
+	for _, tt := range tests {
+		st, err := c.CheckAssuming(tt.lits...)
+		if solver == nil {
+			solver = b.solver
+		}
+		if st != tt.want || err != nil {
+			t.Errorf("CheckAssuming(%v) = %s, %v; want %s", tt.lits, st, err, tt.want)
+		}
+		if l := c.Logic(); l != "QF_UF" {
+			t.Errorf("CheckAssuming(%v): logic %s; want QF_UF", tt.lits, l)
+		}
+		if b.solver != solver {
+			t.Errorf("CheckAssuming(%v) created the solver again", tt.lits)
+		}
+	}
+	r, err := c.Model()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := r.Bool("q"); !v {
+		t.Errorf("q = false; want true")
+	}
+}
+
+func TestBeforeCheck(t *testing.T) {
+	// Check の前の統計情報と理由の問い合わせは、ソルバーを作成しない
+	b := New()
+	defer b.Close()
+	if stats := b.Statistics(); stats != nil {
+		t.Errorf("Statistics() = %v before Check; want none", stats)
+	}
+	if r := b.ReasonUnknown(); r != "" {
+		t.Errorf("ReasonUnknown() = %q before Check; want empty", r)
+	}
+	if _, err := b.Model(); err == nil {
+		t.Errorf("Model() before Check succeeded; want an error")
+	}
+	if b.solver != nil {
+		t.Errorf("the solver was created before Check")
+	}
+	// ソルバーを作成していないので、UseLogic はまだ設定できる
+	if err := b.UseLogic("QF_LIA"); err != nil {
+		t.Errorf("UseLogic after Statistics: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+//go:build ignore
+
+// SMT-LIB2 のファイルを DSL のランタイムで解決するプログラム
+//
+//	go run smt2.go lib.go lib2.go lib3.go [-backend z3] file.smt2
+//
+// dsl smt2 file.smt2 から実行する。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bunji2/practiceofdsl/smt/smtlib"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	ccc = NewContext()
+	defer ccc.Close()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: dsl smt2 [-dsl] file.smt2\n")
+		return 1
+	}
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer f.Close()
+
+	s, err := smtlib.Parse(ccc, f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flag.Arg(0), err)
+		return 3
+	}
+	if err := s.Run(ccc); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flag.Arg(0), err)
+		return 4
+	}
+	return 0
+}